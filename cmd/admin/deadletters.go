@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+func listDeadLetters(ctx context.Context, srv *service.Service, args []string) error {
+	fs := flag.NewFlagSet("dead-letters list", flag.ExitOnError)
+	status := fs.String("status", string(models.DeadLetterStatusOpen), "OPEN, REQUEUED, RESOLVED or empty for all")
+	limit := fs.Int("limit", 50, "page size")
+	offset := fs.Int("offset", 0, "page offset")
+	fs.Parse(args) //nolint:errcheck
+
+	deadLetters, err := srv.ListDeadLetters(ctx, models.DeadLetterStatus(*status), *limit, *offset)
+	if err != nil {
+		return err
+	}
+	return printJSON(deadLetters)
+}
+
+func showDeadLetter(ctx context.Context, srv *service.Service, args []string) error {
+	fs := flag.NewFlagSet("dead-letters show", flag.ExitOnError)
+	fs.Parse(args) //nolint:errcheck
+
+	id, err := deadLetterID(fs)
+	if err != nil {
+		return err
+	}
+
+	deadLetter, err := srv.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	return printJSON(deadLetter)
+}
+
+func requeueDeadLetter(ctx context.Context, srv *service.Service, args []string) error {
+	fs := flag.NewFlagSet("dead-letters requeue", flag.ExitOnError)
+	reason := fs.String("reason", "", "why the transaction is re-queued (required)")
+	operator := fs.String("operator", os.Getenv("USER"), "who re-queues it")
+	fs.Parse(args) //nolint:errcheck
+
+	id, err := deadLetterID(fs)
+	if err != nil {
+		return err
+	}
+
+	deadLetter, err := srv.RequeueDeadLetter(ctx, id, shared.RequeueDeadLetterRequest{
+		Reason:   *reason,
+		Operator: *operator,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(deadLetter)
+}
+
+func resolveDeadLetter(ctx context.Context, srv *service.Service, args []string) error {
+	fs := flag.NewFlagSet("dead-letters resolve", flag.ExitOnError)
+	status := fs.String("status", "", "CONFIRMED if the wallet applied the transaction, FAILED otherwise (required)")
+	reason := fs.String("reason", "", "why the transaction is resolved this way (required)")
+	operator := fs.String("operator", os.Getenv("USER"), "who resolves it")
+	fs.Parse(args) //nolint:errcheck
+
+	id, err := deadLetterID(fs)
+	if err != nil {
+		return err
+	}
+
+	deadLetter, err := srv.ResolveDeadLetter(ctx, id, shared.ResolveDeadLetterRequest{
+		Status:   models.TransactionStatus(*status),
+		Reason:   *reason,
+		Operator: *operator,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(deadLetter)
+}
+
+func deadLetterID(fs *flag.FlagSet) (uuid.UUID, error) {
+	if fs.NArg() != 1 {
+		return uuid.Nil, errors.New("expected exactly one dead letter id")
+	}
+	return uuid.Parse(fs.Arg(0))
+}
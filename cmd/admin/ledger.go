@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+)
+
+func showPlayerLedger(ctx context.Context, srv *service.Service, args []string) error {
+	fs := flag.NewFlagSet("ledger show", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "number of journal entries")
+	offset := fs.Int("offset", 0, "journal entries offset")
+	fs.Parse(args) //nolint:errcheck
+
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one player id")
+	}
+	playerID, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	ledger, err := srv.GetPlayerLedger(ctx, playerID, *limit, *offset)
+	if err != nil {
+		return err
+	}
+	return printJSON(ledger)
+}
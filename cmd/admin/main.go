@@ -0,0 +1,93 @@
+// Command admin runs operator tasks against the game integration database,
+// using the same configuration as the API server.
+//
+// Usage:
+//
+//	admin dead-letters list [-status OPEN] [-limit 50] [-offset 0]
+//	admin dead-letters show <id>
+//	admin dead-letters requeue -reason "..." [-operator name] <id>
+//	admin dead-letters resolve -status CONFIRMED|FAILED -reason "..." [-operator name] <id>
+//	admin ledger show [-limit 50] [-offset 0] <player_id>
+//	admin reconcile run [-wallet-url http://localhost:8000]
+//	admin reconcile list [-limit 50] [-offset 0]
+//	admin reconcile show <id>
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+
+	_ "github.com/jihedmastouri/game-integration-api-demo/repository/migrations"
+)
+
+type command func(ctx context.Context, srv *service.Service, args []string) error
+
+var commands = map[string]map[string]command{
+	"dead-letters": {
+		"list":    listDeadLetters,
+		"show":    showDeadLetter,
+		"requeue": requeueDeadLetter,
+		"resolve": resolveDeadLetter,
+	},
+	"ledger": {
+		"show": showPlayerLedger,
+	},
+	"reconcile": {
+		"run":  runReconciliation,
+		"list": listReconciliations,
+		"show": showReconciliation,
+	},
+}
+
+func main() {
+	// Logs go to stderr, stdout is kept for the command output
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	if len(os.Args) < 3 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]][os.Args[2]]
+	if !ok {
+		usage()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := repository.Connect(internal.Config.DATABASE_URL)
+	if err != nil {
+		slog.Error("Failed to connect to db", "error", err)
+		os.Exit(1)
+	}
+
+	srv := service.NewService(repo, service.NewWallet())
+	if err := cmd(ctx, srv, os.Args[3:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin <group> <command> [flags] [args]")
+	for group, cmds := range commands {
+		for name := range cmds {
+			fmt.Fprintf(os.Stderr, "  admin %s %s\n", group, name)
+		}
+	}
+	os.Exit(2)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+)
+
+func runReconciliation(ctx context.Context, srv *service.Service, args []string) error {
+	fs := flag.NewFlagSet("reconcile run", flag.ExitOnError)
+	walletURL := fs.String("wallet-url", "", "wallet API to compare with instead of WALLET_API_URL, e.g. a local mockwallet")
+	fs.Parse(args) //nolint:errcheck
+
+	if *walletURL != "" {
+		internal.Config.WALLET_API_URL = *walletURL
+		internal.Config.WALLET_FAKE = false
+		srv.WalletClient = service.NewWallet()
+	}
+
+	run, err := srv.Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(run)
+}
+
+func listReconciliations(ctx context.Context, srv *service.Service, args []string) error {
+	fs := flag.NewFlagSet("reconcile list", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "page size")
+	offset := fs.Int("offset", 0, "page offset")
+	fs.Parse(args) //nolint:errcheck
+
+	runs, err := srv.ListReconciliationRuns(ctx, *limit, *offset)
+	if err != nil {
+		return err
+	}
+	return printJSON(runs)
+}
+
+func showReconciliation(ctx context.Context, srv *service.Service, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one reconciliation run id")
+	}
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	run, err := srv.GetReconciliationRun(ctx, id)
+	if err != nil {
+		return err
+	}
+	return printJSON(run)
+}
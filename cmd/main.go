@@ -36,12 +36,14 @@ func main() {
 		os.Exit(1) // Exit if database connection fails
 	}
 
-	srv := service.NewService(repo)
+	srv := service.NewService(repo, service.NewWallet())
 
 	// Start pending transaction worker
 	workerCtx, workerCancel := context.WithCancel(context.Background())
 	defer workerCancel()
 	go srv.StartPendingTransactionWorker(workerCtx)
+	go srv.StartReconciliationJob(workerCtx)
+	go srv.StartIdempotencyKeyCleanup(workerCtx)
 
 	server := transport.Web(internal.Config.APP_URL, srv, logger)
 
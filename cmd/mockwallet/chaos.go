@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type chaosConfig struct {
+	ErrorRate   float64
+	Latency     time.Duration
+	Jitter      time.Duration
+	TimeoutRate float64
+	Timeout     time.Duration
+	DropRate    float64
+	Seed        int64
+}
+
+type chaos struct {
+	cfg chaosConfig
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newChaos(cfg chaosConfig) *chaos {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &chaos{
+		cfg: cfg,
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (ch *chaos) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.rnd.Float64() < rate
+}
+
+func (ch *chaos) jitter() time.Duration {
+	if ch.cfg.Jitter <= 0 {
+		return 0
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return time.Duration(ch.rnd.Int63n(int64(ch.cfg.Jitter)))
+}
+
+func (ch *chaos) serverError() int {
+	statuses := []int{
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return statuses[ch.rnd.Intn(len(statuses))]
+}
+
+// Middleware applies, in order: latency, hanging requests, random 5xx before
+// the operation runs and dropped responses after a deposit or withdrawal
+// has been applied.
+func (ch *chaos) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			if delay := ch.cfg.Latency + ch.jitter(); delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+			if ch.roll(ch.cfg.TimeoutRate) {
+				slog.Info("Chaos: hanging request", "uri", c.Request().RequestURI, "timeout", ch.cfg.Timeout)
+				select {
+				case <-time.After(ch.cfg.Timeout):
+				case <-ctx.Done():
+					return nil
+				}
+				return writeError(c, http.StatusGatewayTimeout, "TIMEOUT", "chaos: request timed out")
+			}
+
+			if ch.roll(ch.cfg.ErrorRate) {
+				status := ch.serverError()
+				slog.Info("Chaos: failing request", "uri", c.Request().RequestURI, "status", status)
+				return writeError(c, status, "INTERNAL_ERROR", "chaos: random failure")
+			}
+
+			if c.Request().Method != http.MethodPost || !ch.roll(ch.cfg.DropRate) {
+				return next(c)
+			}
+
+			// Run the operation against a discarded response, then cut the
+			// connection so the client never learns it was applied.
+			res := c.Response()
+			original := res.Writer
+			res.Writer = discardWriter{header: http.Header{}}
+			err := next(c)
+			res.Writer = original
+			res.Committed = false
+
+			slog.Info("Chaos: dropping response after commit", "uri", c.Request().RequestURI, "error", err)
+			conn, _, hijackErr := http.NewResponseController(original).Hijack()
+			if hijackErr != nil {
+				return writeError(c, http.StatusBadGateway, "INTERNAL_ERROR", "chaos: response dropped")
+			}
+			conn.Close() //nolint:errcheck
+			return nil
+		}
+	}
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (d discardWriter) Header() http.Header         { return d.header }
+func (d discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,111 @@
+// Command mockwallet serves the wallet API the game integration API talks to
+// (see service/walletclient/endpoints.go), backed by walletclient.FakeWallet.
+//
+// It can misbehave on purpose to reproduce an unreliable wallet: random 5xx
+// answers, added latency, requests that hang past the client timeout and
+// operations that are applied but whose response is dropped.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.Address, "addr", "0.0.0.0:8000", "address to listen on")
+	flag.StringVar(&cfg.APIKey, "api-key", getDefaultEnv("WALLET_API_KEY", "naUsB1EQS9U"), "expected x-api-key header")
+	flag.StringVar(&cfg.StateFile, "state", "", "JSON file to persist balances in (memory only when empty)")
+	flag.StringVar(&cfg.Currency, "currency", "USD", "currency of accounts opened on first use")
+	flag.TextVar(&cfg.InitialBalance, "balance", models.NewAmount(1000), "balance of accounts opened on first use")
+	flag.Float64Var(&cfg.Chaos.ErrorRate, "error-rate", 0, "fraction of requests answered with a random 5xx (0-1)")
+	flag.DurationVar(&cfg.Chaos.Latency, "latency", 0, "latency added to every request")
+	flag.DurationVar(&cfg.Chaos.Jitter, "jitter", 0, "random extra latency added on top of -latency")
+	flag.Float64Var(&cfg.Chaos.TimeoutRate, "timeout-rate", 0, "fraction of requests that hang for -timeout before failing (0-1)")
+	flag.DurationVar(&cfg.Chaos.Timeout, "timeout", 60*time.Second, "how long a timed out request hangs")
+	flag.Float64Var(&cfg.Chaos.DropRate, "drop-rate", 0, "fraction of deposits/withdrawals applied but answered with a dropped connection (0-1)")
+	flag.Int64Var(&cfg.Chaos.Seed, "seed", 0, "random seed for chaos decisions (time based when 0)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	store, err := newStore(cfg)
+	if err != nil {
+		slog.Error("Failed to load wallet state", "error", err, "file", cfg.StateFile)
+		os.Exit(1)
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(middleware.Recover())
+
+	chaos := newChaos(cfg.Chaos)
+	api := e.Group("/api/v1", apiKeyMiddleware(cfg.APIKey), chaos.Middleware())
+	{
+		api.POST("/deposit", store.Deposit)
+		api.POST("/withdraw", store.Withdraw)
+		api.GET("/balance/:id", store.Balance)
+	}
+
+	go func() {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := e.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Mock wallet forced to shutdown", "error", err)
+		}
+	}()
+
+	slog.Info("Starting mock wallet", "address", cfg.Address, "state", cfg.StateFile, "chaos", cfg.Chaos)
+	if err := e.Start(cfg.Address); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Failed to start mock wallet", "error", err)
+		os.Exit(1)
+	}
+}
+
+type config struct {
+	Address        string
+	APIKey         string
+	StateFile      string
+	Currency       string
+	InitialBalance models.Amount
+	Chaos          chaosConfig
+}
+
+func apiKeyMiddleware(apiKey string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("x-api-key") != apiKey {
+				return writeError(c, http.StatusUnauthorized, "UNAUTHORIZED", "invalid api key")
+			}
+			return next(c)
+		}
+	}
+}
+
+func writeError(c echo.Context, status int, code, msg string) error {
+	return c.JSON(status, map[string]string{"code": code, "msg": msg})
+}
+
+func getDefaultEnv(name, defaultValue string) string {
+	if envValue := os.Getenv(name); envValue != "" {
+		return envValue
+	}
+	return defaultValue
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+)
+
+// store exposes a FakeWallet over HTTP and persists it to a JSON file after
+// every successful deposit or withdrawal.
+type store struct {
+	wallet *walletclient.FakeWallet
+	file   string
+	mu     sync.Mutex
+}
+
+func newStore(cfg config) (*store, error) {
+	s := &store{
+		wallet: walletclient.NewFakeWallet(cfg.Currency, cfg.InitialBalance),
+		file:   cfg.StateFile,
+	}
+	if s.file == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state walletclient.FakeWalletState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	s.wallet.Restore(state)
+
+	return s, nil
+}
+
+func (s *store) Deposit(c echo.Context) error {
+	var req walletclient.DepositRequest
+	if err := decodeJSON(c, &req); err != nil {
+		return writeError(c, http.StatusBadRequest, walletclient.ErrCodeInvalidRequest, err.Error())
+	}
+
+	resp, err := s.wallet.Deposit(c.Request().Context(), req)
+	if err != nil {
+		return writeWalletError(c, err)
+	}
+	s.persist()
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *store) Withdraw(c echo.Context) error {
+	var req walletclient.WithdrawRequest
+	if err := decodeJSON(c, &req); err != nil {
+		return writeError(c, http.StatusBadRequest, walletclient.ErrCodeInvalidRequest, err.Error())
+	}
+
+	resp, err := s.wallet.Withdraw(c.Request().Context(), req)
+	if err != nil {
+		return writeWalletError(c, err)
+	}
+	s.persist()
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *store) Balance(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return writeError(c, http.StatusBadRequest, walletclient.ErrCodeInvalidRequest, "invalid user id")
+	}
+
+	resp, err := s.wallet.GetBalance(c.Request().Context(), userID)
+	if err != nil {
+		return writeWalletError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// persist writes the wallet state to a temporary file and renames it so a
+// crash never leaves a truncated state file behind.
+func (s *store) persist() {
+	if s.file == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s.wallet.Snapshot(), "", "  ")
+	if err != nil {
+		slog.Error("Failed to encode wallet state", "error", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".*")
+	if err != nil {
+		slog.Error("Failed to write wallet state", "error", err)
+		return
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+		slog.Error("Failed to write wallet state", "error", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		slog.Error("Failed to write wallet state", "error", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), s.file); err != nil {
+		slog.Error("Failed to write wallet state", "error", err)
+	}
+}
+
+func writeWalletError(c echo.Context, err error) error {
+	var walletErr *walletclient.ErrorResponse
+	if !errors.As(err, &walletErr) {
+		return writeError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+
+	status := http.StatusBadRequest
+	if walletErr.Code == walletclient.ErrCodeUserNotFound {
+		status = http.StatusNotFound
+	}
+	return writeError(c, status, walletErr.Code, walletErr.Msg)
+}
+
+func decodeJSON(c echo.Context, v any) error {
+	return json.NewDecoder(c.Request().Body).Decode(v)
+}
@@ -18,47 +18,114 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/v1/auth": {
-            "post": {
-                "description": "Authenticates a player using username and password, returns a JWT token",
-                "consumes": [
-                    "application/json"
+        "/api/v1/admin/dead-letters": {
+            "get": {
+                "security": [
+                    {
+                        "AdminKey": []
+                    }
                 ],
+                "description": "Lists transactions the worker gave up on, newest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
                 ],
-                "summary": "Authenticate player",
+                "summary": "List dead letters",
                 "parameters": [
                     {
-                        "description": "Authentication credentials",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
+                        "enum": [
+                            "OPEN",
+                            "REQUEUED",
+                            "RESOLVED"
+                        ],
+                        "type": "string",
+                        "description": "Filter by status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Page offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Dead letters",
                         "schema": {
-                            "$ref": "#/definitions/service.AuthRequest"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/shared.DeadLetterResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/dead-letters/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminKey": []
+                    }
+                ],
+                "description": "Returns a dead letter with every wallet attempt made for its transaction",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get a dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Authentication successful",
+                        "description": "Dead letter",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/shared.DeadLetterResponse"
                         }
                     },
                     "400": {
                         "description": "Bad request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/shared.ErrorResponse"
                         }
                     },
                     "401": {
@@ -67,6 +134,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/shared.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Dead letter not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -76,14 +149,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/cancel": {
+        "/api/v1/admin/dead-letters/{id}/requeue": {
             "post": {
                 "security": [
                     {
-                        "BearerAuth": []
+                        "AdminKey": []
                     }
                 ],
-                "description": "Reverts a previously processed transaction by reversing its financial impact",
+                "description": "Puts the transaction back in the pending queue with a fresh retry budget",
                 "consumes": [
                     "application/json"
                 ],
@@ -91,33 +164,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Betting"
+                    "Admin"
                 ],
-                "summary": "Cancel a transaction",
+                "summary": "Re-queue a dead letter",
                 "parameters": [
                     {
                         "type": "string",
-                        "default": "Bearer \u003ctoken\u003e",
-                        "description": "Bearer token",
-                        "name": "Authorization",
-                        "in": "header",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Cancel request details",
+                        "description": "Why the transaction is re-queued",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/shared.CancelRequest"
+                            "$ref": "#/definitions/shared.RequeueDeadLetterRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Transaction cancelled successfully",
+                        "description": "Dead letter re-queued",
                         "schema": {
-                            "$ref": "#/definitions/shared.BetOperationResponse"
+                            "$ref": "#/definitions/shared.DeadLetterResponse"
                         }
                     },
                     "400": {
@@ -133,7 +205,13 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Transaction not found",
+                        "description": "Dead letter not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Dead letter already closed, or its transaction changed meanwhile",
                         "schema": {
                             "$ref": "#/definitions/shared.ErrorResponse"
                         }
@@ -147,14 +225,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/deposit": {
+        "/api/v1/admin/dead-letters/{id}/resolve": {
             "post": {
                 "security": [
                     {
-                        "BearerAuth": []
+                        "AdminKey": []
                     }
                 ],
-                "description": "Processes a deposit into a player's account. Represents bet settlement - if amount is zero, bet is LOST; otherwise, bet is WON.",
+                "description": "Forces the final status (CONFIRMED or FAILED) of the transaction once the wallet state was checked",
                 "consumes": [
                     "application/json"
                 ],
@@ -162,33 +240,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Betting"
+                    "Admin"
                 ],
-                "summary": "Settle a bet",
+                "summary": "Force-resolve a dead letter",
                 "parameters": [
                     {
                         "type": "string",
-                        "default": "Bearer \u003ctoken\u003e",
-                        "description": "Bearer token",
-                        "name": "Authorization",
-                        "in": "header",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Settle request details",
+                        "description": "Resolution and why",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/shared.DepositRequest"
+                            "$ref": "#/definitions/shared.ResolveDeadLetterRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Bet settled successfully",
+                        "description": "Dead letter resolved",
                         "schema": {
-                            "$ref": "#/definitions/shared.BetOperationResponse"
+                            "$ref": "#/definitions/shared.DeadLetterResponse"
                         }
                     },
                     "400": {
@@ -203,6 +280,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/shared.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Dead letter not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Dead letter already closed, or its transaction changed meanwhile",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -212,39 +301,55 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/player-info": {
+        "/api/v1/admin/ledger/players/{id}": {
             "get": {
                 "security": [
                     {
-                        "BearerAuth": []
+                        "AdminKey": []
                     }
                 ],
-                "description": "Retrieves essential player details including user ID, balance, and currency",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Returns what the wallet balances of a player should be according to the local ledger, with its latest journal entries",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Player"
+                    "Admin"
                 ],
-                "summary": "Get player information",
+                "summary": "Get the ledger of a player",
                 "parameters": [
                     {
-                        "type": "string",
-                        "default": "Bearer \u003ctoken\u003e",
-                        "description": "Bearer token",
-                        "name": "Authorization",
-                        "in": "header",
+                        "type": "integer",
+                        "description": "Player ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Number of journal entries (max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Journal entries offset",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Player information",
+                        "description": "Player ledger",
                         "schema": {
-                            "$ref": "#/definitions/shared.PlayerInfoResponse"
+                            "$ref": "#/definitions/shared.PlayerLedgerResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
                         }
                     },
                     "401": {
@@ -262,48 +367,132 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/withdraw": {
+        "/api/v1/admin/reconciliations": {
+            "get": {
+                "security": [
+                    {
+                        "AdminKey": []
+                    }
+                ],
+                "description": "Lists reconciliation runs with their counters, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List reconciliation runs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Page offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Reconciliation runs",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/shared.ReconciliationRunResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            },
             "post": {
                 "security": [
                     {
-                        "BearerAuth": []
+                        "AdminKey": []
                     }
                 ],
-                "description": "Processes a withdrawal from a player's balance. Each request represents a bet placement action.",
-                "consumes": [
+                "description": "Compares the ledger balance of every player with the wallet and returns the report. Players with transactions in flight are skipped.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Reconcile the ledger with the wallet",
+                "responses": {
+                    "200": {
+                        "description": "Reconciliation report",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ReconciliationRunResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/reconciliations/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminKey": []
+                    }
+                ],
+                "description": "Returns a reconciliation run with every discrepancy it found",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Betting"
+                    "Admin"
                 ],
-                "summary": "Process a bet",
+                "summary": "Get a reconciliation report",
                 "parameters": [
                     {
                         "type": "string",
-                        "default": "Bearer \u003ctoken\u003e",
-                        "description": "Bearer token",
-                        "name": "Authorization",
-                        "in": "header",
+                        "description": "Reconciliation run ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Bet request details",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/shared.WithdrawRequest"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Bet processed successfully",
+                        "description": "Reconciliation report",
                         "schema": {
-                            "$ref": "#/definitions/shared.BetOperationResponse"
+                            "$ref": "#/definitions/shared.ReconciliationRunResponse"
                         }
                     },
                     "400": {
@@ -318,6 +507,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/shared.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Reconciliation run not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -326,27 +521,855 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.Currency": {
-            "type": "string",
-            "enum": [
-                "USD",
-                "EUR",
-                "KES"
-            ],
-            "x-enum-varnames": [
-                "CurrencyUSD",
-                "CurrencyEUR",
-                "CurrencyKES"
-            ]
         },
-        "models.TransactionStatus": {
-            "type": "string",
-            "enum": [
-                "PENDING",
-                "CONFIRMED",
+        "/api/v1/auth": {
+            "post": {
+                "description": "Authenticates a player using username and password, returns a JWT token",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Authenticate player",
+                "parameters": [
+                    {
+                        "description": "Authentication credentials",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.AuthRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Authentication successful",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Reverts a previously processed transaction by reversing its financial impact, or part of it with amount. A rollback of part of a transaction needs its own provider_rollback_id, a retry with the same id replays the first response.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Betting"
+                ],
+                "summary": "Cancel a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the response of a previous request sent with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Cancel request details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/shared.CancelRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transaction cancelled successfully",
+                        "schema": {
+                            "$ref": "#/definitions/shared.BetOperationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Transaction not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The amount exceeds what is left to cancel, the provider rollback id was already used with a different payload, or a request with the same Idempotency-Key is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "The Idempotency-Key was already used with another request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/deposit": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Processes a deposit into a player's account. Represents bet settlement - if amount is zero, bet is LOST; otherwise, bet is WON.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Betting"
+                ],
+                "summary": "Settle a bet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the response of a previous request sent with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Settle request details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/shared.DepositRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Bet settled successfully",
+                        "schema": {
+                            "$ref": "#/definitions/shared.BetOperationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The provider transaction id was already used with a different payload, the round is closed, or a request with the same Idempotency-Key is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "The Idempotency-Key was already used with another request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/player-info": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieves essential player details including user ID, balance, and currency",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Player"
+                ],
+                "summary": "Get player information",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Player information",
+                        "schema": {
+                            "$ref": "#/definitions/shared.PlayerInfoResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/rounds/close": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Closes a game round of the player: later bets and wins reported in the round are refused, cancels are still accepted. Closing a closed round returns it as it is.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Betting"
+                ],
+                "summary": "Close a game round",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the response of a previous request sent with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Round to close",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/shared.CloseRoundRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Round closed",
+                        "schema": {
+                            "$ref": "#/definitions/shared.RoundResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Round not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/rounds/rollback": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Cancels what is left of every bet and win of a game round of the player, oldest first. The cancels are queued and answered pending, a round with nothing left to cancel is answered without any.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Betting"
+                ],
+                "summary": "Roll back a game round",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the response of a previous request sent with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Round to roll back",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/shared.RollbackRoundRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Round rolled back",
+                        "schema": {
+                            "$ref": "#/definitions/shared.RoundRollbackResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Round not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A transaction of the round was cancelled concurrently, or a request with the same Idempotency-Key is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "The Idempotency-Key was already used with another request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transactions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the transaction history of the player, newest first. Pages are fetched with the next_cursor of the previous one.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "List the transactions of the player",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "WITHDRAW",
+                            "DEPOSIT",
+                            "CANCEL"
+                        ],
+                        "type": "string",
+                        "description": "Filter by type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "PENDING",
+                            "PROCESSING",
+                            "CONFIRMED",
+                            "FAILED",
+                            "FINAL"
+                        ],
+                        "type": "string",
+                        "description": "Filter by status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "USD",
+                            "EUR",
+                            "KES"
+                        ],
+                        "type": "string",
+                        "description": "Filter by currency",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by provider round id",
+                        "name": "round_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transactions",
+                        "schema": {
+                            "$ref": "#/definitions/shared.TransactionPageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transactions/by-provider/{provider_transaction_id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the current outcome of a bet, a settlement or an identified rollback of the player from its provider transaction id, see GetTransaction",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "Get the status of a transaction by its provider id",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Provider transaction ID",
+                        "name": "provider_transaction_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transaction",
+                        "schema": {
+                            "$ref": "#/definitions/shared.TransactionStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Transaction not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transactions/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the current outcome of a transaction of the player: its status, how many wallet attempts were made so far, the balances once it is confirmed and why it failed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "Get the status of a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transaction ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transaction",
+                        "schema": {
+                            "$ref": "#/definitions/shared.TransactionStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Transaction not found",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/withdraw": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Processes a withdrawal from a player's balance. Each request represents a bet placement action.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Betting"
+                ],
+                "summary": "Process a bet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "Bearer \u003ctoken\u003e",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the response of a previous request sent with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Bet request details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/shared.WithdrawRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Bet processed successfully",
+                        "schema": {
+                            "$ref": "#/definitions/shared.BetOperationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The provider transaction id was already used with a different payload, the round is closed, or a request with the same Idempotency-Key is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "The Idempotency-Key was already used with another request",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/shared.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.Currency": {
+            "type": "string",
+            "enum": [
+                "USD",
+                "EUR",
+                "KES"
+            ],
+            "x-enum-varnames": [
+                "CurrencyUSD",
+                "CurrencyEUR",
+                "CurrencyKES"
+            ]
+        },
+        "models.DeadLetterStatus": {
+            "type": "string",
+            "enum": [
+                "OPEN",
+                "REQUEUED",
+                "RESOLVED"
+            ],
+            "x-enum-varnames": [
+                "DeadLetterStatusOpen",
+                "DeadLetterStatusRequeued",
+                "DeadLetterStatusResolved"
+            ]
+        },
+        "models.DiscrepancyKind": {
+            "type": "string",
+            "enum": [
+                "BALANCE_MISMATCH",
+                "CURRENCY_MISMATCH"
+            ],
+            "x-enum-varnames": [
+                "DiscrepancyBalanceMismatch",
+                "DiscrepancyCurrencyMismatch"
+            ]
+        },
+        "models.LedgerAccountType": {
+            "type": "string",
+            "enum": [
+                "PLAYER",
+                "HOUSE",
+                "OPENING"
+            ],
+            "x-enum-varnames": [
+                "LedgerAccountPlayer",
+                "LedgerAccountHouse",
+                "LedgerAccountOpening"
+            ]
+        },
+        "models.RoundStatus": {
+            "type": "string",
+            "enum": [
+                "OPEN",
+                "CLOSED"
+            ],
+            "x-enum-varnames": [
+                "RoundStatusOpen",
+                "RoundStatusClosed"
+            ]
+        },
+        "models.TransactionStatus": {
+            "type": "string",
+            "enum": [
+                "PENDING",
+                "CONFIRMED",
                 "FAILED",
                 "FINAL",
                 "PROCESSING"
@@ -359,33 +1382,480 @@ const docTemplate = `{
                 "TransactionStatusProcessing"
             ]
         },
-        "service.AuthRequest": {
+        "models.TransactionType": {
+            "type": "string",
+            "enum": [
+                "WITHDRAW",
+                "DEPOSIT",
+                "CANCEL"
+            ],
+            "x-enum-varnames": [
+                "TransactionTypeWithdraw",
+                "TransactionTypeDeposit",
+                "TransactionTypeCancel"
+            ]
+        },
+        "service.AuthRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "demo123!"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "player_34633089486"
+                }
+            }
+        },
+        "shared.BetOperationResponse": {
+            "type": "object",
+            "properties": {
+                "new_balance": {
+                    "type": "string",
+                    "example": "1000.50"
+                },
+                "old_balance": {
+                    "type": "string",
+                    "example": "1900.50"
+                },
+                "provider_transaction_id": {
+                    "type": "integer",
+                    "example": 12345
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionStatus"
+                        }
+                    ],
+                    "example": "CONFIRMED"
+                },
+                "transaction_id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                }
+            }
+        },
+        "shared.CancelRequest": {
+            "type": "object",
+            "required": [
+                "provider_transaction_id"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "minimum": 0,
+                    "example": 50
+                },
+                "provider_rollback_id": {
+                    "type": "integer",
+                    "example": 12350
+                },
+                "provider_transaction_id": {
+                    "type": "integer",
+                    "example": 12345
+                }
+            }
+        },
+        "shared.CloseRoundRequest": {
+            "type": "object",
+            "required": [
+                "round_id"
+            ],
+            "properties": {
+                "round_id": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "r-98765"
+                }
+            }
+        },
+        "shared.DeadLetterResponse": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "example": 100
+                },
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shared.TransactionAttemptResponse"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "currency": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "last_error_code": {
+                    "type": "string",
+                    "example": "INSUFFICIENT_FUNDS"
+                },
+                "player_id": {
+                    "type": "integer",
+                    "example": 34633089486
+                },
+                "provider_transaction_id": {
+                    "type": "integer",
+                    "example": 12345
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "exceeded max retry attempts"
+                },
+                "resolution": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionStatus"
+                        }
+                    ],
+                    "example": "CONFIRMED"
+                },
+                "resolution_reason": {
+                    "type": "string",
+                    "example": "wallet support confirmed the debit"
+                },
+                "resolved_at": {
+                    "type": "string"
+                },
+                "resolved_by": {
+                    "type": "string",
+                    "example": "jane"
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.DeadLetterStatus"
+                        }
+                    ],
+                    "example": "OPEN"
+                },
+                "transaction_id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "transaction_status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionStatus"
+                        }
+                    ],
+                    "example": "FAILED"
+                },
+                "transaction_type": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionType"
+                        }
+                    ],
+                    "example": "WITHDRAW"
+                }
+            }
+        },
+        "shared.DepositRequest": {
+            "type": "object",
+            "required": [
+                "currency",
+                "provider_transaction_id"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "minimum": 0,
+                    "example": 1000
+                },
+                "bets": {
+                    "type": "array",
+                    "maxItems": 50,
+                    "items": {
+                        "$ref": "#/definitions/shared.SettleBetRequest"
+                    }
+                },
+                "currency": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                },
+                "game_id": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "starburst"
+                },
+                "provider_transaction_id": {
+                    "type": "integer",
+                    "example": 12345
+                },
+                "provider_withdrawn_transaction_id": {
+                    "type": "integer",
+                    "example": 12344
+                },
+                "round_closed": {
+                    "description": "RoundClosed closes the round once the transaction is recorded",
+                    "type": "boolean",
+                    "example": false
+                },
+                "round_id": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "r-98765"
+                }
+            }
+        },
+        "shared.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/shared.errorCode"
+                        }
+                    ],
+                    "example": "Invalid request"
+                },
+                "msg": {
+                    "type": "string",
+                    "example": "Validation failed"
+                }
+            }
+        },
+        "shared.JournalEntryResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "currency": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shared.JournalLineResponse"
+                    }
+                },
+                "transaction_id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "WITHDRAW"
+                }
+            }
+        },
+        "shared.JournalLineResponse": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.LedgerAccountType"
+                        }
+                    ],
+                    "example": "PLAYER"
+                },
+                "credit": {
+                    "type": "number",
+                    "example": 0
+                },
+                "debit": {
+                    "type": "number",
+                    "example": 100
+                }
+            }
+        },
+        "shared.LedgerBalanceResponse": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "number",
+                    "example": 1000.5
+                },
+                "currency": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                }
+            }
+        },
+        "shared.PlayerInfoResponse": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "string",
+                    "example": "1000.50"
+                },
+                "currency": {
+                    "type": "string",
+                    "example": "USD"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "shared.PlayerLedgerResponse": {
             "type": "object",
             "properties": {
-                "password": {
+                "balances": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shared.LedgerBalanceResponse"
+                    }
+                },
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shared.JournalEntryResponse"
+                    }
+                },
+                "player_id": {
+                    "type": "integer",
+                    "example": 34633089486
+                }
+            }
+        },
+        "shared.ReconciliationDiscrepancyResponse": {
+            "type": "object",
+            "properties": {
+                "actual": {
+                    "type": "number",
+                    "example": 990.5
+                },
+                "currency": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                },
+                "difference": {
+                    "description": "Difference is the wallet balance minus the ledger balance",
+                    "type": "number",
+                    "example": -10
+                },
+                "expected": {
+                    "type": "number",
+                    "example": 1000.5
+                },
+                "kind": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.DiscrepancyKind"
+                        }
+                    ],
+                    "example": "BALANCE_MISMATCH"
+                },
+                "player_id": {
+                    "type": "integer",
+                    "example": 34633089486
+                },
+                "wallet_currency": {
                     "type": "string",
-                    "example": "demo123!"
+                    "example": "USD"
+                }
+            }
+        },
+        "shared.ReconciliationRunResponse": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 120
                 },
-                "username": {
+                "discrepancies": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "errors": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
                     "type": "string",
-                    "example": "player_34633089486"
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shared.ReconciliationDiscrepancyResponse"
+                    }
+                },
+                "matched": {
+                    "type": "integer",
+                    "example": 117
+                },
+                "skipped": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "started_at": {
+                    "type": "string"
                 }
             }
         },
-        "shared.BetOperationResponse": {
+        "shared.RequeueDeadLetterRequest": {
             "type": "object",
+            "required": [
+                "reason"
+            ],
             "properties": {
-                "new_balance": {
+                "operator": {
                     "type": "string",
-                    "example": "1000.50"
+                    "example": "jane"
                 },
-                "old_balance": {
+                "reason": {
                     "type": "string",
-                    "example": "1900.50"
+                    "example": "wallet outage is over"
+                }
+            }
+        },
+        "shared.ResolveDeadLetterRequest": {
+            "type": "object",
+            "required": [
+                "reason",
+                "status"
+            ],
+            "properties": {
+                "operator": {
+                    "type": "string",
+                    "example": "jane"
                 },
-                "provider_transaction_id": {
-                    "type": "integer",
-                    "example": 12345
+                "reason": {
+                    "type": "string",
+                    "example": "wallet support confirmed the debit"
                 },
                 "status": {
                     "allOf": [
@@ -394,37 +1864,156 @@ const docTemplate = `{
                         }
                     ],
                     "example": "CONFIRMED"
+                }
+            }
+        },
+        "shared.RollbackRoundRequest": {
+            "type": "object",
+            "required": [
+                "round_id"
+            ],
+            "properties": {
+                "round_id": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "r-98765"
+                }
+            }
+        },
+        "shared.RoundResponse": {
+            "type": "object",
+            "properties": {
+                "closed_at": {
+                    "type": "string"
                 },
-                "transaction_id": {
+                "created_at": {
+                    "type": "string"
+                },
+                "currency": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                },
+                "game_id": {
+                    "type": "string",
+                    "example": "starburst"
+                },
+                "id": {
                     "type": "string",
                     "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "round_id": {
+                    "type": "string",
+                    "example": "r-98765"
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.RoundStatus"
+                        }
+                    ],
+                    "example": "CLOSED"
+                },
+                "total_bet": {
+                    "type": "number",
+                    "example": 10
+                },
+                "total_won": {
+                    "type": "number",
+                    "example": 25
                 }
             }
         },
-        "shared.CancelRequest": {
+        "shared.RoundRollbackResponse": {
             "type": "object",
-            "required": [
-                "provider_transaction_id"
-            ],
             "properties": {
-                "provider_transaction_id": {
-                    "type": "integer",
-                    "example": 12345
+                "cancels": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shared.BetOperationResponse"
+                    }
+                },
+                "round_id": {
+                    "type": "string",
+                    "example": "r-98765"
                 }
             }
         },
-        "shared.DepositRequest": {
+        "shared.SettleBetRequest": {
             "type": "object",
             "required": [
-                "currency",
-                "provider_transaction_id",
                 "provider_withdrawn_transaction_id"
             ],
             "properties": {
                 "amount": {
                     "type": "number",
                     "minimum": 0,
-                    "example": 1000
+                    "example": 500
+                },
+                "provider_withdrawn_transaction_id": {
+                    "type": "integer",
+                    "example": 12344
+                }
+            }
+        },
+        "shared.TransactionAttemptResponse": {
+            "type": "object",
+            "properties": {
+                "attempted_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "error_code": {
+                    "type": "string",
+                    "example": "SERVICE_UNAVAILABLE"
+                },
+                "operation": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionType"
+                        }
+                    ],
+                    "example": "WITHDRAW"
+                },
+                "payload": {
+                    "type": "object"
+                }
+            }
+        },
+        "shared.TransactionPageResponse": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "description": "NextCursor fetches the next page, it is empty on the last one",
+                    "type": "string",
+                    "example": "MTc2MDc3ODU2MzUzNzA4MzAwMF8zYzcwZGQ4MS04OGQ5LTRjNzgtODg2Mi05Y2ZlZWJjZDA2ODg"
+                },
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shared.TransactionResponse"
+                    }
+                }
+            }
+        },
+        "shared.TransactionResponse": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "example": 100
+                },
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "created_at": {
+                    "type": "string"
                 },
                 "currency": {
                     "allOf": [
@@ -434,47 +2023,121 @@ const docTemplate = `{
                     ],
                     "example": "USD"
                 },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
                 "provider_transaction_id": {
                     "type": "integer",
                     "example": 12345
                 },
                 "provider_withdrawn_transaction_id": {
+                    "description": "ProviderWithdrawnTransactionID is the bet a settlement settles, or the\ntransaction a cancel reverses",
                     "type": "integer",
                     "example": 12344
+                },
+                "refunded": {
+                    "type": "number",
+                    "example": 50
+                },
+                "round_id": {
+                    "type": "string",
+                    "example": "r-98765"
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionStatus"
+                        }
+                    ],
+                    "example": "CONFIRMED"
+                },
+                "type": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionType"
+                        }
+                    ],
+                    "example": "WITHDRAW"
                 }
             }
         },
-        "shared.ErrorResponse": {
+        "shared.TransactionStatusResponse": {
             "type": "object",
             "properties": {
-                "code": {
+                "amount": {
+                    "type": "number",
+                    "example": 100
+                },
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "currency": {
                     "allOf": [
                         {
-                            "$ref": "#/definitions/shared.errorCode"
+                            "$ref": "#/definitions/models.Currency"
                         }
                     ],
-                    "example": "Invalid request"
+                    "example": "USD"
                 },
-                "msg": {
+                "failure_reason": {
+                    "description": "FailureReason tells why a failed transaction was given up on",
                     "type": "string",
-                    "example": "Validation failed"
-                }
-            }
-        },
-        "shared.PlayerInfoResponse": {
-            "type": "object",
-            "properties": {
-                "balance": {
+                    "example": "exceeded max retry attempts (5)"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "last_error_code": {
+                    "type": "string",
+                    "example": "INSUFFICIENT_FUNDS"
+                },
+                "new_balance": {
                     "type": "string",
                     "example": "1000.50"
                 },
-                "currency": {
+                "old_balance": {
+                    "description": "OldBalance and NewBalance are the wallet balances around the\ntransaction, once it is confirmed",
                     "type": "string",
-                    "example": "USD"
+                    "example": "1900.50"
                 },
-                "user_id": {
+                "provider_transaction_id": {
                     "type": "integer",
-                    "example": 1
+                    "example": 12345
+                },
+                "provider_withdrawn_transaction_id": {
+                    "description": "ProviderWithdrawnTransactionID is the bet a settlement settles, or the\ntransaction a cancel reverses",
+                    "type": "integer",
+                    "example": 12344
+                },
+                "refunded": {
+                    "type": "number",
+                    "example": 50
+                },
+                "round_id": {
+                    "type": "string",
+                    "example": "r-98765"
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionStatus"
+                        }
+                    ],
+                    "example": "CONFIRMED"
+                },
+                "type": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.TransactionType"
+                        }
+                    ],
+                    "example": "WITHDRAW"
                 }
             }
         },
@@ -498,9 +2161,24 @@ const docTemplate = `{
                     ],
                     "example": "USD"
                 },
+                "game_id": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "starburst"
+                },
                 "provider_transaction_id": {
                     "type": "integer",
                     "example": 12345
+                },
+                "round_closed": {
+                    "description": "RoundClosed closes the round once the transaction is recorded",
+                    "type": "boolean",
+                    "example": false
+                },
+                "round_id": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "r-98765"
                 }
             }
         },
@@ -510,17 +2188,37 @@ const docTemplate = `{
                 "REQUEST_VALIDATION_ERROR",
                 "SERVICE_UNAVAILABLE",
                 "INTERNAL_SERVER_ERROR",
-                "UNAUTHORIZED"
+                "UNAUTHORIZED",
+                "NOT_FOUND",
+                "CONFLICT",
+                "TRANSACTION_MISMATCH",
+                "ROUND_CLOSED",
+                "REFUND_EXCEEDED",
+                "IDEMPOTENCY_KEY_IN_USE",
+                "IDEMPOTENCY_KEY_MISMATCH"
             ],
             "x-enum-varnames": [
                 "ValidationError",
                 "ServiceUnAvailable",
                 "InternalServerError",
-                "Unauthorized"
+                "Unauthorized",
+                "NotFound",
+                "Conflict",
+                "TransactionMismatch",
+                "RoundClosed",
+                "RefundExceeded",
+                "IdempotencyKeyInUse",
+                "IdempotencyKeyMismatch"
             ]
         }
     },
     "securityDefinitions": {
+        "AdminKey": {
+            "description": "Operator key (ADMIN_API_KEY).",
+            "type": "apiKey",
+            "name": "x-admin-key",
+            "in": "header"
+        },
         "BearerAuth": {
             "description": "Type \"Bearer\" followed by a space and JWT token.",
             "type": "apiKey",
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,9 +15,87 @@ func init() {
 
 	Config.JWT_SECRET = getDefaultEnv("JWT_SECRET", "naUsB1EQS9U")
 
+	// Admin endpoints are disabled when no key is set
+	Config.ADMIN_API_KEY = getDefaultEnv("ADMIN_API_KEY", "")
+
 	Config.WALLET_API_KEY = getDefaultEnv("WALLET_API_KEY", "naUsB1EQS9U")
 	Config.WALLET_API_URL = getDefaultEnv("WALLET_API_URL", "http://locahost:8000")
 
+	// Use the in-memory wallet instead of the remote wallet API
+	walletFake, err := strconv.ParseBool(getDefaultEnv("WALLET_FAKE", "false"))
+	if err != nil {
+		walletFake = false
+	}
+	Config.WALLET_FAKE = walletFake
+
+	// Balance lookups and money-moving calls have separate deadlines
+	Config.WALLET_BALANCE_CONNECT_TIMEOUT = getDefaultDuration("WALLET_BALANCE_CONNECT_TIMEOUT", 2*time.Second)
+	Config.WALLET_BALANCE_READ_TIMEOUT = getDefaultDuration("WALLET_BALANCE_READ_TIMEOUT", 3*time.Second)
+	Config.WALLET_OPERATION_CONNECT_TIMEOUT = getDefaultDuration("WALLET_OPERATION_CONNECT_TIMEOUT", 2*time.Second)
+	Config.WALLET_OPERATION_READ_TIMEOUT = getDefaultDuration("WALLET_OPERATION_READ_TIMEOUT", 10*time.Second)
+
+	// Circuit breaker around wallet calls
+	breakerThreshold, err := strconv.Atoi(getDefaultEnv("WALLET_BREAKER_FAILURE_THRESHOLD", "5"))
+	if err != nil || breakerThreshold <= 0 {
+		breakerThreshold = 5
+	}
+	Config.WALLET_BREAKER_FAILURE_THRESHOLD = breakerThreshold
+	Config.WALLET_BREAKER_OPEN_TIMEOUT = getDefaultDuration("WALLET_BREAKER_OPEN_TIMEOUT", 30*time.Second)
+	breakerProbes, err := strconv.Atoi(getDefaultEnv("WALLET_BREAKER_HALF_OPEN_PROBES", "1"))
+	if err != nil || breakerProbes <= 0 {
+		breakerProbes = 1
+	}
+	Config.WALLET_BREAKER_HALF_OPEN_PROBES = breakerProbes
+
+	// How long bets, settlements and cancels wait for the dispatcher to deliver
+	// their wallet command before answering with a pending transaction, 0
+	// answers right away
+	dispatchWait, err := time.ParseDuration(getDefaultEnv("WALLET_DISPATCH_WAIT", "3s"))
+	if err != nil || dispatchWait < 0 {
+		dispatchWait = 3 * time.Second
+	}
+	Config.WALLET_DISPATCH_WAIT = dispatchWait
+
+	// Pending transaction workers
+	workerCount, err := strconv.Atoi(getDefaultEnv("WORKER_COUNT", "4"))
+	if err != nil || workerCount <= 0 {
+		workerCount = 4
+	}
+	Config.WORKER_COUNT = workerCount
+	Config.WORKER_TICK_INTERVAL = getDefaultDuration("WORKER_TICK_INTERVAL", 30*time.Second)
+	Config.WORKER_TRANSACTION_DELAY = getDefaultDuration("WORKER_TRANSACTION_DELAY", 1*time.Second)
+	batchSize, err := strconv.Atoi(getDefaultEnv("WORKER_BATCH_SIZE", "20"))
+	if err != nil || batchSize <= 0 {
+		batchSize = 20
+	}
+	Config.WORKER_BATCH_SIZE = batchSize
+
+	// Claimed transactions are recovered by the sweeper once the lease
+	// expires, e.g. when the replica holding them crashed. WORKER_ID must be
+	// unique per replica.
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+	Config.WORKER_ID = getDefaultEnv("WORKER_ID", hostname)
+	Config.WORKER_LEASE_DURATION = getDefaultDuration("WORKER_LEASE_DURATION", 2*time.Minute)
+	Config.SWEEPER_INTERVAL = getDefaultDuration("SWEEPER_INTERVAL", 1*time.Minute)
+
+	// Responses of the requests sent with an Idempotency-Key header are
+	// replayed until the key expires
+	Config.IDEMPOTENCY_KEY_TTL = getDefaultDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+
+	// Periodic ledger reconciliation with the wallet, disabled when unset
+	Config.RECONCILIATION_INTERVAL = getDefaultDuration("RECONCILIATION_INTERVAL", 0)
+
+	// Retry policies per transaction type. Cancels give money back to the
+	// player so they are retried longer than bets.
+	Config.RETRY_POLICIES = map[string]RetryPolicy{
+		"WITHDRAW": getRetryPolicy("RETRY_WITHDRAW", RetryPolicy{MaxAttempts: 3, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute}),
+		"DEPOSIT":  getRetryPolicy("RETRY_DEPOSIT", RetryPolicy{MaxAttempts: 10, BaseDelay: 5 * time.Second, MaxDelay: 10 * time.Minute}),
+		"CANCEL":   getRetryPolicy("RETRY_CANCEL", RetryPolicy{MaxAttempts: 20, BaseDelay: 10 * time.Second, MaxDelay: 30 * time.Minute}),
+	}
+
 	mode := getDefaultEnv("MODE", "dev")
 	if mode == "production" {
 		Config.MODE = ModeProduction
@@ -63,10 +142,46 @@ var Config struct {
 	DATABASE_URL   string
 	WALLET_API_URL string
 	WALLET_API_KEY string
+	WALLET_FAKE    bool
 	JWT_SECRET     string
+	ADMIN_API_KEY  string
 	MODE           ModeType
 	DB_MAX_OPEN    int
 	DB_MAX_IDLE    int
+
+	WALLET_BALANCE_CONNECT_TIMEOUT   time.Duration
+	WALLET_BALANCE_READ_TIMEOUT      time.Duration
+	WALLET_OPERATION_CONNECT_TIMEOUT time.Duration
+	WALLET_OPERATION_READ_TIMEOUT    time.Duration
+
+	WALLET_BREAKER_FAILURE_THRESHOLD int
+	WALLET_BREAKER_OPEN_TIMEOUT      time.Duration
+	WALLET_BREAKER_HALF_OPEN_PROBES  int
+
+	WALLET_DISPATCH_WAIT time.Duration
+
+	WORKER_COUNT             int
+	WORKER_TICK_INTERVAL     time.Duration
+	WORKER_TRANSACTION_DELAY time.Duration
+	WORKER_BATCH_SIZE        int
+	WORKER_ID                string
+	WORKER_LEASE_DURATION    time.Duration
+	SWEEPER_INTERVAL         time.Duration
+
+	RECONCILIATION_INTERVAL time.Duration
+	IDEMPOTENCY_KEY_TTL     time.Duration
+
+	// RETRY_POLICIES is keyed by transaction type
+	RETRY_POLICIES map[string]RetryPolicy
+}
+
+// RetryPolicy configures how a pending transaction is retried: the delay
+// doubles after each failed attempt, from BaseDelay up to MaxDelay, until
+// MaxAttempts is reached.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
 }
 
 func getDefaultEnv(name, defaultValue string) string {
@@ -76,6 +191,33 @@ func getDefaultEnv(name, defaultValue string) string {
 	return defaultValue
 }
 
+// getDefaultDuration parses a duration such as "1.5s" or "300ms", falling back
+// to defaultValue when the variable is unset or invalid.
+func getDefaultDuration(name string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getDefaultEnv(name, defaultValue.String()))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getRetryPolicy reads <prefix>_MAX_ATTEMPTS, <prefix>_BASE_DELAY and
+// <prefix>_MAX_DELAY, falling back to defaultValue for each of them.
+func getRetryPolicy(prefix string, defaultValue RetryPolicy) RetryPolicy {
+	policy := RetryPolicy{
+		BaseDelay: getDefaultDuration(prefix+"_BASE_DELAY", defaultValue.BaseDelay),
+		MaxDelay:  getDefaultDuration(prefix+"_MAX_DELAY", defaultValue.MaxDelay),
+	}
+
+	maxAttempts, err := strconv.Atoi(getDefaultEnv(prefix+"_MAX_ATTEMPTS", strconv.Itoa(defaultValue.MaxAttempts)))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = defaultValue.MaxAttempts
+	}
+	policy.MaxAttempts = maxAttempts
+
+	return policy
+}
+
 func loadDotenv() {
 	path, err := os.Getwd()
 	if err != nil {
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+type DeadLetterStatus string
+
+const (
+	DeadLetterStatusOpen     DeadLetterStatus = "OPEN"
+	DeadLetterStatusRequeued DeadLetterStatus = "REQUEUED"
+	DeadLetterStatusResolved DeadLetterStatus = "RESOLVED"
+)
+
+// DeadLetter records a transaction the worker gave up on. It stays OPEN until
+// an operator re-queues the transaction or forces its final status.
+type DeadLetter struct {
+	bun.BaseModel `bun:"table:dead_letters,alias:dl"`
+
+	ID               uuid.UUID    `bun:",pk,type:uuid,default:uuid_generate_v4()"`
+	Transaction      *Transaction `bun:"rel:belongs-to,join:transaction_id=id"`
+	TransactionID    uuid.UUID    `bun:"transaction_id,type:uuid"`
+	PlayerID         uint64
+	Reason           string
+	LastErrorCode    string `bun:"last_error_code,nullzero"`
+	Status           DeadLetterStatus
+	Resolution       TransactionStatus `bun:"resolution,nullzero"`
+	ResolutionReason string            `bun:"resolution_reason,nullzero"`
+	ResolvedBy       string            `bun:"resolved_by,nullzero"`
+	CreatedAt        time.Time         `bun:"created_at,nullzero"`
+	ResolvedAt       time.Time         `bun:"resolved_at,nullzero"`
+
+	Attempts []*TransactionAttempt `bun:"rel:has-many,join:transaction_id=transaction_id"`
+}
+
+// TransactionAttempt is one wallet call made for a transaction
+type TransactionAttempt struct {
+	bun.BaseModel `bun:"table:transaction_attempts,alias:ta"`
+
+	ID            uint64          `bun:",pk,autoincrement"`
+	TransactionID uuid.UUID       `bun:"transaction_id,type:uuid"`
+	Operation     TransactionType `bun:"operation"`
+	Payload       json.RawMessage `bun:"payload,type:jsonb"`
+	ErrorCode     string          `bun:"error_code,nullzero"`
+	Error         string          `bun:"error,nullzero"`
+	AttemptedAt   time.Time       `bun:"attempted_at,nullzero"`
+}
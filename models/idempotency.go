@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type IdempotencyKeyStatus string
+
+const (
+	IdempotencyKeyStatusInProgress IdempotencyKeyStatus = "IN_PROGRESS"
+	IdempotencyKeyStatusCompleted  IdempotencyKeyStatus = "COMPLETED"
+)
+
+// IdempotencyKey is a request a player sent with an Idempotency-Key header.
+// It is IN_PROGRESS while the request is handled, then COMPLETED with the
+// response replayed to the retries of the request until it expires.
+type IdempotencyKey struct {
+	bun.BaseModel `bun:"table:idempotency_keys,alias:ik"`
+
+	PlayerID uint64 `bun:"player_id,pk"`
+	Key      string `bun:"key,pk"`
+	// RequestHash identifies the method, path and body of the request
+	RequestHash    string               `bun:"request_hash"`
+	Status         IdempotencyKeyStatus `bun:"status"`
+	ResponseStatus int                  `bun:"response_status,nullzero"`
+	ResponseBody   []byte               `bun:"response_body,nullzero"`
+	CreatedAt      time.Time            `bun:"created_at,nullzero"`
+	ExpiresAt      time.Time            `bun:"expires_at"`
+}
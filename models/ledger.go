@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+type LedgerAccountType string
+
+const (
+	// LedgerAccountPlayer is the money the house owes a player, it is
+	// credited when the player's balance grows
+	LedgerAccountPlayer LedgerAccountType = "PLAYER"
+	// LedgerAccountHouse is the counterpart of bets, wins and cancels
+	LedgerAccountHouse LedgerAccountType = "HOUSE"
+	// LedgerAccountOpening is the counterpart of the opening balances of
+	// player accounts, the money players had before their first movement
+	LedgerAccountOpening LedgerAccountType = "OPENING"
+)
+
+// JournalEntryOpening is the type of the entry opening a player account, the
+// other entries have the type of their transaction
+const JournalEntryOpening = "OPENING"
+
+var ErrUnbalancedEntry = errors.New("journal entry debits and credits do not balance")
+
+// LedgerAccount is an account of the ledger. There is one player account per
+// player and currency, house and opening accounts are per currency only and
+// have no player.
+type LedgerAccount struct {
+	bun.BaseModel `bun:"table:ledger_accounts,alias:la"`
+
+	ID        uint64            `bun:",pk,autoincrement"`
+	Type      LedgerAccountType `bun:"type"`
+	PlayerID  uint64            `bun:"player_id"`
+	Currency  Currency          `bun:"currency"`
+	CreatedAt time.Time         `bun:"created_at,nullzero"`
+	// OpenedAt is when a player account got its opening balance. An account
+	// created by a movement stays unopened until the wallet balance is read.
+	OpenedAt time.Time `bun:"opened_at,nullzero"`
+}
+
+// JournalEntry is an append-only record of a money movement. Its lines always
+// balance: the sum of their debits equals the sum of their credits.
+type JournalEntry struct {
+	bun.BaseModel `bun:"table:journal_entries,alias:je"`
+
+	ID            uuid.UUID `bun:",pk,type:uuid,default:uuid_generate_v4()"`
+	TransactionID uuid.UUID `bun:"transaction_id,type:uuid,nullzero"`
+	PlayerID      uint64    `bun:"player_id"`
+	Currency      Currency  `bun:"currency"`
+	Type          string    `bun:"type"`
+	CreatedAt     time.Time `bun:"created_at,nullzero"`
+
+	Lines []*JournalLine `bun:"rel:has-many,join:id=entry_id"`
+}
+
+// JournalLine debits or credits one account. Account identifies the account
+// by type, player and currency until the entry is posted and AccountID is set.
+type JournalLine struct {
+	bun.BaseModel `bun:"table:journal_lines,alias:jl"`
+
+	ID        uint64         `bun:",pk,autoincrement"`
+	EntryID   uuid.UUID      `bun:"entry_id,type:uuid"`
+	AccountID uint64         `bun:"account_id"`
+	Account   *LedgerAccount `bun:"rel:belongs-to,join:account_id=id"`
+	Debit     Amount         `bun:"debit"`
+	Credit    Amount         `bun:"credit"`
+}
+
+// Validate checks that every line moves a positive amount on a single side
+// and that the entry balances
+func (e *JournalEntry) Validate() error {
+	var debits, credits Amount
+	for _, line := range e.Lines {
+		if line.Debit < 0 || line.Credit < 0 || (line.Debit == 0) == (line.Credit == 0) {
+			return fmt.Errorf("%w: a line should either debit or credit a positive amount", ErrUnbalancedEntry)
+		}
+		debits += line.Debit
+		credits += line.Credit
+	}
+	if len(e.Lines) == 0 || debits != credits {
+		return ErrUnbalancedEntry
+	}
+	return nil
+}
+
+// NewOpeningJournalEntry opens the account of a player with the balance it
+// had before the ledger recorded its movements. It returns nil for a zero
+// balance.
+func NewOpeningJournalEntry(playerID uint64, currency Currency, balance Amount) *JournalEntry {
+	if balance == 0 {
+		return nil
+	}
+
+	entry := &JournalEntry{
+		PlayerID: playerID,
+		Currency: currency,
+		Type:     JournalEntryOpening,
+	}
+	player := &LedgerAccount{Type: LedgerAccountPlayer, PlayerID: playerID, Currency: currency}
+	opening := &LedgerAccount{Type: LedgerAccountOpening, Currency: currency}
+	if balance > 0 {
+		entry.Lines = transfer(opening, player, balance)
+	} else {
+		entry.Lines = transfer(player, opening, -balance)
+	}
+	return entry
+}
+
+// NewTransactionJournalEntry records a confirmed transaction. A bet moves
+// money from the player to the house, a win from the house to the player and
+// a cancel reverses original, the transaction it cancels. It returns nil for
+// a zero amount, e.g. a lost bet.
+func NewTransactionJournalEntry(tx *Transaction, original *Transaction) (*JournalEntry, error) {
+	if tx.Amount < 0 {
+		return nil, fmt.Errorf("transaction %s has a negative amount", tx.ID)
+	}
+	if tx.Amount == 0 {
+		return nil, nil
+	}
+
+	entry := &JournalEntry{
+		TransactionID: tx.ID,
+		PlayerID:      tx.PlayerID,
+		Currency:      tx.Currency,
+		Type:          string(tx.Type),
+	}
+	player := &LedgerAccount{Type: LedgerAccountPlayer, PlayerID: tx.PlayerID, Currency: tx.Currency}
+	house := &LedgerAccount{Type: LedgerAccountHouse, Currency: tx.Currency}
+
+	op := tx.Type
+	if tx.Type == TransactionTypeCancel {
+		if original == nil {
+			return nil, fmt.Errorf("cancel %s has no original transaction", tx.ID)
+		}
+		switch original.Type {
+		case TransactionTypeWithdraw:
+			op = TransactionTypeDeposit
+		case TransactionTypeDeposit:
+			op = TransactionTypeWithdraw
+		default:
+			return nil, fmt.Errorf("cancel %s cancels a %s", tx.ID, original.Type)
+		}
+	}
+
+	switch op {
+	case TransactionTypeWithdraw:
+		entry.Lines = transfer(player, house, tx.Amount)
+	case TransactionTypeDeposit:
+		entry.Lines = transfer(house, player, tx.Amount)
+	default:
+		return nil, fmt.Errorf("unknown transaction type %q", tx.Type)
+	}
+	return entry, nil
+}
+
+// transfer debits from and credits to with amount
+func transfer(from, to *LedgerAccount, amount Amount) []*JournalLine {
+	return []*JournalLine{
+		{Account: from, Debit: amount},
+		{Account: to, Credit: amount},
+	}
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AmountScale is the number of decimals an Amount keeps. It covers the minor
+// units of every supported currency.
+const AmountScale = 4
+
+const amountFactor = 10000 // 10^AmountScale
+
+var (
+	ErrInvalidAmount  = errors.New("invalid amount")
+	ErrAmountScale    = errors.New("amount has too many decimals")
+	ErrAmountOverflow = errors.New("amount is too large")
+)
+
+// currencyMinorUnits is the number of decimals of each supported currency
+var currencyMinorUnits = map[Currency]int{
+	CurrencyUSD: 2,
+	CurrencyEUR: 2,
+	CurrencyKES: 2,
+}
+
+// MinorUnits returns the number of decimals of the currency, false when the
+// currency is not supported
+func (c Currency) MinorUnits() (int, bool) {
+	units, ok := currencyMinorUnits[c]
+	return units, ok
+}
+
+// Amount is an exact decimal amount of money, stored as an integer number of
+// 10^-AmountScale units so amounts are compared and summed without the
+// rounding errors of float64. It is a JSON number and a NUMERIC in the db.
+type Amount int64
+
+// NewAmount returns an amount of whole currency units, e.g. NewAmount(10) is 10.00
+func NewAmount(whole int64) Amount {
+	return Amount(whole * amountFactor)
+}
+
+// ParseAmount parses a decimal such as "100", "-0.5" or "1000.25". Exponents
+// and more than AmountScale decimals are refused.
+func ParseAmount(s string) (Amount, error) {
+	value := s
+	negative := false
+	switch {
+	case strings.HasPrefix(value, "-"):
+		negative = true
+		value = value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(value, ".")
+	if whole == "" && frac == "" || hasFrac && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > AmountScale {
+		return 0, fmt.Errorf("%w: %q", ErrAmountScale, s)
+	}
+
+	var units uint64
+	if whole != "" {
+		w, err := strconv.ParseUint(whole, 10, 64)
+		if err != nil || w > math.MaxInt64/amountFactor {
+			return 0, fmt.Errorf("%w: %q", ErrAmountOverflow, s)
+		}
+		units = w * amountFactor
+	}
+	if frac != "" {
+		f, _ := strconv.ParseUint(frac+strings.Repeat("0", AmountScale-len(frac)), 10, 64)
+		units += f
+	}
+	// The smallest amount has no positive counterpart
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++
+	}
+	if units > limit {
+		return 0, fmt.Errorf("%w: %q", ErrAmountOverflow, s)
+	}
+
+	if negative {
+		return Amount(-int64(units)), nil
+	}
+	return Amount(units), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimals returns the number of significant decimals of the amount
+func (a Amount) Decimals() int {
+	frac := int64(a) % amountFactor
+	if frac == 0 {
+		return 0
+	}
+	decimals := AmountScale
+	for frac%10 == 0 {
+		frac /= 10
+		decimals--
+	}
+	return decimals
+}
+
+// FitsCurrency reports whether the amount has no more decimals than the
+// minor units of currency
+func (a Amount) FitsCurrency(currency Currency) bool {
+	units, ok := currency.MinorUnits()
+	return ok && a.Decimals() <= units
+}
+
+// String formats the amount with at least two decimals, e.g. "100.00" or "0.1234"
+func (a Amount) String() string {
+	units := int64(a)
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+	// Negating math.MinInt64 overflows, go through uint64
+	abs := uint64(units)
+	if units < 0 {
+		abs = uint64(-(units + 1)) + 1
+	}
+
+	frac := fmt.Sprintf("%0*d", AmountScale, abs%amountFactor)
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) < 2 {
+		frac += strings.Repeat("0", 2-len(frac))
+	}
+	return fmt.Sprintf("%s%d.%s", sign, abs/amountFactor, frac)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding a decimal
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	amount, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		return a.UnmarshalText(v)
+	case string:
+		return a.UnmarshalText([]byte(v))
+	case int64:
+		if v > math.MaxInt64/amountFactor || v < math.MinInt64/amountFactor {
+			return ErrAmountOverflow
+		}
+		*a = Amount(v * amountFactor)
+		return nil
+	}
+	return fmt.Errorf("%w: can not scan %T", ErrInvalidAmount, src)
+}
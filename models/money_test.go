@@ -0,0 +1,142 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr error
+	}{
+		{in: "100", want: NewAmount(100)},
+		{in: "0", want: 0},
+		{in: "-0", want: 0},
+		{in: "0.5", want: 5000},
+		{in: ".5", want: 5000},
+		{in: "+1", want: NewAmount(1)},
+		{in: "1000.25", want: 10002500},
+		{in: "1.2345", want: 12345},
+		{in: "0.0001", want: 1},
+		{in: "-0.5", want: -5000},
+		{in: "-1000.25", want: -10002500},
+
+		// Trailing zeros past the scale don't round anything
+		{in: "1.234500", want: 12345},
+		{in: "1.23456", wantErr: ErrAmountScale},
+		{in: "0.00001", wantErr: ErrAmountScale},
+		{in: "-1.23451", wantErr: ErrAmountScale},
+
+		{in: "922337203685477", want: NewAmount(922337203685477)},
+		{in: "922337203685477.5807", want: math.MaxInt64},
+		{in: "922337203685477.5808", wantErr: ErrAmountOverflow},
+		{in: "-922337203685477.5808", want: math.MinInt64},
+		{in: "-922337203685477.5809", wantErr: ErrAmountOverflow},
+		{in: "922337203685478", wantErr: ErrAmountOverflow},
+		{in: "99999999999999999999", wantErr: ErrAmountOverflow},
+
+		{in: "", wantErr: ErrInvalidAmount},
+		{in: "-", wantErr: ErrInvalidAmount},
+		{in: ".", wantErr: ErrInvalidAmount},
+		{in: "1.", wantErr: ErrInvalidAmount},
+		{in: "1e3", wantErr: ErrInvalidAmount},
+		{in: "1,5", wantErr: ErrInvalidAmount},
+		{in: "--1", wantErr: ErrInvalidAmount},
+		{in: " 1", wantErr: ErrInvalidAmount},
+		{in: "0x10", wantErr: ErrInvalidAmount},
+		{in: "NaN", wantErr: ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseAmount(tt.in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseAmount(%q) = %d, %v, want %v", tt.in, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseAmount(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.00"},
+		{NewAmount(100), "100.00"},
+		{5000, "0.50"},
+		{12345, "1.2345"},
+		{10002500, "1000.25"},
+		{1, "0.0001"},
+		{-5000, "-0.50"},
+		{-1, "-0.0001"},
+		{math.MaxInt64, "922337203685477.5807"},
+		{math.MinInt64, "-922337203685477.5808"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestAmountRoundTrip(t *testing.T) {
+	amounts := []Amount{0, 1, -1, 5000, -5000, 12345, NewAmount(1000), math.MaxInt64, math.MinInt64 + 1, math.MinInt64}
+	for _, amount := range amounts {
+		parsed, err := ParseAmount(amount.String())
+		if err != nil || parsed != amount {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", amount.String(), parsed, err, amount)
+		}
+
+		data, err := json.Marshal(amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Amount
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != amount {
+			t.Errorf("json round trip of %s = %d, %v", data, decoded, err)
+		}
+	}
+}
+
+func TestAmountUnmarshalJSON(t *testing.T) {
+	var amount Amount
+	if err := json.Unmarshal([]byte(`"10.5"`), &amount); err != nil || amount != 105000 {
+		t.Errorf("string amount = %d, %v, want 105000", amount, err)
+	}
+	if err := json.Unmarshal([]byte(`1e3`), &amount); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("exponent amount: got %v, want %v", err, ErrInvalidAmount)
+	}
+	if err := json.Unmarshal([]byte(`0.123456`), &amount); !errors.Is(err, ErrAmountScale) {
+		t.Errorf("amount past the scale: got %v, want %v", err, ErrAmountScale)
+	}
+}
+
+func TestAmountFitsCurrency(t *testing.T) {
+	tests := []struct {
+		amount   Amount
+		currency Currency
+		want     bool
+	}{
+		{NewAmount(10), CurrencyUSD, true},
+		{100, CurrencyUSD, true},  // 0.01
+		{10, CurrencyUSD, false},  // 0.001
+		{-100, CurrencyEUR, true}, // -0.01
+		{-10, CurrencyKES, false}, // -0.001
+		{NewAmount(1), "GBP", false},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.FitsCurrency(tt.currency); got != tt.want {
+			t.Errorf("%s fits %s = %t, want %t", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
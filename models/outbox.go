@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// WalletCommand is the wallet operation a transaction stands for. It is
+// written to the outbox in the db transaction that creates the transaction,
+// then delivered by the dispatcher (the pending transaction worker). The
+// wallet deduplicates the reference, so a command delivered again after a
+// crash or a timeout is only applied once.
+type WalletCommand struct {
+	bun.BaseModel `bun:"table:wallet_commands,alias:wc"`
+
+	ID            uuid.UUID `bun:",pk,type:uuid,default:uuid_generate_v4()"`
+	TransactionID uuid.UUID `bun:"transaction_id,type:uuid"`
+	PlayerID      uint64    `bun:"player_id"`
+	// Operation is WITHDRAW or DEPOSIT, a cancel reverses its original transaction
+	Operation TransactionType `bun:"operation"`
+	Currency  Currency        `bun:"currency"`
+	Amount    Amount          `bun:"amount"`
+	BetID     uint64          `bun:"bet_id"`
+	Reference string          `bun:"reference"`
+	// Balance is the wallet balance reported when the command was delivered
+	Balance     string    `bun:"balance,nullzero"`
+	DeliveredAt time.Time `bun:"delivered_at,nullzero"`
+	CreatedAt   time.Time `bun:"created_at,nullzero"`
+}
+
+// SettlementBet is one of the bets settled by a settlement of several bets,
+// with the amount won on it. The amount of the settlement is their sum.
+type SettlementBet struct {
+	bun.BaseModel `bun:"table:settlement_bets,alias:sb"`
+
+	TransactionID uuid.UUID `bun:"transaction_id,pk,type:uuid"`
+	BetProviderID uint64    `bun:"bet_provider_id,pk"`
+	Amount        Amount    `bun:"amount"`
+}
+
+// NewWalletCommands returns the wallet commands of a transaction, original
+// being the transaction a cancel reverses and bets the bets of a settlement
+// of several bets. A settlement of several bets gets a command per bet won,
+// any other transaction a single command. No command is returned when the
+// wallet has nothing to do, i.e. lost bets settled with a zero amount.
+func NewWalletCommands(tx *Transaction, original *Transaction, bets []*SettlementBet) ([]*WalletCommand, error) {
+	if tx.Type != TransactionTypeDeposit || len(bets) == 0 {
+		command, err := NewWalletCommand(tx, original)
+		if err != nil || command == nil {
+			return nil, err
+		}
+		return []*WalletCommand{command}, nil
+	}
+
+	var commands []*WalletCommand
+	for _, bet := range bets {
+		if bet.Amount < 0 {
+			return nil, fmt.Errorf("transaction %s has a negative amount for bet %d", tx.ID, bet.BetProviderID)
+		}
+		if bet.Amount == 0 {
+			continue
+		}
+		commands = append(commands, &WalletCommand{
+			TransactionID: tx.ID,
+			PlayerID:      tx.PlayerID,
+			Operation:     TransactionTypeDeposit,
+			Currency:      tx.Currency,
+			Amount:        bet.Amount,
+			BetID:         bet.BetProviderID,
+			Reference:     fmt.Sprintf("%s-%d", tx.ID, bet.BetProviderID),
+		})
+	}
+	return commands, nil
+}
+
+// NewWalletCommand returns the wallet command of a transaction, original
+// being the transaction a cancel reverses. It returns nil when the wallet has
+// nothing to do, i.e. a lost bet settled with a zero amount.
+func NewWalletCommand(tx *Transaction, original *Transaction) (*WalletCommand, error) {
+	if tx.Amount < 0 {
+		return nil, fmt.Errorf("transaction %s has a negative amount", tx.ID)
+	}
+
+	command := &WalletCommand{
+		TransactionID: tx.ID,
+		PlayerID:      tx.PlayerID,
+		Currency:      tx.Currency,
+		Amount:        tx.Amount,
+		Reference:     tx.ID.String(),
+	}
+
+	switch tx.Type {
+	case TransactionTypeWithdraw:
+		command.Operation = TransactionTypeWithdraw
+		command.BetID = tx.ProviderID
+	case TransactionTypeDeposit:
+		if tx.Amount == 0 {
+			return nil, nil
+		}
+		command.Operation = TransactionTypeDeposit
+		command.BetID = tx.WithdrawProviderID
+	case TransactionTypeCancel:
+		if original == nil {
+			return nil, fmt.Errorf("cancel %s has no original transaction", tx.ID)
+		}
+		switch original.Type {
+		case TransactionTypeWithdraw:
+			// Original was a withdrawal (bet), so we need to deposit back
+			command.Operation = TransactionTypeDeposit
+		case TransactionTypeDeposit:
+			// Original was a deposit (settle), so we need to withdraw back
+			command.Operation = TransactionTypeWithdraw
+		default:
+			return nil, fmt.Errorf("cancel %s cancels a %s", tx.ID, original.Type)
+		}
+		command.BetID = original.ProviderID
+		command.Reference = fmt.Sprintf("cancel-%d", tx.WithdrawProviderID)
+		if tx.ProviderID != 0 {
+			// Rollbacks of part of a transaction are told apart by their own id
+			command.Reference = fmt.Sprintf("cancel-%d-%d", tx.WithdrawProviderID, tx.ProviderID)
+		}
+	default:
+		return nil, fmt.Errorf("unknown transaction type %q", tx.Type)
+	}
+	return command, nil
+}
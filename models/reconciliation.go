@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+type DiscrepancyKind string
+
+const (
+	// DiscrepancyBalanceMismatch is a wallet balance that differs from the ledger
+	DiscrepancyBalanceMismatch DiscrepancyKind = "BALANCE_MISMATCH"
+	// DiscrepancyCurrencyMismatch is a ledger account in a currency the wallet
+	// doesn't report for the player
+	DiscrepancyCurrencyMismatch DiscrepancyKind = "CURRENCY_MISMATCH"
+)
+
+// ReconciliationRun is one comparison of every player ledger account with the
+// balance the wallet reports
+type ReconciliationRun struct {
+	bun.BaseModel `bun:"table:reconciliation_runs,alias:rr"`
+
+	ID            uuid.UUID `bun:",pk,type:uuid,default:uuid_generate_v4()"`
+	Accounts      int       `bun:"accounts"`
+	Matched       int       `bun:"matched"`
+	Discrepancies int       `bun:"discrepancies"`
+	// Skipped accounts had transactions in flight, their balance moves
+	Skipped    int       `bun:"skipped"`
+	Errors     int       `bun:"errors"`
+	StartedAt  time.Time `bun:"started_at,nullzero"`
+	FinishedAt time.Time `bun:"finished_at,nullzero"`
+
+	Items []*ReconciliationDiscrepancy `bun:"rel:has-many,join:id=run_id"`
+}
+
+// ReconciliationDiscrepancy is a ledger account whose expected balance didn't
+// match the wallet during a run
+type ReconciliationDiscrepancy struct {
+	bun.BaseModel `bun:"table:reconciliation_discrepancies,alias:rd"`
+
+	ID             uint64          `bun:",pk,autoincrement"`
+	RunID          uuid.UUID       `bun:"run_id,type:uuid"`
+	PlayerID       uint64          `bun:"player_id"`
+	Currency       Currency        `bun:"currency"`
+	Kind           DiscrepancyKind `bun:"kind"`
+	Expected       Amount          `bun:"expected"`
+	Actual         Amount          `bun:"actual"`
+	WalletCurrency string          `bun:"wallet_currency,nullzero"`
+	CreatedAt      time.Time       `bun:"created_at,nullzero"`
+}
+
+// LedgerBalance is the balance of the ledger account of a player in a currency
+type LedgerBalance struct {
+	PlayerID uint64   `bun:"player_id"`
+	Currency Currency `bun:"currency"`
+	Balance  Amount   `bun:"balance"`
+	// Opened is false until the account got its opening balance, its
+	// balance then only sums the movements
+	Opened bool `bun:"opened"`
+}
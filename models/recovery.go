@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+type RecoveryDecision string
+
+const (
+	// RecoveryDecisionConfirmed is taken when the wallet acknowledged the last
+	// attempt but the worker died before saving the result
+	RecoveryDecisionConfirmed RecoveryDecision = "CONFIRMED"
+	// RecoveryDecisionRequeued puts the transaction back in the pending queue,
+	// it is re-submitted with the same reference so the wallet can't apply it twice
+	RecoveryDecisionRequeued RecoveryDecision = "REQUEUED"
+)
+
+// TransactionRecovery is the audit trail of the sweeper: one row per stale
+// processing transaction it recovered, with the lease it found and what it
+// decided.
+type TransactionRecovery struct {
+	bun.BaseModel `bun:"table:transaction_recoveries,alias:tr"`
+
+	ID                  uint64            `bun:",pk,autoincrement"`
+	TransactionID       uuid.UUID         `bun:"transaction_id,type:uuid"`
+	PlayerID            uint64            `bun:"player_id"`
+	PreviousLockedBy    string            `bun:"previous_locked_by,nullzero"`
+	PreviousLockedUntil time.Time         `bun:"previous_locked_until,nullzero"`
+	Decision            RecoveryDecision  `bun:"decision"`
+	Status              TransactionStatus `bun:"status"`
+	Reason              string            `bun:"reason"`
+	SweptBy             string            `bun:"swept_by"`
+	CreatedAt           time.Time         `bun:"created_at,nullzero"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+type RoundStatus string
+
+const (
+	RoundStatusOpen   RoundStatus = "OPEN"
+	RoundStatusClosed RoundStatus = "CLOSED"
+)
+
+// Round is a game round of a player as reported by the provider. A round
+// takes any number of bets and wins until the provider closes it, cancels
+// are still accepted once it is closed.
+type Round struct {
+	bun.BaseModel `bun:"table:rounds,alias:rd"`
+
+	ID              uuid.UUID   `bun:",pk,type:uuid,default:uuid_generate_v4()"`
+	PlayerID        uint64      `bun:"player_id"`
+	ProviderRoundID string      `bun:"provider_round_id"`
+	GameID          string      `bun:"game_id,nullzero"`
+	Currency        Currency    `bun:"currency"`
+	Status          RoundStatus `bun:"status"`
+	// TotalBet and TotalWon sum the confirmed bets and wins of the round,
+	// net of their confirmed cancels
+	TotalBet  Amount    `bun:"total_bet"`
+	TotalWon  Amount    `bun:"total_won"`
+	CreatedAt time.Time `bun:"created_at,nullzero"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero"`
+	ClosedAt  time.Time `bun:"closed_at,nullzero"`
+}
+
+// RoundTotals returns how a confirmed transaction moves the totals of its
+// round, original being the transaction a cancel reverses
+func RoundTotals(tx *Transaction, original *Transaction) (bet, won Amount) {
+	switch tx.Type {
+	case TransactionTypeWithdraw:
+		return tx.Amount, 0
+	case TransactionTypeDeposit:
+		return 0, tx.Amount
+	case TransactionTypeCancel:
+		if original == nil {
+			return 0, 0
+		}
+		switch original.Type {
+		case TransactionTypeWithdraw:
+			return -tx.Amount, 0
+		case TransactionTypeDeposit:
+			return 0, -tx.Amount
+		}
+	}
+	return 0, 0
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -39,11 +42,59 @@ type Transaction struct {
 	PlayerID           uint64    `json:"-"`
 	ProviderID         uint64    `bun:"provider_id,nullzero"`
 	WithdrawProviderID uint64    `bun:"withdraw_provider_id,nullzero"`
-	Amount             string
+	RoundID            uuid.UUID `bun:"round_id,type:uuid,nullzero"`
+	Round              *Round    `bun:"rel:belongs-to,join:round_id=id"`
+	Amount             Amount
 	Currency           Currency
 	Status             TransactionStatus
 	Type               TransactionType
 	Attempts           int
+	NextAttemptAt      time.Time `bun:"next_attempt_at,nullzero"`
+	LockedBy           string    `bun:"locked_by,nullzero"`
+	LockedUntil        time.Time `bun:"locked_until,nullzero"`
 	CreatedAt          time.Time `bun:"created_at"`
 	UpdatedAt          time.Time `bun:"updated_at"`
+
+	// Refunded is the part of Amount reserved by its cancels, pending or
+	// confirmed. A cancel that fails gives its part back.
+	Refunded Amount `bun:"refunded"`
+
+	// Version is incremented by every update, a transaction is only saved
+	// when the stored version is still the one that was read
+	Version int64 `bun:"version"`
+}
+
+// Refundable is the part of a transaction its cancels can still reverse
+func (t *Transaction) Refundable() Amount {
+	return t.Amount - t.Refunded
+}
+
+var ErrVersionConflict = errors.New("transaction was modified concurrently")
+
+// VersionConflictError is returned when a transaction is saved from a stale
+// copy: another writer saved it since it was read. The transaction should be
+// reloaded and the change re-evaluated.
+type VersionConflictError struct {
+	TransactionID uuid.UUID
+	// Version is the version that was read, Current the stored one
+	Version int64
+	Current int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: %s is at version %d, not %d", ErrVersionConflict, e.TransactionID, e.Current, e.Version)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// TransactionResponse is the response the API first answered for a
+// transaction, replayed when the provider retries the same request
+type TransactionResponse struct {
+	bun.BaseModel `bun:"table:transaction_responses,alias:tr"`
+
+	TransactionID uuid.UUID       `bun:"transaction_id,pk,type:uuid"`
+	Response      json.RawMessage `bun:"response,type:jsonb"`
+	CreatedAt     time.Time       `bun:"created_at,nullzero"`
 }
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+var ErrIllegalTransition = errors.New("illegal transaction status transition")
+
+// transactionTransitions lists the statuses a transaction can move to from
+// each status, per type. A transaction is created pending along with its
+// wallet command, then left to the worker, which claims it (PROCESSING) and
+// confirms it, puts it back in the queue for a retry or gives up on it
+// (FAILED). A failed transaction is requeued or confirmed by an operator.
+// Bets and settlements are finalized once confirmed, when they are settled or
+// cancelled, a cancel can't be undone.
+var transactionTransitions = map[TransactionType]map[TransactionStatus][]TransactionStatus{
+	TransactionTypeWithdraw: {
+		"":                          {TransactionStatusPending},
+		TransactionStatusPending:    {TransactionStatusProcessing, TransactionStatusConfirmed},
+		TransactionStatusProcessing: {TransactionStatusPending, TransactionStatusConfirmed, TransactionStatusFailed},
+		TransactionStatusFailed:     {TransactionStatusPending, TransactionStatusConfirmed},
+		TransactionStatusConfirmed:  {TransactionStatusFinalized},
+	},
+	TransactionTypeDeposit: {
+		"":                          {TransactionStatusPending},
+		TransactionStatusPending:    {TransactionStatusProcessing, TransactionStatusConfirmed},
+		TransactionStatusProcessing: {TransactionStatusPending, TransactionStatusConfirmed, TransactionStatusFailed},
+		TransactionStatusFailed:     {TransactionStatusPending, TransactionStatusConfirmed},
+		TransactionStatusConfirmed:  {TransactionStatusFinalized},
+	},
+	TransactionTypeCancel: {
+		"":                          {TransactionStatusPending},
+		TransactionStatusPending:    {TransactionStatusProcessing, TransactionStatusConfirmed},
+		TransactionStatusProcessing: {TransactionStatusPending, TransactionStatusConfirmed, TransactionStatusFailed},
+		TransactionStatusFailed:     {TransactionStatusPending, TransactionStatusConfirmed},
+	},
+}
+
+// CanTransition tells whether a transaction of type typ can move from status
+// from to status to. The empty status is the one before creation. Keeping the
+// same status is allowed from any status the type can reach.
+func CanTransition(typ TransactionType, from, to TransactionStatus) bool {
+	transitions, ok := transactionTransitions[typ]
+	if !ok {
+		return false
+	}
+	if from == to {
+		return from != "" && slices.Contains(PreviousStatuses(typ, to), to)
+	}
+	return slices.Contains(transitions[from], to)
+}
+
+// ValidateTransition returns ErrIllegalTransition when a transaction of type
+// typ can't move from status from to status to
+func ValidateTransition(typ TransactionType, from, to TransactionStatus) error {
+	if !CanTransition(typ, from, to) {
+		return fmt.Errorf("%w: %s from %q to %q", ErrIllegalTransition, typ, from, to)
+	}
+	return nil
+}
+
+// PreviousStatuses returns the statuses a transaction of type typ can be in
+// to move to status to, including to itself when the type can reach it
+func PreviousStatuses(typ TransactionType, to TransactionStatus) []TransactionStatus {
+	var statuses []TransactionStatus
+	for from, next := range transactionTransitions[typ] {
+		if from != "" && slices.Contains(next, to) {
+			statuses = append(statuses, from)
+		}
+	}
+	if len(statuses) > 0 {
+		statuses = append(statuses, to)
+	}
+	slices.Sort(statuses)
+	return slices.Compact(statuses)
+}
+
+// TransactionTransition is the status history of a transaction: one row per
+// status change, with who or what made it
+type TransactionTransition struct {
+	bun.BaseModel `bun:"table:transaction_transitions,alias:tt"`
+
+	ID            uint64            `bun:",pk,autoincrement"`
+	TransactionID uuid.UUID         `bun:"transaction_id,type:uuid"`
+	FromStatus    TransactionStatus `bun:"from_status,nullzero"`
+	ToStatus      TransactionStatus `bun:"to_status"`
+	// Actor is "api", "worker:<worker id>/<shard>", "sweeper:<worker id>" or
+	// "operator:<name>"
+	Actor     string    `bun:"actor"`
+	Reason    string    `bun:"reason,nullzero"`
+	CreatedAt time.Time `bun:"created_at,nullzero"`
+}
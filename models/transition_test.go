@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	type transition struct {
+		from, to TransactionStatus
+	}
+	lifecycle := []transition{
+		{"", TransactionStatusPending},
+		{TransactionStatusPending, TransactionStatusPending},
+		{TransactionStatusPending, TransactionStatusProcessing},
+		{TransactionStatusPending, TransactionStatusConfirmed},
+		{TransactionStatusProcessing, TransactionStatusProcessing},
+		{TransactionStatusProcessing, TransactionStatusPending},
+		{TransactionStatusProcessing, TransactionStatusConfirmed},
+		{TransactionStatusProcessing, TransactionStatusFailed},
+		{TransactionStatusFailed, TransactionStatusFailed},
+		{TransactionStatusFailed, TransactionStatusPending},
+		{TransactionStatusFailed, TransactionStatusConfirmed},
+		{TransactionStatusConfirmed, TransactionStatusConfirmed},
+	}
+	finalized := append(lifecycle,
+		transition{TransactionStatusConfirmed, TransactionStatusFinalized},
+		transition{TransactionStatusFinalized, TransactionStatusFinalized},
+	)
+
+	legal := map[TransactionType][]transition{
+		TransactionTypeWithdraw: finalized,
+		TransactionTypeDeposit:  finalized,
+		TransactionTypeCancel:   lifecycle,
+	}
+	statuses := []TransactionStatus{
+		"",
+		TransactionStatusPending,
+		TransactionStatusProcessing,
+		TransactionStatusConfirmed,
+		TransactionStatusFailed,
+		TransactionStatusFinalized,
+	}
+
+	for typ, transitions := range legal {
+		allowed := make(map[transition]bool, len(transitions))
+		for _, tr := range transitions {
+			allowed[tr] = true
+		}
+		for _, from := range statuses {
+			for _, to := range statuses {
+				t.Run(fmt.Sprintf("%s/%q->%q", typ, from, to), func(t *testing.T) {
+					if got := CanTransition(typ, from, to); got != allowed[transition{from, to}] {
+						t.Errorf("CanTransition(%s, %q, %q) = %t, want %t", typ, from, to, got, !got)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestIllegalTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      TransactionType
+		from, to TransactionStatus
+	}{
+		{"final bet confirmed again", TransactionTypeWithdraw, TransactionStatusFinalized, TransactionStatusConfirmed},
+		{"final settlement confirmed again", TransactionTypeDeposit, TransactionStatusFinalized, TransactionStatusConfirmed},
+		{"failed bet cancelled", TransactionTypeWithdraw, TransactionStatusFailed, TransactionStatusFinalized},
+		{"pending bet cancelled", TransactionTypeWithdraw, TransactionStatusPending, TransactionStatusFinalized},
+		{"confirmed bet failed", TransactionTypeWithdraw, TransactionStatusConfirmed, TransactionStatusFailed},
+		{"confirmed bet requeued", TransactionTypeWithdraw, TransactionStatusConfirmed, TransactionStatusPending},
+		{"cancel finalized", TransactionTypeCancel, TransactionStatusConfirmed, TransactionStatusFinalized},
+		{"created confirmed", TransactionTypeDeposit, "", TransactionStatusConfirmed},
+		{"unknown type", TransactionType("REFUND"), "", TransactionStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if CanTransition(tt.typ, tt.from, tt.to) {
+				t.Errorf("CanTransition(%s, %q, %q) = true", tt.typ, tt.from, tt.to)
+			}
+			if err := ValidateTransition(tt.typ, tt.from, tt.to); !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("ValidateTransition(%s, %q, %q) = %v, want %v", tt.typ, tt.from, tt.to, err, ErrIllegalTransition)
+			}
+		})
+	}
+}
+
+func TestPreviousStatuses(t *testing.T) {
+	got := PreviousStatuses(TransactionTypeWithdraw, TransactionStatusFinalized)
+	if len(got) != 2 || got[0] != TransactionStatusConfirmed || got[1] != TransactionStatusFinalized {
+		t.Errorf("PreviousStatuses(WITHDRAW, FINAL) = %v, want [CONFIRMED FINAL]", got)
+	}
+	if got := PreviousStatuses(TransactionTypeCancel, TransactionStatusFinalized); len(got) != 0 {
+		t.Errorf("PreviousStatuses(CANCEL, FINAL) = %v, want none", got)
+	}
+}
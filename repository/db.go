@@ -22,6 +22,17 @@ import (
 type Repository interface {
 	PlayerRepository
 	TransactionRepository
+	DeadLetterRepository
+	RecoveryRepository
+	LedgerRepository
+	ReconciliationRepository
+	OutboxRepository
+	IdempotencyRepository
+	RoundRepository
+
+	// WithTx runs fn with a repository whose writes are committed together
+	// when fn returns nil, and rolled back otherwise. Nested calls use savepoints.
+	WithTx(ctx context.Context, fn func(repo Repository) error) error
 }
 
 type PlayerRepository interface {
@@ -36,18 +47,122 @@ type PlayerRepository interface {
 type TransactionRepository interface {
 	CreateTransaction(ctx context.Context, transaction *models.Transaction) error
 	GetTransactionByProviderID(ctx context.Context, providerID uint64) (*models.Transaction, error)
-	UpdateTransaction(ctx context.Context, transaction *models.Transaction) error
+	UpdateTransaction(ctx context.Context, transaction *models.Transaction, actor string) error
 	GetTransactionByID(ctx context.Context, id uuid.UUID) (*models.Transaction, error)
 
 	GetFirstProcessingTransactionsByPlayerID(ctx context.Context, playerID uint64) (*models.Transaction, error)
 	GetFirstPendingTransactionsByPlayerID(ctx context.Context, playerID uint64) (*models.Transaction, error)
-	GetNextProcessableTransaction(ctx context.Context) (*models.Transaction, error)
-	StartProcessingTransaction(ctx context.Context, transactionID uuid.UUID) error
+	ClaimTransactions(ctx context.Context, owner string, shard, shards, limit int, lease time.Duration) ([]*models.Transaction, error)
+	ReleaseTransactions(ctx context.Context, owner string, transactionIDs []uuid.UUID) error
+	NotifyPendingTransactions(ctx context.Context, playerID uint64) error
+	ListenPendingTransactions(ctx context.Context) <-chan uint64
+
+	CreateTransactionAttempt(ctx context.Context, attempt *models.TransactionAttempt) error
+	GetLastTransactionAttempt(ctx context.Context, transactionID uuid.UUID) (*models.TransactionAttempt, error)
+
+	CreateTransactionResponse(ctx context.Context, response *models.TransactionResponse) error
+	GetTransactionResponse(ctx context.Context, transactionID uuid.UUID) (*models.TransactionResponse, error)
+	ListTransactions(ctx context.Context, filter TransactionFilter) ([]*models.Transaction, error)
+	ReserveRefund(ctx context.Context, original *models.Transaction, amount models.Amount) (bool, error)
+	GetConfirmedRefund(ctx context.Context, providerID uint64) (models.Amount, error)
+	GetTransactionsByRoundID(ctx context.Context, roundID uuid.UUID) ([]*models.Transaction, error)
+	CreateSettlementBets(ctx context.Context, bets []*models.SettlementBet) error
+	GetSettlementBets(ctx context.Context, transactionID uuid.UUID) ([]*models.SettlementBet, error)
+}
+
+type DeadLetterRepository interface {
+	DeadLetterTransaction(ctx context.Context, transaction *models.Transaction, deadLetter *models.DeadLetter, actor string) error
+	CloseDeadLetter(ctx context.Context, deadLetter *models.DeadLetter, transactions ...*models.Transaction) error
+	GetDeadLetterByID(ctx context.Context, id uuid.UUID) (*models.DeadLetter, error)
+	GetLastDeadLetterByTransactionID(ctx context.Context, transactionID uuid.UUID) (*models.DeadLetter, error)
+	ListDeadLetters(ctx context.Context, status models.DeadLetterStatus, limit, offset int) ([]*models.DeadLetter, error)
+}
+
+type LedgerRepository interface {
+	OpenLedgerAccount(ctx context.Context, playerID uint64, currency models.Currency, balance, posted models.Amount) (bool, error)
+	GetLedgerBalances(ctx context.Context, playerID uint64) (map[models.Currency]models.Amount, error)
+	GetJournalEntriesByPlayerID(ctx context.Context, playerID uint64, limit, offset int) ([]*models.JournalEntry, error)
+	ListLedgerBalances(ctx context.Context, afterPlayerID uint64, limit int) ([]*models.LedgerBalance, error)
+}
+
+type ReconciliationRepository interface {
+	CreateReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error
+	FinishReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error
+	CreateReconciliationDiscrepancy(ctx context.Context, discrepancy *models.ReconciliationDiscrepancy) error
+	GetReconciliationRunByID(ctx context.Context, id uuid.UUID) (*models.ReconciliationRun, error)
+	ListReconciliationRuns(ctx context.Context, limit, offset int) ([]*models.ReconciliationRun, error)
+}
+
+type OutboxRepository interface {
+	CreateWalletCommands(ctx context.Context, commands []*models.WalletCommand) error
+	GetWalletCommandsByTransactionID(ctx context.Context, transactionID uuid.UUID) ([]*models.WalletCommand, error)
+	MarkWalletCommandDelivered(ctx context.Context, command *models.WalletCommand) error
+	NotifyDispatchResult(ctx context.Context, transactionID uuid.UUID) error
+	ListenDispatchResults(ctx context.Context) <-chan uuid.UUID
+}
+
+type IdempotencyRepository interface {
+	ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error)
+	GetIdempotencyKey(ctx context.Context, playerID uint64, key string) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	DeleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+type RoundRepository interface {
+	OpenRound(ctx context.Context, round *models.Round) error
+	CloseRound(ctx context.Context, round *models.Round) error
+	GetRoundByID(ctx context.Context, id uuid.UUID) (*models.Round, error)
+	GetRoundByProviderID(ctx context.Context, playerID uint64, providerRoundID string) (*models.Round, error)
+}
+
+type RecoveryRepository interface {
+	GetStaleTransactions(ctx context.Context, workerID string, limit int) ([]*models.Transaction, error)
+	RecoverTransaction(ctx context.Context, recovery *models.TransactionRecovery, transaction *models.Transaction, settled ...*models.Transaction) (bool, error)
 }
 
 type RepoPostgresSQLProvider struct {
 	PlayerRepository
 	TransactionRepository
+	DeadLetterRepository
+	RecoveryRepository
+	LedgerRepository
+	ReconciliationRepository
+	OutboxRepository
+	IdempotencyRepository
+	RoundRepository
+
+	db   bun.IDB
+	pool *bun.DB
+}
+
+// NewRepoPostgresSQLProvider builds the repository on top of the connection pool
+func NewRepoPostgresSQLProvider(db *bun.DB) *RepoPostgresSQLProvider {
+	return newRepoPostgresSQLProvider(db, db)
+}
+
+// newRepoPostgresSQLProvider builds the repository on top of db, which is
+// either pool or one of its db transactions
+func newRepoPostgresSQLProvider(db bun.IDB, pool *bun.DB) *RepoPostgresSQLProvider {
+	return &RepoPostgresSQLProvider{
+		NewPlayerProvider(db),
+		NewTransactionProvider(db, pool),
+		NewDeadLetterProvider(db),
+		NewRecoveryProvider(db),
+		NewLedgerProvider(db),
+		NewReconciliationProvider(db),
+		NewOutboxProvider(db, pool),
+		NewIdempotencyProvider(db),
+		NewRoundProvider(db),
+		db,
+		pool,
+	}
+}
+
+func (r *RepoPostgresSQLProvider) WithTx(ctx context.Context, fn func(repo Repository) error) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return fn(newRepoPostgresSQLProvider(tx, r.pool))
+	})
 }
 
 func Connect(databaseUrl string) (*RepoPostgresSQLProvider, error) {
@@ -100,8 +215,5 @@ func Connect(databaseUrl string) (*RepoPostgresSQLProvider, error) {
 
 	slog.Debug(fmt.Sprintf("migrated to %d\n", group.ID))
 
-	return &RepoPostgresSQLProvider{
-		NewPlayerProvider(db),
-		NewTransactionProvider(db),
-	}, nil
+	return NewRepoPostgresSQLProvider(db), nil
 }
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+func TestWithTxRollsBack(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	tx := createPending(t, repo, createPlayer(t, repo))
+
+	errAbort := errors.New("abort")
+	err := repo.WithTx(ctx, func(repo Repository) error {
+		confirmed := *tx
+		confirmed.Status = models.TransactionStatusConfirmed
+		if err := repo.UpdateTransaction(ctx, &confirmed, "api"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx returned %v, want the error of fn", err)
+	}
+
+	stored, err := repo.GetTransactionByID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.TransactionStatusPending || stored.Version != tx.Version {
+		t.Errorf("transaction is %s at version %d after a rollback, want PENDING at %d", stored.Status, stored.Version, tx.Version)
+	}
+	if got := history(t, repo, tx); len(got) != 1 {
+		t.Errorf("history has %d transitions after a rollback, want the creation only", len(got))
+	}
+}
+
+func TestWithTxNestsInSavepoints(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+	kept := createPending(t, repo, player)
+	dropped := createPending(t, repo, player)
+
+	err := repo.WithTx(ctx, func(outer Repository) error {
+		kept.Status = models.TransactionStatusConfirmed
+		if err := outer.UpdateTransaction(ctx, kept, "api"); err != nil {
+			return err
+		}
+		// The inner failure only rolls back to its savepoint
+		outer.WithTx(ctx, func(inner Repository) error { //nolint:errcheck
+			dropped.Status = models.TransactionStatusConfirmed
+			if err := inner.UpdateTransaction(ctx, dropped, "api"); err != nil {
+				return err
+			}
+			return errors.New("abort")
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tx, want := range map[*models.Transaction]models.TransactionStatus{
+		kept:    models.TransactionStatusConfirmed,
+		dropped: models.TransactionStatusPending,
+	} {
+		stored, err := repo.GetTransactionByID(ctx, tx.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != want {
+			t.Errorf("transaction %s is %s, want %s", tx.ID, stored.Status, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+type DeadLetterProvider struct {
+	bun.IDB
+}
+
+func NewDeadLetterProvider(db bun.IDB) DeadLetterProvider {
+	return DeadLetterProvider{db}
+}
+
+// DeadLetterTransaction atomically saves the transaction (usually marked as
+// failed by actor) and its dead letter
+func (d DeadLetterProvider) DeadLetterTransaction(ctx context.Context, transaction *models.Transaction, deadLetter *models.DeadLetter, actor string) error {
+	return d.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := updateTransaction(ctx, tx, transaction, actor, deadLetter.Reason); err != nil {
+			return err
+		}
+
+		_, err := tx.NewInsert().Model(deadLetter).Returning("*").Exec(ctx)
+		return err
+	})
+}
+
+// CloseDeadLetter atomically saves an operator decision on a dead letter and
+// the transactions it changed, recording the confirmed ones in the ledger
+func (d DeadLetterProvider) CloseDeadLetter(ctx context.Context, deadLetter *models.DeadLetter, transactions ...*models.Transaction) error {
+	actor := "operator"
+	if deadLetter.ResolvedBy != "" {
+		actor += ":" + deadLetter.ResolvedBy
+	}
+
+	return d.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, transaction := range transactions {
+			if err := updateTransaction(ctx, tx, transaction, actor, deadLetter.ResolutionReason); err != nil {
+				return err
+			}
+			if err := postTransaction(ctx, tx, transaction); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.NewUpdate().
+			Model(deadLetter).
+			Column("status", "resolution", "resolution_reason", "resolved_by", "resolved_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+}
+
+func (d DeadLetterProvider) GetDeadLetterByID(ctx context.Context, id uuid.UUID) (*models.DeadLetter, error) {
+	deadLetter := new(models.DeadLetter)
+	err := d.NewSelect().
+		Model(deadLetter).
+		Relation("Transaction").
+		Relation("Attempts", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("ta.attempted_at ASC")
+		}).
+		Where("dl.id = ?", id).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return deadLetter, err
+}
+
+// GetLastDeadLetterByTransactionID returns the latest dead letter of a
+// transaction, which is dead lettered again when it fails after a requeue
+func (d DeadLetterProvider) GetLastDeadLetterByTransactionID(ctx context.Context, transactionID uuid.UUID) (*models.DeadLetter, error) {
+	deadLetter := new(models.DeadLetter)
+	err := d.NewSelect().
+		Model(deadLetter).
+		Where("dl.transaction_id = ?", transactionID).
+		Order("dl.created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return deadLetter, err
+}
+
+// ListDeadLetters returns dead letters newest first, all of them when status is empty
+func (d DeadLetterProvider) ListDeadLetters(ctx context.Context, status models.DeadLetterStatus, limit, offset int) ([]*models.DeadLetter, error) {
+	var deadLetters []*models.DeadLetter
+	q := d.NewSelect().
+		Model(&deadLetters).
+		Relation("Transaction").
+		Order("dl.created_at DESC").
+		Limit(limit).
+		Offset(offset)
+	if status != "" {
+		q = q.Where("dl.status = ?", status)
+	}
+	err := q.Scan(ctx)
+	return deadLetters, err
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+type IdempotencyProvider struct {
+	bun.IDB
+}
+
+func NewIdempotencyProvider(db bun.IDB) IdempotencyProvider {
+	return IdempotencyProvider{db}
+}
+
+// ClaimIdempotencyKey saves a new key, or replaces the expired one of the
+// same player. It returns false when the key is still held by a request.
+func (i IdempotencyProvider) ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	err := i.NewInsert().
+		Model(key).
+		On("CONFLICT (player_id, key) DO UPDATE").
+		Set("request_hash = EXCLUDED.request_hash").
+		Set("status = EXCLUDED.status").
+		Set("response_status = NULL").
+		Set("response_body = NULL").
+		Set("created_at = NOW()").
+		Set("expires_at = EXCLUDED.expires_at").
+		Where("ik.expires_at <= NOW()").
+		Returning("created_at").
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (i IdempotencyProvider) GetIdempotencyKey(ctx context.Context, playerID uint64, key string) (*models.IdempotencyKey, error) {
+	idempotencyKey := new(models.IdempotencyKey)
+	err := i.NewSelect().
+		Model(idempotencyKey).
+		Where("player_id = ? AND key = ?", playerID, key).
+		Where("expires_at > NOW()").
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return idempotencyKey, err
+}
+
+// CompleteIdempotencyKey saves the response of the request holding a key
+func (i IdempotencyProvider) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	_, err := i.NewUpdate().
+		Model(key).
+		Column("status", "response_status", "response_body").
+		WherePK().
+		Where("status = ?", models.IdempotencyKeyStatusInProgress).
+		Exec(ctx)
+	return err
+}
+
+// DeleteIdempotencyKey releases a key, so the request can be sent again
+func (i IdempotencyProvider) DeleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	_, err := i.NewDelete().Model(key).WherePK().Exec(ctx)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys purges the expired keys and returns how many were deleted
+func (i IdempotencyProvider) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	res, err := i.NewDelete().
+		Model((*models.IdempotencyKey)(nil)).
+		Where("expires_at <= NOW()").
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+type LedgerProvider struct {
+	bun.IDB
+}
+
+func NewLedgerProvider(db bun.IDB) LedgerProvider {
+	return LedgerProvider{db}
+}
+
+// OpenLedgerAccount opens the ledger account of a player in currency from
+// balance, what the wallet reported while the movements posted to the
+// account summed to posted. The opening entry records the difference, the
+// money the player had before the ledger tracked its movements, so an account
+// created by a movement is opened later on. It returns false when the account
+// is already opened, or when balance can't be trusted: the player has
+// transactions in flight or a movement was posted since it was read.
+func (l LedgerProvider) OpenLedgerAccount(ctx context.Context, playerID uint64, currency models.Currency, balance, posted models.Amount) (bool, error) {
+	opened := false
+	err := l.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		account := &models.LedgerAccount{Type: models.LedgerAccountPlayer, PlayerID: playerID, Currency: currency}
+		if err := upsertLedgerAccount(ctx, tx, account); err != nil {
+			return err
+		}
+
+		// Serialize the openings and the movements of an account
+		err := tx.NewSelect().Model(account).WherePK().For("UPDATE").Scan(ctx)
+		if err != nil || !account.OpenedAt.IsZero() {
+			return err
+		}
+
+		inFlight, err := tx.NewSelect().
+			Model((*models.Transaction)(nil)).
+			Where("player_id = ?", playerID).
+			Where("status IN (?)", bun.In([]models.TransactionStatus{models.TransactionStatusPending, models.TransactionStatusProcessing})).
+			Exists(ctx)
+		if err != nil || inFlight {
+			return err
+		}
+
+		var moved models.Amount
+		err = tx.NewSelect().
+			Model((*models.JournalLine)(nil)).
+			ColumnExpr("COALESCE(SUM(credit - debit), 0)").
+			Where("account_id = ?", account.ID).
+			Scan(ctx, &moved)
+		if err != nil || moved != posted {
+			return err
+		}
+
+		if entry := models.NewOpeningJournalEntry(playerID, currency, balance-posted); entry != nil {
+			if _, err := postJournalEntry(ctx, tx, entry); err != nil {
+				return err
+			}
+		}
+		_, err = tx.NewUpdate().Model(account).Set("opened_at = NOW()").WherePK().Exec(ctx)
+		opened = err == nil
+		return err
+	})
+	return opened, err
+}
+
+// GetLedgerBalances returns the balance of each ledger account of a player,
+// i.e. what the wallet balance of the player should be in each currency
+func (l LedgerProvider) GetLedgerBalances(ctx context.Context, playerID uint64) (map[models.Currency]models.Amount, error) {
+	var rows []struct {
+		Currency models.Currency
+		Balance  models.Amount
+	}
+	err := l.NewSelect().
+		TableExpr("ledger_accounts AS la").
+		ColumnExpr("la.currency").
+		ColumnExpr("COALESCE(SUM(jl.credit - jl.debit), 0) AS balance").
+		Join("LEFT JOIN journal_lines AS jl ON jl.account_id = la.id").
+		Where("la.type = ? AND la.player_id = ?", models.LedgerAccountPlayer, playerID).
+		Group("la.currency").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[models.Currency]models.Amount, len(rows))
+	for _, row := range rows {
+		balances[row.Currency] = row.Balance
+	}
+	return balances, nil
+}
+
+// ListLedgerBalances returns the balances of the player ledger accounts,
+// ordered by player and currency, starting after the player afterPlayerID
+func (l LedgerProvider) ListLedgerBalances(ctx context.Context, afterPlayerID uint64, limit int) ([]*models.LedgerBalance, error) {
+	var balances []*models.LedgerBalance
+	err := l.NewSelect().
+		TableExpr("ledger_accounts AS la").
+		ColumnExpr("la.player_id, la.currency").
+		ColumnExpr("COALESCE(SUM(jl.credit - jl.debit), 0) AS balance").
+		ColumnExpr("la.opened_at IS NOT NULL AS opened").
+		Join("LEFT JOIN journal_lines AS jl ON jl.account_id = la.id").
+		Where("la.type = ? AND la.player_id > ?", models.LedgerAccountPlayer, afterPlayerID).
+		Group("la.player_id", "la.currency", "la.opened_at").
+		Order("la.player_id ASC", "la.currency ASC").
+		Limit(limit).
+		Scan(ctx, &balances)
+	return balances, err
+}
+
+// GetJournalEntriesByPlayerID returns the journal entries of a player with
+// their lines, newest first
+func (l LedgerProvider) GetJournalEntriesByPlayerID(ctx context.Context, playerID uint64, limit, offset int) ([]*models.JournalEntry, error) {
+	var entries []*models.JournalEntry
+	err := l.NewSelect().
+		Model(&entries).
+		Relation("Lines", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Relation("Account").Order("jl.id ASC")
+		}).
+		Where("je.player_id = ?", playerID).
+		Order("je.created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(ctx)
+	return entries, err
+}
+
+// postTransaction records a confirmed transaction in the ledger and in the
+// totals of its round, in the db transaction that saves it. Other statuses
+// are ignored, as well as transactions that were already recorded.
+func postTransaction(ctx context.Context, db bun.IDB, transaction *models.Transaction) error {
+	if transaction.Status != models.TransactionStatusConfirmed {
+		return nil
+	}
+
+	var original *models.Transaction
+	if transaction.Type == models.TransactionTypeCancel {
+		original = new(models.Transaction)
+		err := db.NewSelect().Model(original).Where("provider_id = ?", transaction.WithdrawProviderID).Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the transaction cancelled by %s: %w", transaction.ID, err)
+		}
+	}
+
+	entry, err := models.NewTransactionJournalEntry(transaction, original)
+	if err != nil || entry == nil {
+		return err
+	}
+	posted, err := postJournalEntry(ctx, db, entry)
+	if err != nil || !posted {
+		return err
+	}
+	return addRoundTotals(ctx, db, transaction, original)
+}
+
+// postJournalEntry saves a balanced entry and its lines, opening the accounts
+// they use if needed. An entry of an already recorded transaction is skipped,
+// false is returned then.
+func postJournalEntry(ctx context.Context, db bun.IDB, entry *models.JournalEntry) (bool, error) {
+	if err := entry.Validate(); err != nil {
+		return false, err
+	}
+
+	err := db.NewInsert().
+		Model(entry).
+		On("CONFLICT (transaction_id) DO NOTHING").
+		Returning("*").
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return false, nil // Already recorded
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range entry.Lines {
+		if err := upsertLedgerAccount(ctx, db, line.Account); err != nil {
+			return false, err
+		}
+		line.EntryID = entry.ID
+		line.AccountID = line.Account.ID
+	}
+	_, err = db.NewInsert().Model(&entry.Lines).Returning("id").Exec(ctx)
+	return err == nil, err
+}
+
+// upsertLedgerAccount sets the id of account, creating the account if needed
+func upsertLedgerAccount(ctx context.Context, db bun.IDB, account *models.LedgerAccount) error {
+	return db.NewInsert().
+		Model(account).
+		On("CONFLICT (type, player_id, currency) DO UPDATE").
+		Set("type = EXCLUDED.type").
+		Returning("id, created_at").
+		Scan(ctx)
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_transactions_next_attempt_at;
+
+--bun:split
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS next_attempt_at;
@@ -0,0 +1,6 @@
+-- Earliest time the worker may retry a pending transaction
+ALTER TABLE transactions ADD COLUMN next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+--bun:split
+
+CREATE INDEX idx_transactions_next_attempt_at ON transactions(status, next_attempt_at);
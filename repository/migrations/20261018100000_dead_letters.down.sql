@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS dead_letters;
+
+--bun:split
+
+DROP TABLE IF EXISTS transaction_attempts;
@@ -0,0 +1,35 @@
+-- Every wallet call made for a transaction
+CREATE TABLE transaction_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    operation VARCHAR(8) NOT NULL CHECK (operation IN ('WITHDRAW', 'DEPOSIT')),
+    payload JSONB NOT NULL,
+    error_code VARCHAR(100),
+    error TEXT,
+    attempted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+--bun:split
+
+CREATE INDEX idx_transaction_attempts_transaction_id ON transaction_attempts(transaction_id, attempted_at);
+
+--bun:split
+
+-- Transactions the worker gave up on, waiting for an operator
+CREATE TABLE dead_letters (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    player_id BIGINT REFERENCES players(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    last_error_code VARCHAR(100),
+    status VARCHAR(8) NOT NULL CHECK (status IN ('OPEN', 'REQUEUED', 'RESOLVED')),
+    resolution VARCHAR(12) CHECK (resolution IN ('PENDING', 'CONFIRMED', 'FAILED')),
+    resolution_reason TEXT,
+    resolved_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+--bun:split
+
+CREATE INDEX idx_dead_letters_status ON dead_letters(status, created_at);
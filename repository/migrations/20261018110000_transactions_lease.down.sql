@@ -0,0 +1,5 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS locked_until;
+
+--bun:split
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS locked_by;
@@ -0,0 +1,6 @@
+-- Lease of the worker processing a transaction, expired leases can be reclaimed
+ALTER TABLE transactions ADD COLUMN locked_by VARCHAR(255);
+
+--bun:split
+
+ALTER TABLE transactions ADD COLUMN locked_until TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_transactions_processing;
+
+--bun:split
+
+DROP TABLE IF EXISTS transaction_recoveries;
@@ -0,0 +1,21 @@
+-- Audit trail of the stale processing transactions recovered by the sweeper
+CREATE TABLE transaction_recoveries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    player_id BIGINT REFERENCES players(id) ON DELETE CASCADE,
+    previous_locked_by VARCHAR(255),
+    previous_locked_until TIMESTAMP WITH TIME ZONE,
+    decision VARCHAR(12) NOT NULL CHECK (decision IN ('CONFIRMED', 'REQUEUED')),
+    status VARCHAR(12) NOT NULL,
+    reason TEXT NOT NULL,
+    swept_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+--bun:split
+
+CREATE INDEX idx_transaction_recoveries_transaction_id ON transaction_recoveries(transaction_id, created_at);
+
+--bun:split
+
+CREATE INDEX idx_transactions_processing ON transactions(locked_until) WHERE status = 'PROCESSING';
@@ -0,0 +1 @@
+ALTER TABLE transactions ALTER COLUMN amount TYPE VARCHAR(100) USING amount::TEXT;
@@ -0,0 +1,3 @@
+-- Amounts were stored as the text of a float64, keep them as exact decimals.
+-- The scale matches models.AmountScale.
+ALTER TABLE transactions ALTER COLUMN amount TYPE NUMERIC(19, 4) USING amount::NUMERIC(19, 4);
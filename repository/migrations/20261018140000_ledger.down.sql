@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS journal_lines;
+
+--bun:split
+
+DROP TABLE IF EXISTS journal_entries;
+
+--bun:split
+
+DROP FUNCTION IF EXISTS ledger_append_only();
+
+--bun:split
+
+DROP TABLE IF EXISTS ledger_accounts;
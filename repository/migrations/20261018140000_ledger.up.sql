@@ -0,0 +1,58 @@
+-- Accounts of the double-entry ledger. House and opening accounts have no
+-- player (player_id 0). opened_at is when a player account got its opening
+-- balance, NULL until then.
+CREATE TABLE ledger_accounts (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(8) NOT NULL CHECK (type IN ('PLAYER', 'HOUSE', 'OPENING')),
+    player_id BIGINT NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL CHECK (currency IN ('USD', 'EUR', 'KES')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    opened_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (type, player_id, currency)
+);
+
+--bun:split
+
+-- One entry per money movement, at most one per transaction
+CREATE TABLE journal_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    transaction_id UUID UNIQUE REFERENCES transactions(id),
+    player_id BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    type VARCHAR(8) NOT NULL CHECK (type IN ('WITHDRAW', 'DEPOSIT', 'CANCEL', 'OPENING')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+--bun:split
+
+CREATE TABLE journal_lines (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    account_id BIGINT NOT NULL REFERENCES ledger_accounts(id),
+    debit NUMERIC(19, 4) NOT NULL DEFAULT 0 CHECK (debit >= 0),
+    credit NUMERIC(19, 4) NOT NULL DEFAULT 0 CHECK (credit >= 0),
+    CHECK ((debit = 0) <> (credit = 0))
+);
+
+--bun:split
+
+CREATE INDEX idx_journal_lines_account_id ON journal_lines(account_id);
+
+--bun:split
+
+-- The ledger is append-only, mistakes are fixed with new entries
+CREATE FUNCTION ledger_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+--bun:split
+
+CREATE TRIGGER journal_entries_append_only BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+--bun:split
+
+CREATE TRIGGER journal_lines_append_only BEFORE UPDATE OR DELETE ON journal_lines
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
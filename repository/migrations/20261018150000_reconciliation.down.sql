@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reconciliation_discrepancies;
+
+--bun:split
+
+DROP TABLE IF EXISTS reconciliation_runs;
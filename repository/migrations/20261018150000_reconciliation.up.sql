@@ -0,0 +1,37 @@
+-- Comparisons of the player ledger accounts with the wallet balances
+CREATE TABLE reconciliation_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    accounts INTEGER NOT NULL DEFAULT 0,
+    matched INTEGER NOT NULL DEFAULT 0,
+    discrepancies INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+--bun:split
+
+CREATE INDEX idx_reconciliation_runs_started_at ON reconciliation_runs(started_at);
+
+--bun:split
+
+CREATE TABLE reconciliation_discrepancies (
+    id BIGSERIAL PRIMARY KEY,
+    run_id UUID NOT NULL REFERENCES reconciliation_runs(id) ON DELETE CASCADE,
+    player_id BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('BALANCE_MISMATCH', 'CURRENCY_MISMATCH')),
+    expected NUMERIC(19, 4) NOT NULL,
+    actual NUMERIC(19, 4) NOT NULL,
+    wallet_currency VARCHAR(3),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+--bun:split
+
+CREATE INDEX idx_reconciliation_discrepancies_run_id ON reconciliation_discrepancies(run_id);
+
+--bun:split
+
+CREATE INDEX idx_reconciliation_discrepancies_player_id ON reconciliation_discrepancies(player_id, created_at);
@@ -0,0 +1,14 @@
+-- Status history of the transactions, see models.TransactionTransition
+CREATE TABLE transaction_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    from_status VARCHAR(12) CHECK (from_status IN ('PENDING', 'CONFIRMED', 'FAILED', 'FINAL', 'PROCESSING')),
+    to_status VARCHAR(12) NOT NULL CHECK (to_status IN ('PENDING', 'CONFIRMED', 'FAILED', 'FINAL', 'PROCESSING')),
+    actor VARCHAR(255) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+--bun:split
+
+CREATE INDEX idx_transaction_transitions_transaction_id ON transaction_transitions(transaction_id, created_at);
@@ -0,0 +1,2 @@
+-- Incremented by every update, transactions are saved with a compare-and-swap on it
+ALTER TABLE transactions ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
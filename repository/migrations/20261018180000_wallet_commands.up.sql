@@ -0,0 +1,14 @@
+-- Outbox of the wallet operations, see models.WalletCommand
+CREATE TABLE wallet_commands (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    transaction_id UUID NOT NULL UNIQUE REFERENCES transactions(id) ON DELETE CASCADE,
+    player_id BIGINT NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    operation VARCHAR(8) NOT NULL CHECK (operation IN ('WITHDRAW', 'DEPOSIT')),
+    currency VARCHAR(3) NOT NULL,
+    amount NUMERIC(19, 4) NOT NULL,
+    bet_id BIGINT NOT NULL,
+    reference VARCHAR(255) NOT NULL UNIQUE,
+    balance VARCHAR(100),
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,6 @@
+-- Responses replayed when a provider retries a request, see models.TransactionResponse
+CREATE TABLE transaction_responses (
+    transaction_id UUID PRIMARY KEY REFERENCES transactions(id) ON DELETE CASCADE,
+    response JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,16 @@
+-- Requests sent with an Idempotency-Key header, see models.IdempotencyKey
+CREATE TABLE idempotency_keys (
+    player_id BIGINT NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status VARCHAR(12) NOT NULL CHECK (status IN ('IN_PROGRESS', 'COMPLETED')),
+    response_status INTEGER,
+    response_body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (player_id, key)
+);
+
+--bun:split
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_transactions_round_id;
+
+--bun:split
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS round_id;
+
+--bun:split
+
+DROP TABLE IF EXISTS rounds;
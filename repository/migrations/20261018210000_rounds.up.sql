@@ -0,0 +1,23 @@
+-- Game rounds reported by the provider, see models.Round
+CREATE TABLE rounds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    player_id BIGINT NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    provider_round_id VARCHAR(255) NOT NULL,
+    game_id VARCHAR(255),
+    currency VARCHAR(3) NOT NULL CHECK (currency IN ('USD', 'EUR', 'KES')),
+    status VARCHAR(6) NOT NULL CHECK (status IN ('OPEN', 'CLOSED')),
+    total_bet NUMERIC(19, 4) NOT NULL DEFAULT 0,
+    total_won NUMERIC(19, 4) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    closed_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (player_id, provider_round_id)
+);
+
+--bun:split
+
+ALTER TABLE transactions ADD COLUMN round_id UUID REFERENCES rounds(id) ON DELETE SET NULL;
+
+--bun:split
+
+CREATE INDEX idx_transactions_round_id ON transactions(round_id) WHERE round_id IS NOT NULL;
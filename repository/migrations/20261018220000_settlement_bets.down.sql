@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_wallet_commands_transaction_id;
+
+--bun:split
+
+ALTER TABLE wallet_commands ADD CONSTRAINT wallet_commands_transaction_id_key UNIQUE (transaction_id);
+
+--bun:split
+
+DROP TABLE IF EXISTS settlement_bets;
@@ -0,0 +1,16 @@
+-- Bets settled by a settlement of several bets, see models.SettlementBet
+CREATE TABLE settlement_bets (
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    bet_provider_id BIGINT NOT NULL,
+    amount NUMERIC(19, 4) NOT NULL,
+    PRIMARY KEY (transaction_id, bet_provider_id)
+);
+
+--bun:split
+
+-- A settlement of several bets has a wallet command per bet won
+ALTER TABLE wallet_commands DROP CONSTRAINT IF EXISTS wallet_commands_transaction_id_key;
+
+--bun:split
+
+CREATE INDEX idx_wallet_commands_transaction_id ON wallet_commands(transaction_id);
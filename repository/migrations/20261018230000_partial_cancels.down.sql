@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_transactions_withdraw_provider_id;
+
+--bun:split
+
+ALTER TABLE transactions ALTER COLUMN created_at SET DEFAULT NOW();
+
+--bun:split
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS refunded;
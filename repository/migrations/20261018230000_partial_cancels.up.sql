@@ -0,0 +1,23 @@
+-- Part of a transaction reserved by its cancels, see models.Transaction.Refunded
+ALTER TABLE transactions ADD COLUMN refunded NUMERIC(19, 4) NOT NULL DEFAULT 0;
+
+--bun:split
+
+-- Cancels were always for the whole transaction so far
+UPDATE transactions AS o
+SET refunded = o.amount
+WHERE EXISTS (
+    SELECT 1 FROM transactions AS c
+    WHERE c.type = 'CANCEL'
+        AND c.status <> 'FAILED'
+        AND c.withdraw_provider_id = o.provider_id
+);
+
+--bun:split
+
+-- Transactions created in the same db transaction (e.g. a round rollback) keep their order
+ALTER TABLE transactions ALTER COLUMN created_at SET DEFAULT clock_timestamp();
+
+--bun:split
+
+CREATE INDEX idx_transactions_withdraw_provider_id ON transactions(withdraw_provider_id) WHERE withdraw_provider_id IS NOT NULL;
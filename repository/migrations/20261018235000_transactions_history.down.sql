@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_transactions_player_created_at;
+
+--bun:split
+
+DROP INDEX IF EXISTS idx_transactions_player_id;
+
+--bun:split
+
+CREATE INDEX idx_transactions_player_id ON transactions(player_id, status, created_at);
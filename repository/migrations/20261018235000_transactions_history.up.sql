@@ -0,0 +1,10 @@
+-- Keyset pagination of the history of a player on (created_at, id), filtered by status or not
+DROP INDEX IF EXISTS idx_transactions_player_id;
+
+--bun:split
+
+CREATE INDEX idx_transactions_player_id ON transactions(player_id, status, created_at, id);
+
+--bun:split
+
+CREATE INDEX idx_transactions_player_created_at ON transactions(player_id, created_at, id);
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+type OutboxProvider struct {
+	bun.IDB
+	// pool is the connection pool behind db, ListenDispatchResults listens with it
+	pool *bun.DB
+}
+
+func NewOutboxProvider(db bun.IDB, pool *bun.DB) OutboxProvider {
+	return OutboxProvider{db, pool}
+}
+
+// CreateWalletCommands adds the wallet commands of a transaction to the
+// outbox. It should run in the db transaction that creates the transaction,
+// see Repository.WithTx.
+func (o OutboxProvider) CreateWalletCommands(ctx context.Context, commands []*models.WalletCommand) error {
+	_, err := o.NewInsert().Model(&commands).Returning("*").Exec(ctx)
+	return err
+}
+
+func (o OutboxProvider) GetWalletCommandsByTransactionID(ctx context.Context, transactionID uuid.UUID) ([]*models.WalletCommand, error) {
+	var commands []*models.WalletCommand
+	err := o.NewSelect().
+		Model(&commands).
+		Where("transaction_id = ?", transactionID).
+		Order("reference ASC").
+		Scan(ctx)
+	return commands, err
+}
+
+// MarkWalletCommandDelivered records that the wallet acknowledged a command,
+// along with the balance it reported. A command is only marked once.
+func (o OutboxProvider) MarkWalletCommandDelivered(ctx context.Context, command *models.WalletCommand) error {
+	_, err := o.NewUpdate().
+		Model(command).
+		Set("balance = ?", command.Balance).
+		Set("delivered_at = NOW()").
+		WherePK().
+		Where("delivered_at IS NULL").
+		Returning("delivered_at").
+		Exec(ctx)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// dispatchResultsChannel is notified with the id of a transaction once the
+// dispatcher attempted its wallet command
+const dispatchResultsChannel = "dispatch_results"
+
+// NotifyDispatchResult wakes up the API requests waiting for the wallet
+// command of a transaction. Within a db transaction the notification is only
+// sent once it commits.
+func (o OutboxProvider) NotifyDispatchResult(ctx context.Context, transactionID uuid.UUID) error {
+	_, err := o.NewRaw("NOTIFY ?, ?", bun.Ident(dispatchResultsChannel), transactionID.String()).Exec(ctx)
+	return err
+}
+
+// ListenDispatchResults returns the ids of the transactions whose wallet
+// command was attempted by a dispatcher of any replica, until ctx is done
+func (o OutboxProvider) ListenDispatchResults(ctx context.Context) <-chan uuid.UUID {
+	return listen(ctx, o.pool, dispatchResultsChannel, uuid.Parse)
+}
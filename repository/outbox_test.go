@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+func TestMarkWalletCommandDelivered(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	tx := createPending(t, repo, createPlayer(t, repo))
+
+	command, err := models.NewWalletCommand(tx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateWalletCommands(ctx, []*models.WalletCommand{command}); err != nil {
+		t.Fatal(err)
+	}
+
+	command.Balance = "990.00"
+	if err := repo.MarkWalletCommandDelivered(ctx, command); err != nil {
+		t.Fatal(err)
+	}
+	// A command delivered again keeps its first delivery
+	again := *command
+	again.Balance = "980.00"
+	if err := repo.MarkWalletCommandDelivered(ctx, &again); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := repo.GetWalletCommandsByTransactionID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].DeliveredAt.IsZero() || stored[0].Balance != "990.00" {
+		t.Errorf("stored commands are %+v, want one delivered with 990.00", stored)
+	}
+}
+
+func TestWalletCommandsRollBackWithTheirTransaction(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+
+	tx := &models.Transaction{
+		PlayerID:  player.ID,
+		Amount:    models.NewAmount(10),
+		Currency:  models.CurrencyUSD,
+		Status:    models.TransactionStatusPending,
+		Type:      models.TransactionTypeWithdraw,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err := repo.WithTx(ctx, func(repo Repository) error {
+		if err := repo.CreateTransaction(ctx, tx); err != nil {
+			return err
+		}
+		command, err := models.NewWalletCommand(tx, nil)
+		if err != nil {
+			return err
+		}
+		if err := repo.CreateWalletCommands(ctx, []*models.WalletCommand{command}); err != nil {
+			return err
+		}
+		// The reference is unique, a second command aborts both
+		command.ID = uuid.Nil
+		return repo.CreateWalletCommands(ctx, []*models.WalletCommand{command})
+	})
+	if err == nil {
+		t.Fatal("a second command with the same reference was saved")
+	}
+
+	if commands, err := repo.GetWalletCommandsByTransactionID(ctx, tx.ID); err != nil || len(commands) != 0 {
+		t.Errorf("commands of a rolled back transaction are %+v, %v", commands, err)
+	}
+}
+
+func TestSettlementOfSeveralBetsHasACommandPerBet(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	tx := createPending(t, repo, createPlayer(t, repo))
+	tx.Type = models.TransactionTypeDeposit
+
+	bets := []*models.SettlementBet{
+		{TransactionID: tx.ID, BetProviderID: 2, Amount: models.NewAmount(5)},
+		{TransactionID: tx.ID, BetProviderID: 1, Amount: models.NewAmount(10)},
+	}
+	if err := repo.CreateSettlementBets(ctx, bets); err != nil {
+		t.Fatal(err)
+	}
+	commands, err := models.NewWalletCommands(tx, nil, bets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateWalletCommands(ctx, commands); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := repo.GetSettlementBets(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 || stored[0].BetProviderID != 1 || stored[1].BetProviderID != 2 {
+		t.Errorf("settlement bets are %+v, want bets 1 and 2", stored)
+	}
+	storedCommands, err := repo.GetWalletCommandsByTransactionID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(storedCommands) != 2 {
+		t.Errorf("settlement has %d commands, want 2", len(storedCommands))
+	}
+}
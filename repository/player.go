@@ -10,10 +10,10 @@ import (
 )
 
 type PlayerProvider struct {
-	*bun.DB
+	bun.IDB
 }
 
-func NewPlayerProvider(db *bun.DB) PlayerProvider {
+func NewPlayerProvider(db bun.IDB) PlayerProvider {
 	return PlayerProvider{db}
 }
 
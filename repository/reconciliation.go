@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+type ReconciliationProvider struct {
+	bun.IDB
+}
+
+func NewReconciliationProvider(db bun.IDB) ReconciliationProvider {
+	return ReconciliationProvider{db}
+}
+
+func (r ReconciliationProvider) CreateReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error {
+	_, err := r.NewInsert().Model(run).Returning("*").Exec(ctx)
+	return err
+}
+
+// FinishReconciliationRun saves the counters of a run and marks it as finished
+func (r ReconciliationProvider) FinishReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error {
+	_, err := r.NewUpdate().
+		Model(run).
+		Column("accounts", "matched", "discrepancies", "skipped", "errors").
+		Set("finished_at = NOW()").
+		WherePK().
+		Returning("finished_at").
+		Exec(ctx)
+	return err
+}
+
+func (r ReconciliationProvider) CreateReconciliationDiscrepancy(ctx context.Context, discrepancy *models.ReconciliationDiscrepancy) error {
+	_, err := r.NewInsert().Model(discrepancy).Returning("*").Exec(ctx)
+	return err
+}
+
+func (r ReconciliationProvider) GetReconciliationRunByID(ctx context.Context, id uuid.UUID) (*models.ReconciliationRun, error) {
+	run := new(models.ReconciliationRun)
+	err := r.NewSelect().
+		Model(run).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("rd.player_id ASC", "rd.currency ASC")
+		}).
+		Where("rr.id = ?", id).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return run, err
+}
+
+// ListReconciliationRuns returns runs newest first, without their discrepancies
+func (r ReconciliationProvider) ListReconciliationRuns(ctx context.Context, limit, offset int) ([]*models.ReconciliationRun, error) {
+	var runs []*models.ReconciliationRun
+	err := r.NewSelect().
+		Model(&runs).
+		Order("rr.started_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(ctx)
+	return runs, err
+}
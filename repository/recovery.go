@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+type RecoveryProvider struct {
+	bun.IDB
+}
+
+func NewRecoveryProvider(db bun.IDB) RecoveryProvider {
+	return RecoveryProvider{db}
+}
+
+// GetStaleTransactions returns up to limit processing transactions whose lease
+// expired (or that were never leased), oldest first. When workerID is set the
+// transactions leased by the workers of workerID are returned as well, they
+// were left behind by a previous run of this process.
+func (r RecoveryProvider) GetStaleTransactions(ctx context.Context, workerID string, limit int) ([]*models.Transaction, error) {
+	var transactions []*models.Transaction
+	err := r.NewSelect().
+		Model(&transactions).
+		Where("status = ?", models.TransactionStatusProcessing).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			q = q.Where("locked_until IS NULL").WhereOr("locked_until < NOW()")
+			if workerID != "" {
+				q = q.WhereOr("split_part(locked_by, '/', 1) = ?", workerID)
+			}
+			return q
+		}).
+		Order("created_at ASC").
+		Limit(limit).
+		Scan(ctx)
+	return transactions, err
+}
+
+// RecoverTransaction atomically saves a recovered transaction (recording it in
+// the ledger when it is confirmed), the transactions it settled and the audit
+// record of the recovery. Nothing is saved and false is returned when the
+// transaction is no longer processing under the lease recorded in recovery,
+// or was saved since it was read, i.e. it was recovered or completed
+// concurrently.
+func (r RecoveryProvider) RecoverTransaction(ctx context.Context, recovery *models.TransactionRecovery, transaction *models.Transaction, settled ...*models.Transaction) (bool, error) {
+	if err := models.ValidateTransition(transaction.Type, models.TransactionStatusProcessing, transaction.Status); err != nil {
+		return false, err
+	}
+	actor := "sweeper:" + recovery.SweptBy
+
+	recovered := false
+	err := r.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewUpdate().
+			Model(transaction).
+			ExcludeColumn("refunded").
+			Value("version", "version + 1").
+			WherePK().
+			Where("version = ?", transaction.Version).
+			Where("status = ?", models.TransactionStatusProcessing).
+			Where("COALESCE(locked_by, '') = ?", recovery.PreviousLockedBy).
+			Where("locked_until IS NOT DISTINCT FROM ?", bun.NullTime{Time: recovery.PreviousLockedUntil}).
+			Returning("version").
+			Scan(ctx)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = recordTransition(ctx, tx, transaction, models.TransactionStatusProcessing, actor, recovery.Reason)
+		if err != nil {
+			return err
+		}
+		if err := postTransaction(ctx, tx, transaction); err != nil {
+			return err
+		}
+
+		for _, s := range settled {
+			if err := updateTransaction(ctx, tx, s, actor, recovery.Reason); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.NewInsert().Model(recovery).Returning("*").Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		recovered = true
+		return nil
+	})
+	return recovered, err
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+type RoundProvider struct {
+	bun.IDB
+}
+
+func NewRoundProvider(db bun.IDB) RoundProvider {
+	return RoundProvider{db}
+}
+
+// OpenRound loads the round of a player with the provider round id of round,
+// creating it when the provider reports it for the first time. Within a db
+// transaction the round stays locked until it commits, so it can't be
+// closed meanwhile.
+func (r RoundProvider) OpenRound(ctx context.Context, round *models.Round) error {
+	return r.NewInsert().
+		Model(round).
+		On("CONFLICT (player_id, provider_round_id) DO UPDATE").
+		Set("game_id = COALESCE(rd.game_id, EXCLUDED.game_id)").
+		Returning("*").
+		Scan(ctx)
+}
+
+// CloseRound closes an open round, a closed round is left as it is. The
+// stored round is loaded in round either way.
+func (r RoundProvider) CloseRound(ctx context.Context, round *models.Round) error {
+	err := r.NewUpdate().
+		Model(round).
+		Set("status = ?", models.RoundStatusClosed).
+		Set("closed_at = NOW()").
+		Set("updated_at = NOW()").
+		WherePK().
+		Where("status = ?", models.RoundStatusOpen).
+		Returning("*").
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return r.NewSelect().Model(round).WherePK().Scan(ctx)
+	}
+	return err
+}
+
+func (r RoundProvider) GetRoundByID(ctx context.Context, id uuid.UUID) (*models.Round, error) {
+	round := new(models.Round)
+	err := r.NewSelect().Model(round).Where("id = ?", id).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return round, err
+}
+
+func (r RoundProvider) GetRoundByProviderID(ctx context.Context, playerID uint64, providerRoundID string) (*models.Round, error) {
+	round := new(models.Round)
+	err := r.NewSelect().
+		Model(round).
+		Where("player_id = ? AND provider_round_id = ?", playerID, providerRoundID).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return round, err
+}
+
+// addRoundTotals adds a confirmed transaction to the totals of its round,
+// see models.RoundTotals
+func addRoundTotals(ctx context.Context, db bun.IDB, transaction, original *models.Transaction) error {
+	if transaction.RoundID == uuid.Nil {
+		return nil
+	}
+
+	bet, won := models.RoundTotals(transaction, original)
+	if bet == 0 && won == 0 {
+		return nil
+	}
+	_, err := db.NewUpdate().
+		Model((*models.Round)(nil)).
+		Set("total_bet = total_bet + ?", bet).
+		Set("total_won = total_won + ?", won).
+		Set("updated_at = NOW()").
+		Where("id = ?", transaction.RoundID).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+func TestOpenRoundReturnsTheStoredRound(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+
+	open := func(gameID string) *models.Round {
+		round := &models.Round{
+			PlayerID:        player.ID,
+			ProviderRoundID: "r-1",
+			GameID:          gameID,
+			Currency:        models.CurrencyUSD,
+			Status:          models.RoundStatusOpen,
+		}
+		if err := repo.OpenRound(ctx, round); err != nil {
+			t.Fatal(err)
+		}
+		return round
+	}
+	first := open("")
+	second := open("starburst")
+	if second.ID != first.ID || second.GameID != "starburst" {
+		t.Errorf("round opened again is %+v, want %s with the game id filled", second, first.ID)
+	}
+
+	if err := repo.CloseRound(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	closedAt := second.ClosedAt
+	if second.Status != models.RoundStatusClosed || closedAt.IsZero() {
+		t.Fatalf("closed round is %+v", second)
+	}
+	// Closing again leaves the round as it is
+	if err := repo.CloseRound(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if !second.ClosedAt.Equal(closedAt) {
+		t.Errorf("round closed at %s, then at %s", closedAt, second.ClosedAt)
+	}
+	// A closed round is returned as it is, the service refuses it
+	if reopened := open(""); reopened.Status != models.RoundStatusClosed {
+		t.Errorf("round opened after its close is %s, want CLOSED", reopened.Status)
+	}
+}
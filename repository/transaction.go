@@ -4,23 +4,48 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jihedmastouri/game-integration-api-demo/models"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
 )
 
 type TransactionProvider struct {
-	*bun.DB
+	bun.IDB
+	// pool is the connection pool behind db, ListenPendingTransactions listens
+	// with it
+	pool *bun.DB
 }
 
-func NewTransactionProvider(db *bun.DB) TransactionProvider {
-	return TransactionProvider{db}
+func NewTransactionProvider(db bun.IDB, pool *bun.DB) TransactionProvider {
+	return TransactionProvider{db, pool}
 }
 
+// CreateTransaction saves a new transaction and starts its status history.
+// Transactions are only created by the API.
 func (t TransactionProvider) CreateTransaction(ctx context.Context, transaction *models.Transaction) error {
-	_, err := t.NewInsert().Model(transaction).Exec(ctx)
-	return err
+	if err := models.ValidateTransition(transaction.Type, "", transaction.Status); err != nil {
+		return err
+	}
+
+	return t.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Timestamps are left to the db, created_at orders the pending queue
+		_, err := tx.NewInsert().
+			Model(transaction).
+			Value("created_at", "DEFAULT").
+			Value("updated_at", "DEFAULT").
+			Returning("*").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return recordTransition(ctx, tx, transaction, "", "api", "")
+	})
 }
 
 func (t TransactionProvider) GetTransactionByProviderID(ctx context.Context, providerID uint64) (*models.Transaction, error) {
@@ -32,9 +57,17 @@ func (t TransactionProvider) GetTransactionByProviderID(ctx context.Context, pro
 	return transaction, err
 }
 
-func (t TransactionProvider) UpdateTransaction(ctx context.Context, transaction *models.Transaction) error {
-	_, err := t.NewUpdate().Model(transaction).WherePK().Exec(ctx)
-	return err
+// UpdateTransaction saves a transaction, and records it in the ledger in the
+// same db transaction once it is confirmed. It fails with
+// models.ErrIllegalTransition when the stored status can't move to the new
+// one, actor is recorded in the status history.
+func (t TransactionProvider) UpdateTransaction(ctx context.Context, transaction *models.Transaction, actor string) error {
+	return t.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := updateTransaction(ctx, tx, transaction, actor, ""); err != nil {
+			return err
+		}
+		return postTransaction(ctx, tx, transaction)
+	})
 }
 
 func (t TransactionProvider) GetTransactionByID(ctx context.Context, id uuid.UUID) (*models.Transaction, error) {
@@ -74,60 +107,426 @@ func (t TransactionProvider) GetFirstPendingTransactionsByPlayerID(ctx context.C
 	return transaction, err
 }
 
-// GetNextProcessableTransaction returns the first pending transaction for a user
-// that doesn't have any other transaction currently being processed
-func (t TransactionProvider) GetNextProcessableTransaction(ctx context.Context) (*models.Transaction, error) {
-	transaction := new(models.Transaction)
-	err := t.NewSelect().
-		Model(transaction).
-		Where("status = ?", models.TransactionStatusPending).
-		Where("player_id NOT IN (SELECT DISTINCT player_id FROM transactions WHERE status = ?)", models.TransactionStatusProcessing).
-		Order("created_at ASC").
-		Limit(1).
-		Scan(ctx)
+// ClaimTransactions atomically claims the next transactions of one player of
+// the shard for owner, oldest first, and marks them as processing until the
+// lease expires. Players are partitioned in shards by id.
+//
+// The player is the one with the oldest transaction due for an attempt, among
+// players without a transaction being processed. Rows locked by another claim
+// are skipped, so several workers (or API replicas) never claim the same
+// player. Processing transactions whose lease expired are left to the sweeper.
+func (t TransactionProvider) ClaimTransactions(ctx context.Context, owner string, shard, shards, limit int, lease time.Duration) ([]*models.Transaction, error) {
+	var transactions []*models.Transaction
+	err := t.NewRaw(`
+		WITH head AS (
+			SELECT t.player_id, t.created_at
+			FROM transactions AS t
+			WHERE mod(t.player_id, ?0) = ?1
+				AND t.status = ?2
+				AND t.next_attempt_at <= NOW()
+				AND NOT EXISTS (
+					SELECT 1 FROM transactions AS p
+					WHERE p.player_id = t.player_id
+						AND p.status = ?2
+						AND p.created_at < t.created_at
+				)
+				AND NOT EXISTS (
+					SELECT 1 FROM transactions AS p
+					WHERE p.player_id = t.player_id
+						AND p.status = ?3
+				)
+			ORDER BY t.created_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		), claimable AS (
+			SELECT t.id
+			FROM transactions AS t, head
+			WHERE t.player_id = head.player_id
+				AND t.created_at >= head.created_at
+				AND t.status = ?2
+			ORDER BY t.created_at ASC
+			LIMIT ?4
+			FOR UPDATE OF t SKIP LOCKED
+		), claimed AS (
+			UPDATE transactions AS t
+			SET status = ?3,
+				version = t.version + 1,
+				locked_by = ?5,
+				locked_until = NOW() + ?6 * INTERVAL '1 millisecond',
+				updated_at = NOW()
+			FROM claimable
+			WHERE t.id = claimable.id
+			RETURNING t.*
+		), history AS (
+			INSERT INTO transaction_transitions (transaction_id, from_status, to_status, actor)
+			SELECT id, ?2, ?3, ?7 FROM claimed
+		)
+		SELECT * FROM claimed`,
+		shards, shard,
+		models.TransactionStatusPending, models.TransactionStatusProcessing,
+		limit, owner, lease.Milliseconds(), "worker:"+owner,
+	).Scan(ctx, &transactions)
 	if err == sql.ErrNoRows {
-		transaction = nil
+		return nil, nil
 	}
-	return transaction, nil
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].CreatedAt.Before(transactions[j].CreatedAt)
+	})
+	return transactions, nil
 }
 
-// StartProcessingTransaction atomically marks a transaction as processing
-func (t TransactionProvider) StartProcessingTransaction(ctx context.Context, transactionID uuid.UUID) error {
-	// Use a db transaction to atomically check and update
-	return t.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
-		// First, verify the transaction is still pending
-		var transaction models.Transaction
-		err := tx.NewSelect().
-			Model(&transaction).
-			Where("id = ? AND status = ?", transactionID, models.TransactionStatusPending).
-			Scan(ctx)
+// ReleaseTransactions puts claimed transactions of owner back in the pending queue
+func (t TransactionProvider) ReleaseTransactions(ctx context.Context, owner string, transactionIDs []uuid.UUID) error {
+	if len(transactionIDs) == 0 {
+		return nil
+	}
 
-		if err != nil {
-			return err
-		}
+	_, err := t.NewRaw(`
+		WITH released AS (
+			UPDATE transactions
+			SET status = ?0,
+				version = version + 1,
+				locked_by = NULL,
+				locked_until = NULL,
+				updated_at = NOW()
+			WHERE id IN (?1)
+				AND status = ?2
+				AND locked_by = ?3
+			RETURNING id
+		)
+		INSERT INTO transaction_transitions (transaction_id, from_status, to_status, actor, reason)
+		SELECT id, ?2, ?0, ?4, ?5 FROM released`,
+		models.TransactionStatusPending, bun.In(transactionIDs),
+		models.TransactionStatusProcessing, owner,
+		"worker:"+owner, "did not fit in the wallet batch",
+	).Exec(ctx)
+	return err
+}
+
+// updateTransaction saves a transaction with a conditional UPDATE, which only
+// matches when the stored version is the one that was read and the stored
+// status can legally move to the new one (see models.CanTransition), and
+// records the change in the status history. The version of transaction is
+// incremented once saved.
+func updateTransaction(ctx context.Context, db bun.IDB, transaction *models.Transaction, actor, reason string) error {
+	previous := models.PreviousStatuses(transaction.Type, transaction.Status)
+	if len(previous) == 0 {
+		return models.ValidateTransition(transaction.Type, "", transaction.Status)
+	}
 
-		// Check if the player has any processing transactions
-		var count int
-		count, err = tx.NewSelect().
+	var from models.TransactionStatus
+	err := db.NewUpdate().
+		With("prev", db.NewSelect().
 			Model((*models.Transaction)(nil)).
-			Where("player_id = ? AND status = ?", transaction.PlayerID, models.TransactionStatusProcessing).
-			Count(ctx)
-		if err != nil {
-			return err
-		}
+			Column("id", "status", "version").
+			Where("id = ?", transaction.ID).
+			For("UPDATE")).
+		Model(transaction).
+		ExcludeColumn("refunded").
+		TableExpr("prev").
+		Value("version", "prev.version + 1").
+		Where("t.id = prev.id").
+		Where("prev.version = ?", transaction.Version).
+		Where("prev.status IN (?)", bun.In(previous)).
+		Returning("prev.status, t.version").
+		Scan(ctx, &from, &transaction.Version)
+	if err == sql.ErrNoRows {
+		return transitionError(ctx, db, transaction)
+	}
+	if err != nil {
+		return err
+	}
 
-		if count > 0 {
-			return fmt.Errorf("player %d already has a transaction being processed", transaction.PlayerID)
-		}
+	if err := recordTransition(ctx, db, transaction, from, actor, reason); err != nil {
+		return err
+	}
+	return adjustRefunded(ctx, db, transaction, from)
+}
 
-		// Update status to processing
-		_, err = tx.NewUpdate().
-			Model(&transaction).
-			Set("status = ?", models.TransactionStatusProcessing).
-			Set("updated_at = NOW()").
-			Where("id = ?", transactionID).
-			Exec(ctx)
+// adjustRefunded gives the part a cancel reserved back to its original
+// transaction when the cancel fails, and reserves it again when a failed
+// cancel is retried or confirmed after all, unless other cancels took it
+func adjustRefunded(ctx context.Context, db bun.IDB, transaction *models.Transaction, from models.TransactionStatus) error {
+	if transaction.Type != models.TransactionTypeCancel {
+		return nil
+	}
+
+	var refunded models.Amount
+	switch {
+	case transaction.Status == models.TransactionStatusFailed && from != models.TransactionStatusFailed:
+		refunded = -transaction.Amount
+	case from == models.TransactionStatusFailed && transaction.Status != models.TransactionStatusFailed:
+		refunded = transaction.Amount
+	default:
+		return nil
+	}
+	res, err := db.NewUpdate().
+		Model((*models.Transaction)(nil)).
+		Set("refunded = refunded + ?", refunded).
+		Where("provider_id = ?", transaction.WithdrawProviderID).
+		Where("refunded + ? <= amount", refunded).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Cancelled meanwhile by other cancels
+		return fmt.Errorf("less than %s is left to cancel of transaction %d", transaction.Amount, transaction.WithdrawProviderID)
+	}
+	return nil
+}
 
+// transitionError tells why updateTransaction didn't match the stored
+// transaction: a *models.VersionConflictError when it was saved by someone
+// else since it was read, models.ErrIllegalTransition otherwise
+func transitionError(ctx context.Context, db bun.IDB, transaction *models.Transaction) error {
+	var (
+		current models.TransactionStatus
+		version int64
+	)
+	err := db.NewSelect().
+		Model((*models.Transaction)(nil)).
+		Column("status", "version").
+		Where("id = ?", transaction.ID).
+		Scan(ctx, &current, &version)
+	if err != nil {
 		return err
+	}
+	if version != transaction.Version {
+		return &models.VersionConflictError{
+			TransactionID: transaction.ID,
+			Version:       transaction.Version,
+			Current:       version,
+		}
+	}
+	return models.ValidateTransition(transaction.Type, current, transaction.Status)
+}
+
+// recordTransition adds the move of a transaction from status from to its
+// current status to the history, nothing is recorded when the status is kept
+func recordTransition(ctx context.Context, db bun.IDB, transaction *models.Transaction, from models.TransactionStatus, actor, reason string) error {
+	if from == transaction.Status {
+		return nil
+	}
+
+	_, err := db.NewInsert().Model(&models.TransactionTransition{
+		TransactionID: transaction.ID,
+		FromStatus:    from,
+		ToStatus:      transaction.Status,
+		Actor:         actor,
+		Reason:        reason,
+	}).Exec(ctx)
+	return err
+}
+
+// pendingTransactionsChannel is notified with the id of a player whose
+// transactions are queued for the worker
+const pendingTransactionsChannel = "pending_transactions"
+
+// NotifyPendingTransactions wakes up the workers listening for the pending
+// transactions of a player. Within a db transaction the notification is only
+// sent once it commits.
+func (t TransactionProvider) NotifyPendingTransactions(ctx context.Context, playerID uint64) error {
+	_, err := t.NewRaw("NOTIFY ?, ?", bun.Ident(pendingTransactionsChannel), strconv.FormatUint(playerID, 10)).Exec(ctx)
+	return err
+}
+
+// ListenPendingTransactions returns the ids of the players whose transactions
+// are queued for the worker, until ctx is done. The listener reconnects on its
+// own when the connection drops, notifications sent meanwhile are lost.
+func (t TransactionProvider) ListenPendingTransactions(ctx context.Context) <-chan uint64 {
+	return listen(ctx, t.pool, pendingTransactionsChannel, func(payload string) (uint64, error) {
+		return strconv.ParseUint(payload, 10, 64)
 	})
 }
+
+// listen returns the payloads notified on channel, parsed with parse, until
+// ctx is done. Payloads that don't parse are skipped, and the ones the reader
+// is too busy to receive are dropped.
+func listen[T any](ctx context.Context, pool *bun.DB, channel string, parse func(payload string) (T, error)) <-chan T {
+	// The listener dials its own connection with the connector of pool, it is
+	// neither taken from the pool nor part of any db transaction
+	ln := pgdriver.NewListener(pool)
+	if err := ln.Listen(ctx, channel); err != nil {
+		slog.Warn("Failed to listen for notifications, retrying in the background", "channel", channel, "error", err)
+	}
+	notifications := ln.Channel()
+
+	values := make(chan T, 100)
+	go func() {
+		defer close(values)
+		defer ln.Close() //nolint:errcheck
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification, ok := <-notifications:
+				if !ok {
+					return
+				}
+				value, err := parse(notification.Payload)
+				if err != nil {
+					continue
+				}
+				select {
+				case values <- value:
+				default: // The reader is busy, it will catch up anyway
+				}
+			}
+		}
+	}()
+	return values
+}
+
+func (t TransactionProvider) CreateTransactionAttempt(ctx context.Context, attempt *models.TransactionAttempt) error {
+	_, err := t.NewInsert().Model(attempt).Exec(ctx)
+	return err
+}
+
+// GetLastTransactionAttempt returns the latest wallet call made for a transaction
+func (t TransactionProvider) GetLastTransactionAttempt(ctx context.Context, transactionID uuid.UUID) (*models.TransactionAttempt, error) {
+	attempt := new(models.TransactionAttempt)
+	err := t.NewSelect().
+		Model(attempt).
+		Where("transaction_id = ?", transactionID).
+		Order("attempted_at DESC", "id DESC").
+		Limit(1).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return attempt, err
+}
+
+// CreateTransactionResponse stores the response first answered for a
+// transaction, a response is never replaced
+func (t TransactionProvider) CreateTransactionResponse(ctx context.Context, response *models.TransactionResponse) error {
+	_, err := t.NewInsert().Model(response).On("CONFLICT (transaction_id) DO NOTHING").Exec(ctx)
+	return err
+}
+
+func (t TransactionProvider) GetTransactionResponse(ctx context.Context, transactionID uuid.UUID) (*models.TransactionResponse, error) {
+	response := new(models.TransactionResponse)
+	err := t.NewSelect().Model(response).Where("transaction_id = ?", transactionID).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return response, err
+}
+
+// TransactionFilter selects transactions of a player for ListTransactions,
+// zero fields don't filter
+type TransactionFilter struct {
+	PlayerID uint64
+	Type     models.TransactionType
+	Status   models.TransactionStatus
+	Currency models.Currency
+	RoundID  uuid.UUID
+	// From and To bound created_at, To is excluded
+	From time.Time
+	To   time.Time
+	// BeforeCreatedAt and BeforeID are the keyset cursor, the last
+	// transaction of the previous page
+	BeforeCreatedAt time.Time
+	BeforeID        uuid.UUID
+	Limit           int
+}
+
+// ListTransactions returns the transactions of a player matching filter,
+// newest first, along with their round
+func (t TransactionProvider) ListTransactions(ctx context.Context, filter TransactionFilter) ([]*models.Transaction, error) {
+	var transactions []*models.Transaction
+	q := t.NewSelect().
+		Model(&transactions).
+		Relation("Round").
+		Where("t.player_id = ?", filter.PlayerID).
+		Order("t.created_at DESC", "t.id DESC").
+		Limit(filter.Limit)
+	if filter.Type != "" {
+		q = q.Where("t.type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		q = q.Where("t.status = ?", filter.Status)
+	}
+	if filter.Currency != "" {
+		q = q.Where("t.currency = ?", filter.Currency)
+	}
+	if filter.RoundID != uuid.Nil {
+		q = q.Where("t.round_id = ?", filter.RoundID)
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("t.created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("t.created_at < ?", filter.To)
+	}
+	if filter.BeforeID != uuid.Nil {
+		q = q.Where("(t.created_at, t.id) < (?::timestamptz, ?::uuid)", filter.BeforeCreatedAt, filter.BeforeID)
+	}
+	err := q.Scan(ctx)
+	return transactions, err
+}
+
+// ReserveRefund reserves amount on the part of original left to cancel, see
+// models.Transaction.Refunded. It returns false when less than amount is left.
+func (t TransactionProvider) ReserveRefund(ctx context.Context, original *models.Transaction, amount models.Amount) (bool, error) {
+	err := t.NewUpdate().
+		Model(original).
+		Set("refunded = refunded + ?", amount).
+		WherePK().
+		Where("refunded + ? <= amount", amount).
+		Returning("refunded").
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetConfirmedRefund returns the part of a transaction its confirmed cancels
+// reversed, unlike Refunded it leaves out the cancels still in flight
+func (t TransactionProvider) GetConfirmedRefund(ctx context.Context, providerID uint64) (models.Amount, error) {
+	var refunded models.Amount
+	err := t.NewSelect().
+		Model((*models.Transaction)(nil)).
+		ColumnExpr("COALESCE(SUM(amount), 0)").
+		Where("withdraw_provider_id = ?", providerID).
+		Where("type = ?", models.TransactionTypeCancel).
+		Where("status = ?", models.TransactionStatusConfirmed).
+		Scan(ctx, &refunded)
+	return refunded, err
+}
+
+// GetTransactionsByRoundID returns the transactions of a round, oldest first
+func (t TransactionProvider) GetTransactionsByRoundID(ctx context.Context, roundID uuid.UUID) ([]*models.Transaction, error) {
+	var transactions []*models.Transaction
+	err := t.NewSelect().
+		Model(&transactions).
+		Where("round_id = ?", roundID).
+		Order("created_at ASC").
+		Scan(ctx)
+	return transactions, err
+}
+
+// CreateSettlementBets saves the bets settled by a settlement of several bets
+func (t TransactionProvider) CreateSettlementBets(ctx context.Context, bets []*models.SettlementBet) error {
+	_, err := t.NewInsert().Model(&bets).Exec(ctx)
+	return err
+}
+
+// GetSettlementBets returns the bets settled by a settlement, none when it
+// settles a single bet
+func (t TransactionProvider) GetSettlementBets(ctx context.Context, transactionID uuid.UUID) ([]*models.SettlementBet, error) {
+	var bets []*models.SettlementBet
+	err := t.NewSelect().
+		Model(&bets).
+		Where("transaction_id = ?", transactionID).
+		Order("bet_provider_id ASC").
+		Scan(ctx)
+	return bets, err
+}
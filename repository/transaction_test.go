@@ -0,0 +1,427 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/uptrace/bun"
+)
+
+// testRepository connects to the postgres of TEST_DATABASE_URL, migrated and
+// emptied. Tests using it are skipped when it is not set, the database is
+// wiped so it must be one set aside for the tests.
+func testRepository(t *testing.T) *RepoPostgresSQLProvider {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	repo, err := Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := repo.db.(*bun.DB)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.ExecContext(context.Background(), "TRUNCATE players, transactions CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func createPlayer(t *testing.T, repo *RepoPostgresSQLProvider) *models.Player {
+	t.Helper()
+	player := &models.Player{Username: "player", Password: "secret"}
+	if err := repo.CreatePlayer(context.Background(), player); err != nil {
+		t.Fatal(err)
+	}
+	return player
+}
+
+// createPending stores a pending bet of a player. created_at is set by the
+// db, the queue follows the order the tests create transactions in.
+func createPending(t *testing.T, repo *RepoPostgresSQLProvider, player *models.Player) *models.Transaction {
+	t.Helper()
+	tx := &models.Transaction{
+		PlayerID: player.ID,
+		Amount:   models.NewAmount(10),
+		Currency: models.CurrencyUSD,
+		Status:   models.TransactionStatusPending,
+		Type:     models.TransactionTypeWithdraw,
+	}
+	if err := repo.CreateTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func claim(t *testing.T, repo *RepoPostgresSQLProvider, owner string, lease time.Duration) []*models.Transaction {
+	t.Helper()
+	claimed, err := repo.ClaimTransactions(context.Background(), owner, 0, 1, 10, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claimed
+}
+
+func assertClaimed(t *testing.T, claimed []*models.Transaction, owner string, want ...*models.Transaction) {
+	t.Helper()
+	if len(claimed) != len(want) {
+		t.Fatalf("%s claimed %d transactions, want %d", owner, len(claimed), len(want))
+	}
+	for i, tx := range claimed {
+		if tx.ID != want[i].ID {
+			t.Errorf("%s claimed %s at %d, want %s", owner, tx.ID, i, want[i].ID)
+		}
+		if tx.Status != models.TransactionStatusProcessing || tx.LockedBy != owner || !tx.LockedUntil.After(time.Now()) {
+			t.Errorf("claimed transaction is %s leased to %q until %s, want PROCESSING leased to %s", tx.Status, tx.LockedBy, tx.LockedUntil, owner)
+		}
+	}
+}
+
+func TestClaimTransactionsTakesOnePlayerAtATime(t *testing.T) {
+	repo := testRepository(t)
+	first, second := createPlayer(t, repo), createPlayer(t, repo)
+
+	oldest := createPending(t, repo, second)
+	bet1 := createPending(t, repo, first)
+	bet2 := createPending(t, repo, first)
+
+	assertClaimed(t, claim(t, repo, "a/0", time.Minute), "a/0", oldest)
+	// The first player is next, the second one is leased
+	assertClaimed(t, claim(t, repo, "b/0", time.Minute), "b/0", bet1, bet2)
+	assertClaimed(t, claim(t, repo, "c/0", time.Minute), "c/0")
+}
+
+func TestClaimTransactionsSkipsLockedRows(t *testing.T) {
+	repo := testRepository(t)
+	first, second := createPlayer(t, repo), createPlayer(t, repo)
+
+	createPending(t, repo, first)
+	other := createPending(t, repo, second)
+
+	// Another claim is holding the rows of the first player
+	db := repo.db.(*bun.DB)
+	locker, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locker.Rollback() //nolint:errcheck
+	if _, err := locker.ExecContext(context.Background(), "SELECT id FROM transactions WHERE player_id = ? FOR UPDATE", first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	assertClaimed(t, claim(t, repo, "a/0", time.Minute), "a/0", other)
+}
+
+func TestClaimTransactionsWaitsForTheOldestTransaction(t *testing.T) {
+	repo := testRepository(t)
+	player := createPlayer(t, repo)
+
+	retried := createPending(t, repo, player)
+	createPending(t, repo, player)
+
+	retried.NextAttemptAt = time.Now().Add(time.Hour)
+	if err := repo.UpdateTransaction(context.Background(), retried, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The later transaction is due but doesn't overtake the first one
+	assertClaimed(t, claim(t, repo, "a/0", time.Minute), "a/0")
+}
+
+func TestClaimTransactionsLeavesExpiredLeasesToTheSweeper(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+	tx := createPending(t, repo, player)
+	createPending(t, repo, player)
+
+	if claimed := claim(t, repo, "a/0", time.Millisecond); len(claimed) != 2 {
+		t.Fatalf("a/0 claimed %d transactions, want 2", len(claimed))
+	}
+	time.Sleep(20 * time.Millisecond)
+	assertClaimed(t, claim(t, repo, "b/0", time.Minute), "b/0")
+
+	stale, err := repo.GetStaleTransactions(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 2 || stale[0].ID != tx.ID {
+		t.Errorf("got %d stale transactions, want the 2 claimed ones oldest first", len(stale))
+	}
+}
+
+func TestGetStaleTransactionsOfAWorker(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+	tx := createPending(t, repo, player)
+	claim(t, repo, "worker/3", time.Minute)
+
+	for workerID, want := range map[string]int{"": 0, "other": 0, "work": 0, "w_rker": 0, "%": 0, "worker": 1} {
+		stale, err := repo.GetStaleTransactions(ctx, workerID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stale) != want {
+			t.Errorf("got %d stale transactions for %q, want %d", len(stale), workerID, want)
+		}
+		if want == 1 && len(stale) == 1 && stale[0].ID != tx.ID {
+			t.Errorf("got stale transaction %s, want %s", stale[0].ID, tx.ID)
+		}
+	}
+}
+
+func TestRecoverTransactionChecksTheLease(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+	createPending(t, repo, player)
+	tx := claim(t, repo, "a/0", time.Minute)[0]
+
+	recovery := &models.TransactionRecovery{
+		TransactionID:       tx.ID,
+		PlayerID:            tx.PlayerID,
+		PreviousLockedBy:    "b/0",
+		PreviousLockedUntil: tx.LockedUntil,
+		Decision:            models.RecoveryDecisionRequeued,
+		Status:              models.TransactionStatusPending,
+		Reason:              "test",
+		SweptBy:             "test",
+	}
+	recovered := *tx
+	recovered.Status = models.TransactionStatusPending
+	recovered.LockedBy = ""
+	recovered.LockedUntil = time.Time{}
+
+	// Another worker holds the lease, the recovery is outdated
+	ok, err := repo.RecoverTransaction(ctx, recovery, &recovered)
+	if err != nil || ok {
+		t.Fatalf("recovered a transaction under another lease: %t, %v", ok, err)
+	}
+
+	recovery.PreviousLockedBy = "a/0"
+	ok, err = repo.RecoverTransaction(ctx, recovery, &recovered)
+	if err != nil || !ok {
+		t.Fatalf("recovery under the lease found failed: %t, %v", ok, err)
+	}
+	stored, err := repo.GetTransactionByID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.TransactionStatusPending || stored.LockedBy != "" {
+		t.Errorf("recovered transaction is %s leased to %q", stored.Status, stored.LockedBy)
+	}
+}
+
+func TestReleaseTransactions(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+	tx := createPending(t, repo, player)
+	claim(t, repo, "a/0", time.Minute)
+
+	// Only the owner of the lease can release it
+	if err := repo.ReleaseTransactions(ctx, "b/0", []uuid.UUID{tx.ID}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.GetTransactionByID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.TransactionStatusProcessing || stored.LockedBy != "a/0" {
+		t.Fatalf("transaction is %s leased to %q after another owner released it", stored.Status, stored.LockedBy)
+	}
+
+	if err := repo.ReleaseTransactions(ctx, "a/0", []uuid.UUID{tx.ID}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = repo.GetTransactionByID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.TransactionStatusPending || stored.LockedBy != "" || !stored.LockedUntil.IsZero() {
+		t.Errorf("released transaction is %s leased to %q until %s", stored.Status, stored.LockedBy, stored.LockedUntil)
+	}
+}
+
+func TestConcurrentClaimsNeverShareAPlayer(t *testing.T) {
+	repo := testRepository(t)
+
+	for range 5 {
+		player := createPlayer(t, repo)
+		for range 3 {
+			createPending(t, repo, player)
+		}
+	}
+
+	var mu sync.Mutex
+	owners := make(map[uint64]string)
+	claimedIDs := make(map[uuid.UUID]bool)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			owner := fmt.Sprintf("worker-%d/0", i)
+			claimed, err := repo.ClaimTransactions(context.Background(), owner, 0, 1, 10, time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, tx := range claimed {
+				if previous, ok := owners[tx.PlayerID]; ok && previous != owner {
+					t.Errorf("player %d was claimed by %s and %s", tx.PlayerID, previous, owner)
+				}
+				if claimedIDs[tx.ID] {
+					t.Errorf("transaction %s was claimed twice", tx.ID)
+				}
+				owners[tx.PlayerID] = owner
+				claimedIDs[tx.ID] = true
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNotifyPendingTransactions(t *testing.T) {
+	repo := testRepository(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	players := repo.ListenPendingTransactions(ctx)
+	if err := repo.NotifyPendingTransactions(ctx, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case playerID := <-players:
+		if playerID != 42 {
+			t.Errorf("notified player %d, want 42", playerID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification was not received")
+	}
+
+	cancel()
+	for range players {
+	}
+}
+
+func TestUpdateTransactionDetectsStaleCopies(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	tx := createPending(t, repo, createPlayer(t, repo))
+
+	stale, err := repo.GetTransactionByID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Status = models.TransactionStatusConfirmed
+	if err := repo.UpdateTransaction(ctx, tx, "api"); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Version != stale.Version+1 {
+		t.Errorf("saved version is %d, want %d", tx.Version, stale.Version+1)
+	}
+
+	// Confirming is legal from the stale status, only the version tells
+	stale.Status = models.TransactionStatusConfirmed
+	err = repo.UpdateTransaction(ctx, stale, "api")
+	var conflict *models.VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Current != tx.Version {
+		t.Fatalf("saving a stale copy returned %v, want a conflict with version %d", err, tx.Version)
+	}
+}
+
+func TestTransactionResponseIsNeverReplaced(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	tx := createPending(t, repo, createPlayer(t, repo))
+
+	for _, response := range []string{`{"status":"PENDING"}`, `{"status":"CONFIRMED"}`} {
+		err := repo.CreateTransactionResponse(ctx, &models.TransactionResponse{TransactionID: tx.ID, Response: []byte(response)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := repo.GetTransactionResponse(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || string(stored.Response) != `{"status": "PENDING"}` {
+		t.Errorf("stored response is %+v, want the first one", stored)
+	}
+}
+
+func TestReserveRefund(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	tx := createPending(t, repo, createPlayer(t, repo))
+
+	for _, reservation := range []struct {
+		amount models.Amount
+		want   bool
+	}{
+		{amount: models.NewAmount(4), want: true},
+		{amount: models.NewAmount(7), want: false},
+		{amount: models.NewAmount(6), want: true},
+		{amount: models.NewAmount(1), want: false},
+	} {
+		reserved, err := repo.ReserveRefund(ctx, tx, reservation.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reserved != reservation.want {
+			t.Errorf("reserving %s returned %t, want %t", reservation.amount, reserved, reservation.want)
+		}
+	}
+	if tx.Refunded != tx.Amount {
+		t.Errorf("transaction has %s refunded, want %s", tx.Refunded, tx.Amount)
+	}
+}
+
+func TestListTransactionsKeysetPages(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	player := createPlayer(t, repo)
+
+	var created []*models.Transaction
+	for range 3 {
+		created = append(created, createPending(t, repo, player))
+	}
+
+	filter := TransactionFilter{PlayerID: player.ID, Limit: 2}
+	first, err := repo.ListTransactions(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first[0].ID != created[2].ID || first[1].ID != created[1].ID {
+		t.Fatalf("first page has %d transactions, want the 2 newest", len(first))
+	}
+
+	last := first[len(first)-1]
+	filter.BeforeCreatedAt, filter.BeforeID = last.CreatedAt, last.ID
+	second, err := repo.ListTransactions(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 1 || second[0].ID != created[0].ID {
+		t.Errorf("second page has %d transactions, want the oldest", len(second))
+	}
+}
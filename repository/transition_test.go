@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+// history returns the status history of a transaction, oldest first
+func history(t *testing.T, repo *RepoPostgresSQLProvider, tx *models.Transaction) []models.TransactionTransition {
+	t.Helper()
+	var transitions []models.TransactionTransition
+	err := repo.TransactionRepository.(TransactionProvider).NewSelect().
+		Model(&transitions).
+		Where("transaction_id = ?", tx.ID).
+		Order("id ASC").
+		Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transitions
+}
+
+func TestUpdateTransactionChecksTheTransition(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	tx := createPending(t, repo, createPlayer(t, repo))
+
+	tx.Status = models.TransactionStatusConfirmed
+	if err := repo.UpdateTransaction(ctx, tx, "worker:a/0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A confirmed bet can only be finalized
+	tx.Status = models.TransactionStatusPending
+	if err := repo.UpdateTransaction(ctx, tx, "worker:a/0"); !errors.Is(err, models.ErrIllegalTransition) {
+		t.Fatalf("moving a confirmed bet back to pending returned %v, want ErrIllegalTransition", err)
+	}
+	stored, err := repo.GetTransactionByID(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.TransactionStatusConfirmed {
+		t.Errorf("stored status is %s after an illegal transition, want CONFIRMED", stored.Status)
+	}
+}
+
+func TestTransitionsAreRecorded(t *testing.T) {
+	repo := testRepository(t)
+	tx := createPending(t, repo, createPlayer(t, repo))
+
+	claim(t, repo, "a/0", time.Minute)
+	if err := repo.ReleaseTransactions(context.Background(), "a/0", []uuid.UUID{tx.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		from, to models.TransactionStatus
+		actor    string
+	}{
+		{"", models.TransactionStatusPending, "api"},
+		{models.TransactionStatusPending, models.TransactionStatusProcessing, "worker:a/0"},
+		{models.TransactionStatusProcessing, models.TransactionStatusPending, "worker:a/0"},
+	}
+	got := history(t, repo, tx)
+	if len(got) != len(want) {
+		t.Fatalf("history has %d transitions, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].FromStatus != w.from || got[i].ToStatus != w.to || got[i].Actor != w.actor {
+			t.Errorf("transition %d is %s -> %s by %q, want %s -> %s by %q",
+				i, got[i].FromStatus, got[i].ToStatus, got[i].Actor, w.from, w.to, w.actor)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// assertRefunded checks the part of a transaction reserved by its cancels
+func assertRefunded(t *testing.T, repo *memoryRepository, providerID uint64, want models.Amount) {
+	t.Helper()
+	if got := storedTransaction(t, repo, providerID).Refunded; got != want {
+		t.Errorf("transaction %d has %s refunded, want %s", providerID, got, want)
+	}
+}
+
+func TestCancelReservesTheRefund(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+
+	if _, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// Reserved while the cancel is still pending
+	assertRefunded(t, repo, 1, models.NewAmount(100))
+	if _, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1}); !errors.Is(err, ErrRefundExceeded) {
+		t.Errorf("second cancel returned %v, want ErrRefundExceeded", err)
+	}
+
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFinalized)
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestFailedCancelGivesItsRefundBack(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+
+	resp, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet.FailAlways(walletclient.FakeMethodDeposit, "WALLET_DOWN")
+	dispatch(t, s)
+
+	cancel, err := repo.GetTransactionByID(ctx, resp.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, cancel, models.TransactionStatusFailed)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertRefunded(t, repo, 1, 0)
+	assertBalance(t, wallet, models.NewAmount(900))
+}
+
+// setNextAttemptAt sets when the worker attempts a stored transaction next
+func setNextAttemptAt(repo *memoryRepository, providerID uint64, at time.Time) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, tx := range repo.transactions {
+		if tx.ProviderID == providerID {
+			tx.NextAttemptAt = at
+		}
+	}
+}
+
+func TestFailedPartialCancelLeavesTheBetCancellable(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+
+	for _, rollbackID := range []uint64{10, 11} {
+		_, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1, ProviderRollbackID: rollbackID, Amount: models.NewAmount(50)})
+		if err != nil {
+			t.Fatalf("partial cancel %d: %v", rollbackID, err)
+		}
+	}
+
+	// The first cancel reaches the wallet while the second one waits
+	setNextAttemptAt(repo, 11, time.Now().Add(time.Hour))
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 10), models.TransactionStatusConfirmed)
+	// The second cancel only reserved the rest of the bet
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+
+	wallet.FailAlways(walletclient.FakeMethodDeposit, "WALLET_DOWN")
+	setNextAttemptAt(repo, 11, time.Now())
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 11), models.TransactionStatusFailed)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertRefunded(t, repo, 1, models.NewAmount(50))
+
+	wallet.ClearFailures()
+	if _, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1, ProviderRollbackID: 12}); err != nil {
+		t.Fatalf("cancel of what the failed cancel gave back: %v", err)
+	}
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFinalized)
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestPartialCancels(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+
+	first, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1, ProviderRollbackID: 10, Amount: models.NewAmount(40)})
+	if err != nil {
+		t.Fatalf("first partial cancel: %v", err)
+	}
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 10), models.TransactionStatusConfirmed)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(940))
+
+	retried, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1, ProviderRollbackID: 10, Amount: models.NewAmount(40)})
+	if err != nil {
+		t.Fatalf("retried partial cancel: %v", err)
+	}
+	if retried.TransactionID != first.TransactionID {
+		t.Errorf("retried cancel is transaction %s, want %s", retried.TransactionID, first.TransactionID)
+	}
+
+	_, err = s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1, ProviderRollbackID: 11, Amount: models.NewAmount(70)})
+	if !errors.Is(err, ErrRefundExceeded) {
+		t.Errorf("cancelling more than is left: got %v, want %v", err, ErrRefundExceeded)
+	}
+
+	if _, err := s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1, ProviderRollbackID: 12}); err != nil {
+		t.Fatalf("cancel of what is left: %v", err)
+	}
+	dispatch(t, s)
+	if cancel := storedTransaction(t, repo, 12); cancel.Amount != models.NewAmount(60) {
+		t.Errorf("cancel of what is left is for %s, want 60.00", cancel.Amount)
+	}
+	bet := storedTransaction(t, repo, 1)
+	assertStatus(t, bet, models.TransactionStatusFinalized)
+	if bet.Refunded != bet.Amount {
+		t.Errorf("bet has %s refunded, want %s", bet.Refunded, bet.Amount)
+	}
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestRollbackRound(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	for i, amount := range []models.Amount{models.NewAmount(100), models.NewAmount(50)} {
+		_, err := s.ProcessBet(ctx, testPlayer, shared.WithdrawRequest{
+			Currency:              models.CurrencyUSD,
+			Amount:                amount,
+			ProviderTransactionID: uint64(i + 1),
+			RoundRequest:          shared.RoundRequest{RoundID: "r-1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dispatch(t, s)
+	_, err := s.ProcessSettle(ctx, testPlayer, shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		Amount:                         models.NewAmount(30),
+		ProviderTransactionID:          3,
+		ProviderWithdrawnTransactionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+	assertBalance(t, wallet, models.NewAmount(880))
+
+	resp, err := s.RollbackRound(ctx, testPlayer, shared.RollbackRoundRequest{RoundID: "r-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cancelled []uint64
+	for _, cancel := range resp.Cancels {
+		cancelled = append(cancelled, cancel.ProviderTransactionID)
+	}
+	if len(cancelled) != 3 || cancelled[0] != 1 || cancelled[1] != 2 || cancelled[2] != 3 {
+		t.Fatalf("rollback cancelled %v, want 1, 2 and 3 in order", cancelled)
+	}
+
+	dispatch(t, s)
+	for providerID := uint64(1); providerID <= 3; providerID++ {
+		assertStatus(t, storedTransaction(t, repo, providerID), models.TransactionStatusFinalized)
+	}
+	assertBalance(t, wallet, models.NewAmount(1000))
+
+	round, err := repo.GetRoundByProviderID(ctx, testPlayer.ID, "r-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round.TotalBet != 0 || round.TotalWon != 0 {
+		t.Errorf("rolled back round has %s bet and %s won, want nothing", round.TotalBet, round.TotalWon)
+	}
+
+	// Nothing is left to roll back
+	again, err := s.RollbackRound(ctx, testPlayer, shared.RollbackRoundRequest{RoundID: "r-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Cancels) != 0 {
+		t.Errorf("second rollback cancelled %d transactions, want none", len(again.Cancels))
+	}
+}
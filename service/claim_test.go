@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+func TestWorkerReleasesTransactionsOutsideTheBatch(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(5000))
+	placeBet(t, s, 2, models.NewAmount(10))
+	resp, err := s.ProcessCancel(context.Background(), testPlayer, shared.CancelRequest{ProviderTransactionID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The claim takes the bets and the cancel, the cancel doesn't fit in the
+	// withdraw batch and is released to be claimed after it
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(10000))
+	dispatch(t, s)
+
+	cancel, err := repo.GetTransactionByID(context.Background(), resp.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, cancel, models.TransactionStatusConfirmed)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertStatus(t, storedTransaction(t, repo, 2), models.TransactionStatusFinalized)
+	for _, tx := range []*models.Transaction{cancel, storedTransaction(t, repo, 1)} {
+		if tx.LockedBy != "" || !tx.LockedUntil.IsZero() {
+			t.Errorf("transaction %s is still leased to %q", tx.ID, tx.LockedBy)
+		}
+	}
+	assertBalance(t, wallet, models.NewAmount(5000))
+}
+
+func TestWorkerSkipsPlayersLeasedByAnotherWorker(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(5000))
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(10000))
+
+	claimed, err := repo.ClaimTransactions(ctx, "other/0", 0, 1, 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("claimed %d transactions (%v), want the bet", len(claimed), err)
+	}
+	dispatch(t, s)
+
+	bet := storedTransaction(t, repo, 1)
+	assertStatus(t, bet, models.TransactionStatusProcessing)
+	if bet.LockedBy != "other/0" {
+		t.Errorf("bet is leased to %q, want other/0", bet.LockedBy)
+	}
+	assertBalance(t, wallet, models.NewAmount(10000))
+}
+
+func TestWorkerLeavesExpiredLeasesToTheSweeper(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(5000))
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(10000))
+
+	// The other worker died holding a lease that is already over
+	if _, err := repo.ClaimTransactions(ctx, "other/0", 0, 1, 10, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusProcessing)
+
+	s.sweepStaleTransactions(ctx, "")
+	dispatch(t, s)
+
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(5000))
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrDeadLetterClosed   = errors.New("dead letter is already requeued or resolved")
+	ErrReasonRequired     = errors.New("a reason is required")
+	ErrInvalidResolution  = errors.New("a dead letter can only be resolved as CONFIRMED or FAILED")
+
+	// errNotConfirmed is recorded when the wallet answered a batch without
+	// acknowledging one of its transactions
+	errNotConfirmed = errors.New("NOT_CONFIRMED")
+)
+
+// deadLetter marks a transaction as failed and records it in the dead
+// letters, along with the last error the wallet returned for it
+func (s *Service) deadLetter(ctx context.Context, tx *models.Transaction, reason string) {
+	deadLetter := &models.DeadLetter{
+		TransactionID: tx.ID,
+		PlayerID:      tx.PlayerID,
+		Reason:        reason,
+		Status:        models.DeadLetterStatusOpen,
+	}
+
+	lastAttempt, err := s.Repository.GetLastTransactionAttempt(ctx, tx.ID)
+	if err != nil {
+		slog.Error("Failed to get last transaction attempt", "error", err, "transaction_id", tx.ID)
+	}
+	if lastAttempt != nil {
+		deadLetter.LastErrorCode = lastAttempt.ErrorCode
+	}
+
+	// Transactions are dead lettered by the worker holding them
+	actor := "worker:" + tx.LockedBy
+
+	tx.Status = models.TransactionStatusFailed
+	tx.LockedBy = ""
+	tx.LockedUntil = time.Time{}
+	if err := s.Repository.DeadLetterTransaction(ctx, tx, deadLetter, actor); err != nil {
+		slog.Error("Failed to dead letter transaction", "error", err, "transaction_id", tx.ID)
+		return
+	}
+	// The request waiting for the transaction, if any, answers with the failure
+	if err := s.Repository.NotifyDispatchResult(ctx, tx.ID); err != nil {
+		slog.Warn("Failed to notify dispatch result", "error", err, "transaction_id", tx.ID)
+	}
+
+	slog.Warn("Transaction moved to dead letters", "transaction_id", tx.ID, "dead_letter_id", deadLetter.ID, "reason", reason, "last_error_code", deadLetter.LastErrorCode)
+}
+
+// recordWalletAttempt keeps track of a wallet call made for a transaction.
+// Failing to record it is logged but never fails the operation itself.
+func (s *Service) recordWalletAttempt(ctx context.Context, txID uuid.UUID, op models.TransactionType, req any, callErr error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		slog.Error("Failed to encode wallet attempt", "error", err, "transaction_id", txID)
+		return
+	}
+
+	attempt := &models.TransactionAttempt{
+		TransactionID: txID,
+		Operation:     op,
+		Payload:       payload,
+		ErrorCode:     walletErrorCode(callErr),
+	}
+	if callErr != nil {
+		attempt.Error = callErr.Error()
+	}
+
+	if err := s.Repository.CreateTransactionAttempt(ctx, attempt); err != nil {
+		slog.Error("Failed to record wallet attempt", "error", err, "transaction_id", txID)
+	}
+}
+
+// walletErrorCode returns the wallet error code of err, or a code describing
+// why the wallet could not be reached
+func walletErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var walletErr *walletclient.ErrorResponse
+	switch {
+	case errors.As(err, &walletErr):
+		return walletErr.Code
+	case errors.Is(err, walletclient.ErrCircuitOpen), errors.Is(err, errNotConfirmed):
+		return err.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "WALLET_TIMEOUT"
+	}
+	return "WALLET_UNAVAILABLE"
+}
+
+func (s *Service) ListDeadLetters(ctx context.Context, status models.DeadLetterStatus, limit, offset int) ([]shared.DeadLetterResponse, error) {
+	deadLetters, err := s.Repository.ListDeadLetters(ctx, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	resp := make([]shared.DeadLetterResponse, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		resp = append(resp, deadLetterResponse(deadLetter))
+	}
+	return resp, nil
+}
+
+func (s *Service) GetDeadLetter(ctx context.Context, id uuid.UUID) (*shared.DeadLetterResponse, error) {
+	deadLetter, err := s.getDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := deadLetterResponse(deadLetter)
+	return &resp, nil
+}
+
+// RequeueDeadLetter puts a dead lettered transaction back in the pending
+// queue with a fresh retry budget
+func (s *Service) RequeueDeadLetter(ctx context.Context, id uuid.UUID, req shared.RequeueDeadLetterRequest) (*shared.DeadLetterResponse, error) {
+	if strings.TrimSpace(req.Reason) == "" {
+		return nil, ErrReasonRequired
+	}
+
+	deadLetter, err := s.getDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if deadLetter.Status != models.DeadLetterStatusOpen {
+		return nil, ErrDeadLetterClosed
+	}
+
+	tx := deadLetter.Transaction
+	tx.Status = models.TransactionStatusPending
+	tx.Attempts = 0
+	tx.NextAttemptAt = time.Now()
+
+	closeDeadLetter(deadLetter, models.DeadLetterStatusRequeued, models.TransactionStatusPending, req.Reason, req.Operator)
+	if err := s.Repository.CloseDeadLetter(ctx, deadLetter, tx); err != nil {
+		return nil, fmt.Errorf("failed to requeue dead letter: %w", err)
+	}
+
+	s.notifyPending(ctx, tx)
+
+	slog.Info("Dead letter requeued", "dead_letter_id", deadLetter.ID, "transaction_id", tx.ID, "operator", req.Operator, "reason", req.Reason)
+
+	resp := deadLetterResponse(deadLetter)
+	return &resp, nil
+}
+
+// ResolveDeadLetter forces the final status of a dead lettered transaction,
+// once an operator checked what the wallet actually did with it. Confirming it
+// marks its wallet commands as delivered, and for a settlement or a cancel
+// finalizes the transactions it settled.
+func (s *Service) ResolveDeadLetter(ctx context.Context, id uuid.UUID, req shared.ResolveDeadLetterRequest) (*shared.DeadLetterResponse, error) {
+	if strings.TrimSpace(req.Reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	if req.Status != models.TransactionStatusConfirmed && req.Status != models.TransactionStatusFailed {
+		return nil, ErrInvalidResolution
+	}
+
+	deadLetter, err := s.getDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if deadLetter.Status != models.DeadLetterStatusOpen {
+		return nil, ErrDeadLetterClosed
+	}
+
+	tx := deadLetter.Transaction
+	tx.Status = req.Status
+	changed := []*models.Transaction{tx}
+
+	var commands []*models.WalletCommand
+	if req.Status == models.TransactionStatusConfirmed {
+		// Marked delivered without a balance, the player's later transactions
+		// may have moved it since the wallet took this one
+		commands, err = s.Repository.GetWalletCommandsByTransactionID(ctx, tx.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get wallet commands: %w", err)
+		}
+
+		settles, err := s.settledTransactions(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		if tx.Type == models.TransactionTypeCancel {
+			// The failed cancel gave its part back, it is reserved again once confirmed
+			for _, settled := range settles {
+				settled.Refunded += tx.Amount
+			}
+		}
+		finalized, err := finalizedBy(ctx, s.Repository, tx, settles)
+		if err != nil {
+			return nil, err
+		}
+		for _, settled := range finalized {
+			settled.Status = models.TransactionStatusFinalized
+			changed = append(changed, settled)
+		}
+	}
+
+	closeDeadLetter(deadLetter, models.DeadLetterStatusResolved, req.Status, req.Reason, req.Operator)
+	err = s.Repository.WithTx(ctx, func(repo repository.Repository) error {
+		if err := repo.CloseDeadLetter(ctx, deadLetter, changed...); err != nil {
+			return err
+		}
+		return markDelivered(ctx, repo, commands)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dead letter: %w", err)
+	}
+
+	slog.Info("Dead letter resolved", "dead_letter_id", deadLetter.ID, "transaction_id", tx.ID, "status", req.Status, "operator", req.Operator, "reason", req.Reason)
+
+	resp := deadLetterResponse(deadLetter)
+	return &resp, nil
+}
+
+func (s *Service) getDeadLetter(ctx context.Context, id uuid.UUID) (*models.DeadLetter, error) {
+	deadLetter, err := s.Repository.GetDeadLetterByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+	if deadLetter == nil || deadLetter.Transaction == nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	return deadLetter, nil
+}
+
+func closeDeadLetter(deadLetter *models.DeadLetter, status models.DeadLetterStatus, resolution models.TransactionStatus, reason, operator string) {
+	deadLetter.Status = status
+	deadLetter.Resolution = resolution
+	deadLetter.ResolutionReason = reason
+	deadLetter.ResolvedBy = operator
+	deadLetter.ResolvedAt = time.Now()
+}
+
+func deadLetterResponse(deadLetter *models.DeadLetter) shared.DeadLetterResponse {
+	resp := shared.DeadLetterResponse{
+		ID:               deadLetter.ID,
+		TransactionID:    deadLetter.TransactionID,
+		PlayerID:         deadLetter.PlayerID,
+		Reason:           deadLetter.Reason,
+		LastErrorCode:    deadLetter.LastErrorCode,
+		Status:           deadLetter.Status,
+		Resolution:       deadLetter.Resolution,
+		ResolutionReason: deadLetter.ResolutionReason,
+		ResolvedBy:       deadLetter.ResolvedBy,
+		CreatedAt:        deadLetter.CreatedAt,
+	}
+	if !deadLetter.ResolvedAt.IsZero() {
+		resp.ResolvedAt = &deadLetter.ResolvedAt
+	}
+
+	if tx := deadLetter.Transaction; tx != nil {
+		resp.ProviderTransactionID = tx.ProviderID
+		if tx.Type == models.TransactionTypeCancel {
+			resp.ProviderTransactionID = tx.WithdrawProviderID
+		}
+		resp.TransactionType = tx.Type
+		resp.TransactionStatus = tx.Status
+		resp.Amount = tx.Amount
+		resp.Currency = tx.Currency
+	}
+
+	for _, attempt := range deadLetter.Attempts {
+		resp.Attempts = append(resp.Attempts, shared.TransactionAttemptResponse{
+			Operation:   attempt.Operation,
+			Payload:     attempt.Payload,
+			ErrorCode:   attempt.ErrorCode,
+			Error:       attempt.Error,
+			AttemptedAt: attempt.AttemptedAt,
+		})
+	}
+
+	return resp
+}
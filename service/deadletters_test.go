@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// deadLetterBet places a bet the wallet can't pay and runs the worker until
+// the bet is dead lettered
+func deadLetterBet(t *testing.T, s *Service, providerID uint64) *shared.DeadLetterResponse {
+	t.Helper()
+
+	placeBet(t, s, providerID, models.NewAmount(5000))
+	dispatch(t, s)
+
+	deadLetters, err := s.ListDeadLetters(context.Background(), models.DeadLetterStatusOpen, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, deadLetter := range deadLetters {
+		if deadLetter.ProviderTransactionID == providerID {
+			resp, err := s.GetDeadLetter(context.Background(), deadLetter.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		}
+	}
+	t.Fatalf("bet %d was not dead lettered", providerID)
+	return nil
+}
+
+func TestExhaustedTransactionIsDeadLettered(t *testing.T) {
+	s, repo, _ := newTestService(t)
+
+	deadLetter := deadLetterBet(t, s, 1)
+
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFailed)
+	if deadLetter.LastErrorCode != walletclient.ErrCodeInsufficientFunds {
+		t.Errorf("dead letter has last error %q, want %s", deadLetter.LastErrorCode, walletclient.ErrCodeInsufficientFunds)
+	}
+	if want := retryPolicy(models.TransactionTypeWithdraw).MaxAttempts; len(deadLetter.Attempts) != want {
+		t.Errorf("dead letter has %d attempts, want %d", len(deadLetter.Attempts), want)
+	}
+	if deadLetter.Amount != models.NewAmount(5000) {
+		t.Errorf("dead letter is for %s, want 5000.00", deadLetter.Amount)
+	}
+	if deadLetter.TransactionStatus != models.TransactionStatusFailed || deadLetter.Status != models.DeadLetterStatusOpen {
+		t.Errorf("dead letter is %s for a %s transaction, want OPEN for a FAILED one", deadLetter.Status, deadLetter.TransactionStatus)
+	}
+}
+
+func TestRequeueDeadLetter(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	deadLetter := deadLetterBet(t, s, 1)
+
+	_, err := s.RequeueDeadLetter(context.Background(), deadLetter.ID, shared.RequeueDeadLetterRequest{})
+	if !errors.Is(err, ErrReasonRequired) {
+		t.Fatalf("requeue without a reason: got %v, want ErrReasonRequired", err)
+	}
+
+	resp, err := s.RequeueDeadLetter(context.Background(), deadLetter.ID, shared.RequeueDeadLetterRequest{
+		Reason:   "player topped up",
+		Operator: "ops",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != models.DeadLetterStatusRequeued || resp.ResolvedAt == nil {
+		t.Errorf("dead letter is %s, want REQUEUED", resp.Status)
+	}
+
+	bet := storedTransaction(t, repo, 1)
+	assertStatus(t, bet, models.TransactionStatusPending)
+	if bet.Attempts != 0 {
+		t.Errorf("requeued bet has %d attempts, want a fresh budget", bet.Attempts)
+	}
+
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(10000))
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(5000))
+
+	_, err = s.RequeueDeadLetter(context.Background(), deadLetter.ID, shared.RequeueDeadLetterRequest{Reason: "again"})
+	if !errors.Is(err, ErrDeadLetterClosed) {
+		t.Errorf("second requeue: got %v, want ErrDeadLetterClosed", err)
+	}
+}
+
+func TestResolveDeadLetter(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	deadLetter := deadLetterBet(t, s, 1)
+
+	_, err := s.ResolveDeadLetter(context.Background(), deadLetter.ID, shared.ResolveDeadLetterRequest{
+		Status: models.TransactionStatusPending,
+		Reason: "checked the wallet",
+	})
+	if !errors.Is(err, ErrInvalidResolution) {
+		t.Fatalf("resolve as PENDING: got %v, want ErrInvalidResolution", err)
+	}
+
+	resp, err := s.ResolveDeadLetter(context.Background(), deadLetter.ID, shared.ResolveDeadLetterRequest{
+		Status:   models.TransactionStatusConfirmed,
+		Reason:   "the wallet took the bet",
+		Operator: "ops",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != models.DeadLetterStatusResolved || resp.Resolution != models.TransactionStatusConfirmed {
+		t.Errorf("dead letter is %s as %s, want RESOLVED as CONFIRMED", resp.Status, resp.Resolution)
+	}
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	if command := walletCommand(t, s, repo, 1); command.DeliveredAt.IsZero() {
+		t.Error("command of the resolved bet is not delivered")
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// dispatchWaiters are the API requests waiting for the dispatcher to attempt
+// the wallet command of their transaction
+type dispatchWaiters struct {
+	mu      sync.Mutex
+	waiters map[uuid.UUID][]chan struct{}
+}
+
+func newDispatchWaiters() *dispatchWaiters {
+	return &dispatchWaiters{waiters: make(map[uuid.UUID][]chan struct{})}
+}
+
+// add returns a channel closed once the wallet command of a transaction was attempted
+func (d *dispatchWaiters) add(transactionID uuid.UUID) chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	done := make(chan struct{})
+	d.waiters[transactionID] = append(d.waiters[transactionID], done)
+	return done
+}
+
+// remove forgets a waiter that gave up
+func (d *dispatchWaiters) remove(transactionID uuid.UUID, done chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	waiters := d.waiters[transactionID]
+	for i, waiter := range waiters {
+		if waiter == done {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(d.waiters, transactionID)
+	} else {
+		d.waiters[transactionID] = waiters
+	}
+}
+
+// wake releases the waiters of a transaction
+func (d *dispatchWaiters) wake(transactionID uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, done := range d.waiters[transactionID] {
+		close(done)
+	}
+	delete(d.waiters, transactionID)
+}
+
+// listenDispatchResults wakes up the requests waiting for a transaction
+// attempted by the dispatcher of any replica, until ctx is done
+func (s *Service) listenDispatchResults(ctx context.Context) {
+	for transactionID := range s.Repository.ListenDispatchResults(ctx) {
+		s.dispatches.wake(transactionID)
+	}
+}
+
+// queueTransaction creates a pending transaction and writes its wallet
+// commands to the outbox, in the db transaction of repo. A cancel first
+// reserves its amount on original, so cancels never reverse more than it.
+func queueTransaction(ctx context.Context, repo repository.Repository, tx, original *models.Transaction, bets []*models.SettlementBet) error {
+	if tx.Type == models.TransactionTypeCancel {
+		reserved, err := repo.ReserveRefund(ctx, original, tx.Amount)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			return fmt.Errorf("%w: less than %s is left to cancel of transaction %d", ErrRefundExceeded, tx.Amount, original.ProviderID)
+		}
+	}
+
+	if err := repo.CreateTransaction(ctx, tx); err != nil {
+		return err
+	}
+	if len(bets) > 0 {
+		for _, bet := range bets {
+			bet.TransactionID = tx.ID
+		}
+		if err := repo.CreateSettlementBets(ctx, bets); err != nil {
+			return err
+		}
+	}
+	commands, err := models.NewWalletCommands(tx, original, bets)
+	if err != nil {
+		return err
+	}
+	if len(commands) > 0 {
+		return repo.CreateWalletCommands(ctx, commands)
+	}
+	return nil
+}
+
+// submitTransaction queues a transaction along with its wallet commands in a
+// single db transaction, see queueTransaction, so there is never a wallet
+// call without a transaction to confirm. The commands are left to the
+// dispatcher, original being the transaction a cancel reverses and bets the
+// bets of a settlement of several bets. The transaction is attached to the
+// round of roundReq, if any.
+//
+// The response waits up to WALLET_DISPATCH_WAIT for the dispatcher result,
+// the transaction is answered pending otherwise. It is stored to be replayed
+// when the request is retried.
+func (s *Service) submitTransaction(ctx context.Context, tx, original *models.Transaction, bets []*models.SettlementBet, providerTransactionID uint64, roundReq shared.RoundRequest) (*shared.BetOperationResponse, error) {
+	resp := &shared.BetOperationResponse{ProviderTransactionID: providerTransactionID}
+
+	// The balance before the operation, which also opens the ledger account
+	// of a new player. It is only informative, the command is queued anyway.
+	if s.walletAvailable() {
+		balanceResp, err := s.GetWalletBalance(ctx, tx.PlayerID)
+		if err != nil {
+			slog.Warn("Failed to get balance before queuing transaction", "error", err, "player_id", tx.PlayerID)
+		} else {
+			resp.OldBalance = balanceResp.Balance
+		}
+	}
+
+	err := s.Repository.WithTx(ctx, func(repo repository.Repository) error {
+		round, err := attachRound(ctx, repo, tx, roundReq)
+		if err != nil {
+			return err
+		}
+		if err := queueTransaction(ctx, repo, tx, original, bets); err != nil {
+			return err
+		}
+		if round != nil && roundReq.RoundClosed {
+			return repo.CloseRound(ctx, round)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+
+	wait := internal.Config.WALLET_DISPATCH_WAIT
+	var done chan struct{}
+	if wait > 0 {
+		// Registered before the dispatcher is woken up, so its result can't be missed
+		done = s.dispatches.add(tx.ID)
+		defer s.dispatches.remove(tx.ID, done)
+	}
+	s.notifyPending(ctx, tx)
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+			slog.Info("Dispatcher did not answer in time, answering with a pending transaction", "transaction_id", tx.ID, "wait", wait)
+		case <-ctx.Done():
+		}
+
+		if stored, err := s.GetTransactionByID(ctx, tx.ID); err != nil {
+			slog.Warn("Failed to reload dispatched transaction", "error", err, "transaction_id", tx.ID)
+		} else if stored != nil {
+			tx = stored
+		}
+	}
+
+	resp.TransactionID = tx.ID
+	resp.Status = tx.Status
+	resp.NewBalance = resp.OldBalance // No change until the wallet confirms it
+	if tx.Status == models.TransactionStatusConfirmed {
+		commands, err := s.GetWalletCommandsByTransactionID(ctx, tx.ID)
+		if err != nil {
+			slog.Warn("Failed to get the wallet commands of a transaction", "error", err, "transaction_id", tx.ID)
+		}
+		// The commands of a transaction are delivered in a single wallet request
+		for _, command := range commands {
+			if command.Balance != "" {
+				resp.NewBalance = command.Balance
+			}
+		}
+	}
+	s.saveResponse(ctx, resp)
+	return resp, nil
+}
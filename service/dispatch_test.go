@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// walletCommands returns the outbox commands of the transaction with a
+// provider id
+func walletCommands(t *testing.T, s *Service, repo *memoryRepository, providerID uint64) []*models.WalletCommand {
+	t.Helper()
+	commands, err := s.GetWalletCommandsByTransactionID(context.Background(), storedTransaction(t, repo, providerID).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commands
+}
+
+// walletCommand returns the single outbox command of the transaction with a
+// provider id, nil when it has none
+func walletCommand(t *testing.T, s *Service, repo *memoryRepository, providerID uint64) *models.WalletCommand {
+	t.Helper()
+	commands := walletCommands(t, s, repo, providerID)
+	if len(commands) > 1 {
+		t.Fatalf("transaction %d has %d commands, want one", providerID, len(commands))
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	return commands[0]
+}
+
+func TestTransactionsWriteTheirWalletCommand(t *testing.T) {
+	s, repo, _ := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	bet := storedTransaction(t, repo, 1)
+	command := walletCommand(t, s, repo, 1)
+	if command == nil || command.Operation != models.TransactionTypeWithdraw || command.Amount != bet.Amount ||
+		command.BetID != 1 || command.Reference != bet.ID.String() {
+		t.Fatalf("bet command is %+v, want a withdrawal of bet 1 referenced by the transaction", command)
+	}
+	if !command.DeliveredAt.IsZero() {
+		t.Error("command is delivered before the dispatcher ran")
+	}
+	dispatch(t, s)
+
+	// A lost bet moves no money, its settlement has no command
+	_, err := s.ProcessSettle(context.Background(), testPlayer, shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		ProviderTransactionID:          2,
+		ProviderWithdrawnTransactionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command := walletCommand(t, s, repo, 2); command != nil {
+		t.Errorf("lost bet settlement has command %+v", command)
+	}
+}
+
+func TestCancelCommandReversesTheOriginal(t *testing.T) {
+	s, _, _ := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+	resp, err := s.ProcessCancel(context.Background(), testPlayer, shared.CancelRequest{ProviderTransactionID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands, err := s.GetWalletCommandsByTransactionID(context.Background(), resp.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 {
+		t.Fatalf("cancel has %d commands, want one", len(commands))
+	}
+	if command := commands[0]; command.Operation != models.TransactionTypeDeposit || command.BetID != 1 || command.Reference != "cancel-1" {
+		t.Errorf("cancel command is %+v, want a deposit on bet 1 referenced by cancel-1", command)
+	}
+}
+
+func TestDispatcherDeliversCommands(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+
+	command := walletCommand(t, s, repo, 1)
+	if command.DeliveredAt.IsZero() || command.Balance != "900.00" {
+		t.Errorf("command is delivered at %v with balance %q, want delivered with 900.00", command.DeliveredAt, command.Balance)
+	}
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(900))
+}
+
+func TestDispatcherLeavesRejectedCommandsUndelivered(t *testing.T) {
+	s, repo, _ := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(5000))
+	dispatch(t, s)
+
+	if command := walletCommand(t, s, repo, 1); !command.DeliveredAt.IsZero() {
+		t.Errorf("rejected command is delivered at %v", command.DeliveredAt)
+	}
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFailed)
+}
+
+func TestRequestWaitsForTheDispatcher(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	internal.Config.WALLET_DISPATCH_WAIT = 5 * time.Second
+	internal.Config.WORKER_COUNT = 1
+	internal.Config.WORKER_TICK_INTERVAL = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartPendingTransactionWorker(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The bet notifies the worker, which must be listening by then
+	deadline := time.Now().Add(5 * time.Second)
+	for !repo.listening() {
+		if time.Now().After(deadline) {
+			t.Fatal("the worker did not listen")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	resp := placeBet(t, s, 1, models.NewAmount(100))
+	if resp.Status != models.TransactionStatusConfirmed || resp.OldBalance != "1000.00" || resp.NewBalance != "900.00" {
+		t.Errorf("bet answered %s from %s to %s, want CONFIRMED from 1000.00 to 900.00", resp.Status, resp.OldBalance, resp.NewBalance)
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// defaultTransactionPageSize is the page size of the transaction history
+// when none is requested
+const defaultTransactionPageSize = 50
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrInvalidDateRange    = errors.New("to should be after from")
+)
+
+// ListTransactions returns a page of the transaction history of a player,
+// newest first. The page is keyed on (created_at, id), so transactions
+// queued meanwhile never shift the next pages.
+func (s *Service) ListTransactions(ctx context.Context, player *models.Player, req shared.ListTransactionsRequest) (*shared.TransactionPageResponse, error) {
+	if !req.From.IsZero() && !req.To.IsZero() && !req.To.After(req.From) {
+		return nil, ErrInvalidDateRange
+	}
+
+	filter := repository.TransactionFilter{
+		PlayerID: player.ID,
+		Type:     req.Type,
+		Status:   req.Status,
+		Currency: req.Currency,
+		From:     req.From,
+		To:       req.To,
+		Limit:    req.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultTransactionPageSize
+	}
+	if req.Cursor != "" {
+		createdAt, id, err := decodeTransactionCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.BeforeCreatedAt = createdAt
+		filter.BeforeID = id
+	}
+
+	resp := &shared.TransactionPageResponse{Transactions: []shared.TransactionResponse{}}
+	if req.RoundID != "" {
+		round, err := s.Repository.GetRoundByProviderID(ctx, player.ID, req.RoundID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get round: %w", err)
+		}
+		if round == nil {
+			return resp, nil // An unknown round has no transactions
+		}
+		filter.RoundID = round.ID
+	}
+
+	// One more transaction tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	transactions, err := s.Repository.ListTransactions(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		resp.NextCursor = encodeTransactionCursor(last.CreatedAt, last.ID)
+	}
+
+	for _, tx := range transactions {
+		resp.Transactions = append(resp.Transactions, transactionResponse(tx))
+	}
+	return resp, nil
+}
+
+// GetTransactionStatus returns the current outcome of a transaction of a
+// player, e.g. for a provider polling a bet that was answered pending
+func (s *Service) GetTransactionStatus(ctx context.Context, player *models.Player, id uuid.UUID) (*shared.TransactionStatusResponse, error) {
+	tx, err := s.GetTransactionByID(ctx, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	return s.transactionStatus(ctx, player, tx)
+}
+
+// GetTransactionStatusByProviderID is GetTransactionStatus for the provider
+// transaction id of a bet, a settlement or an identified rollback
+func (s *Service) GetTransactionStatusByProviderID(ctx context.Context, player *models.Player, providerTransactionID uint64) (*shared.TransactionStatusResponse, error) {
+	tx, err := s.GetTransactionByProviderID(ctx, providerTransactionID)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	return s.transactionStatus(ctx, player, tx)
+}
+
+// transactionStatus describes tx, which is reported as not found to other
+// players than its own, like an unknown transaction
+func (s *Service) transactionStatus(ctx context.Context, player *models.Player, tx *models.Transaction) (*shared.TransactionStatusResponse, error) {
+	if tx.PlayerID != player.ID {
+		return nil, ErrTransactionNotFound
+	}
+
+	if tx.RoundID != uuid.Nil {
+		round, err := s.GetRoundByID(ctx, tx.RoundID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the round of the transaction: %w", err)
+		}
+		tx.Round = round
+	}
+	resp := &shared.TransactionStatusResponse{TransactionResponse: transactionResponse(tx)}
+
+	switch tx.Status {
+	case models.TransactionStatusConfirmed, models.TransactionStatusFinalized:
+		// The balance before comes from the first response, the one after
+		// from the wallet when it acknowledged the transaction
+		stored, err := s.GetTransactionResponse(ctx, tx.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the response of the transaction: %w", err)
+		}
+		if stored != nil {
+			var first shared.BetOperationResponse
+			if err := json.Unmarshal(stored.Response, &first); err != nil {
+				return nil, fmt.Errorf("failed to read the response of the transaction: %w", err)
+			}
+			resp.OldBalance = first.OldBalance
+			if first.Status == models.TransactionStatusConfirmed {
+				resp.NewBalance = first.NewBalance
+			}
+		}
+
+		commands, err := s.GetWalletCommandsByTransactionID(ctx, tx.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the wallet commands of the transaction: %w", err)
+		}
+		for _, command := range commands {
+			if command.Balance != "" {
+				resp.NewBalance = command.Balance
+			}
+		}
+
+	case models.TransactionStatusFailed:
+		deadLetter, err := s.GetLastDeadLetterByTransactionID(ctx, tx.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the dead letter of the transaction: %w", err)
+		}
+		if deadLetter != nil {
+			resp.FailureReason = deadLetter.Reason
+			if deadLetter.Resolution == models.TransactionStatusFailed && deadLetter.ResolutionReason != "" {
+				resp.FailureReason = deadLetter.ResolutionReason
+			}
+			resp.LastErrorCode = deadLetter.LastErrorCode
+		}
+	}
+	return resp, nil
+}
+
+func transactionResponse(tx *models.Transaction) shared.TransactionResponse {
+	resp := shared.TransactionResponse{
+		ID:                             tx.ID,
+		ProviderTransactionID:          tx.ProviderID,
+		ProviderWithdrawnTransactionID: tx.WithdrawProviderID,
+		Type:                           tx.Type,
+		Status:                         tx.Status,
+		Amount:                         tx.Amount,
+		Refunded:                       tx.Refunded,
+		Currency:                       tx.Currency,
+		Attempts:                       tx.Attempts,
+		CreatedAt:                      tx.CreatedAt,
+	}
+	if tx.Round != nil {
+		resp.RoundID = tx.Round.ProviderRoundID
+	}
+	return resp
+}
+
+// encodeTransactionCursor returns the opaque cursor of the page following
+// the transaction created at createdAt with id
+func encodeTransactionCursor(createdAt time.Time, id uuid.UUID) string {
+	cursor := strconv.FormatInt(createdAt.UnixNano(), 10) + "_" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeTransactionCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	nanos, rawID, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return time.Unix(0, unixNano), id, nil
+}
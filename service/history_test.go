@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// providerIDs returns the provider ids of a page of the history
+func providerIDs(page *shared.TransactionPageResponse) []uint64 {
+	var ids []uint64
+	for _, tx := range page.Transactions {
+		ids = append(ids, tx.ProviderTransactionID)
+	}
+	return ids
+}
+
+func TestListTransactionsPages(t *testing.T) {
+	s, _, _ := newTestService(t)
+	ctx := context.Background()
+
+	for providerID := uint64(1); providerID <= 5; providerID++ {
+		placeBet(t, s, providerID, models.NewAmount(10))
+	}
+	dispatch(t, s)
+
+	var pages [][]uint64
+	req := shared.ListTransactionsRequest{Limit: 2}
+	for {
+		page, err := s.ListTransactions(ctx, testPlayer, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, providerIDs(page))
+		if page.NextCursor == "" {
+			break
+		}
+		req.Cursor = page.NextCursor
+
+		// A transaction queued meanwhile doesn't shift the next pages
+		if len(pages) == 1 {
+			placeBet(t, s, 6, models.NewAmount(10))
+		}
+	}
+
+	want := [][]uint64{{5, 4}, {3, 2}, {1}}
+	if !slices.EqualFunc(pages, want, slices.Equal) {
+		t.Errorf("got pages %v, want %v", pages, want)
+	}
+}
+
+func TestListTransactionsFilters(t *testing.T) {
+	s, _, _ := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(10))
+	_, err := s.ProcessBet(ctx, testPlayer, shared.WithdrawRequest{
+		Currency:              models.CurrencyUSD,
+		Amount:                models.NewAmount(20),
+		ProviderTransactionID: 2,
+		RoundRequest:          shared.RoundRequest{RoundID: "r-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+	_, err = s.ProcessSettle(ctx, testPlayer, shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		Amount:                         models.NewAmount(40),
+		ProviderTransactionID:          3,
+		ProviderWithdrawnTransactionID: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  shared.ListTransactionsRequest
+		want []uint64
+	}{
+		{name: "all", want: []uint64{3, 2, 1}},
+		{name: "type", req: shared.ListTransactionsRequest{Type: models.TransactionTypeWithdraw}, want: []uint64{2, 1}},
+		{name: "status", req: shared.ListTransactionsRequest{Status: models.TransactionStatusPending}, want: []uint64{3}},
+		{name: "round", req: shared.ListTransactionsRequest{RoundID: "r-1"}, want: []uint64{3, 2}},
+		{name: "unknown round", req: shared.ListTransactionsRequest{RoundID: "r-2"}},
+		{name: "future", req: shared.ListTransactionsRequest{From: time.Now().Add(time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.ListTransactions(ctx, testPlayer, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := providerIDs(page); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	page, err := s.ListTransactions(ctx, testPlayer, shared.ListTransactionsRequest{RoundID: "r-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Transactions[0].RoundID != "r-1" {
+		t.Errorf("settlement is listed in round %q, want r-1", page.Transactions[0].RoundID)
+	}
+}
+
+func TestListTransactionsChecksTheRequest(t *testing.T) {
+	s, _, _ := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := s.ListTransactions(ctx, testPlayer, shared.ListTransactionsRequest{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got %v, want %v", err, ErrInvalidCursor)
+	}
+	now := time.Now()
+	if _, err := s.ListTransactions(ctx, testPlayer, shared.ListTransactionsRequest{From: now, To: now}); !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("got %v, want %v", err, ErrInvalidDateRange)
+	}
+}
+
+func TestGetTransactionStatus(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+	placeBet(t, s, 2, models.NewAmount(5000))
+	dispatch(t, s)
+
+	confirmed, err := s.GetTransactionStatusByProviderID(ctx, testPlayer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmed.Status != models.TransactionStatusConfirmed || confirmed.Attempts != 1 ||
+		confirmed.OldBalance != "1000.00" || confirmed.NewBalance != "900.00" {
+		t.Errorf("confirmed bet is %+v, want CONFIRMED after 1 attempt from 1000.00 to 900.00", confirmed)
+	}
+
+	failed, err := s.GetTransactionStatus(ctx, testPlayer, storedTransaction(t, repo, 2).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != models.TransactionStatusFailed || failed.FailureReason == "" ||
+		failed.LastErrorCode != walletclient.ErrCodeInsufficientFunds || failed.NewBalance != "" {
+		t.Errorf("failed bet is %+v, want FAILED with a reason and %s", failed, walletclient.ErrCodeInsufficientFunds)
+	}
+
+	other := &models.Player{ID: testPlayer.ID + 1}
+	lookups := map[string]func() error{
+		"unknown id": func() error {
+			_, err := s.GetTransactionStatus(ctx, testPlayer, uuid.New())
+			return err
+		},
+		"unknown provider id": func() error {
+			_, err := s.GetTransactionStatusByProviderID(ctx, testPlayer, 9)
+			return err
+		},
+		"id of another player": func() error {
+			_, err := s.GetTransactionStatus(ctx, other, confirmed.ID)
+			return err
+		},
+		"provider id of another player": func() error {
+			_, err := s.GetTransactionStatusByProviderID(ctx, other, 1)
+			return err
+		},
+	}
+	for name, lookup := range lookups {
+		if err := lookup(); !errors.Is(err, ErrTransactionNotFound) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrTransactionNotFound)
+		}
+	}
+}
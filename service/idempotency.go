@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+var (
+	ErrIdempotencyKeyInUse    = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyMismatch = errors.New("the idempotency key was already used with another request")
+)
+
+// idempotencyCleanupInterval is how often the expired idempotency keys are purged
+const idempotencyCleanupInterval = time.Hour
+
+// BeginIdempotentRequest reserves key for a request of a player, identified
+// by requestHash, until IDEMPOTENCY_KEY_TTL. It returns the stored key when
+// the same request already completed, its response should be replayed, and
+// nil when the request should be handled.
+func (s *Service) BeginIdempotentRequest(ctx context.Context, playerID uint64, key, requestHash string) (*models.IdempotencyKey, error) {
+	// A key released or expired between the claim and the read is claimed again
+	for range 2 {
+		claimed, err := s.Repository.ClaimIdempotencyKey(ctx, &models.IdempotencyKey{
+			PlayerID:    playerID,
+			Key:         key,
+			RequestHash: requestHash,
+			Status:      models.IdempotencyKeyStatusInProgress,
+			ExpiresAt:   time.Now().Add(internal.Config.IDEMPOTENCY_KEY_TTL),
+		})
+		if err != nil || claimed {
+			return nil, err
+		}
+
+		stored, err := s.Repository.GetIdempotencyKey(ctx, playerID, key)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case stored == nil:
+			continue
+		case stored.RequestHash != requestHash:
+			return nil, ErrIdempotencyKeyMismatch
+		case stored.Status != models.IdempotencyKeyStatusCompleted:
+			return nil, ErrIdempotencyKeyInUse
+		}
+		return stored, nil
+	}
+	// Taken and released again meanwhile, another request is using it
+	return nil, ErrIdempotencyKeyInUse
+}
+
+// CompleteIdempotentRequest stores the response of the request holding key,
+// to be replayed. Server errors release the key instead, so the request can
+// be sent again.
+func (s *Service) CompleteIdempotentRequest(ctx context.Context, playerID uint64, key string, status int, body []byte) error {
+	idempotencyKey := &models.IdempotencyKey{
+		PlayerID:       playerID,
+		Key:            key,
+		Status:         models.IdempotencyKeyStatusCompleted,
+		ResponseStatus: status,
+		ResponseBody:   body,
+	}
+	if status >= 500 {
+		return s.ReleaseIdempotentRequest(ctx, playerID, key)
+	}
+	return s.Repository.CompleteIdempotencyKey(ctx, idempotencyKey)
+}
+
+// ReleaseIdempotentRequest frees key without storing a response, for a
+// request that did not complete, so it can be sent again
+func (s *Service) ReleaseIdempotentRequest(ctx context.Context, playerID uint64, key string) error {
+	return s.Repository.DeleteIdempotencyKey(ctx, &models.IdempotencyKey{PlayerID: playerID, Key: key})
+}
+
+// StartIdempotencyKeyCleanup purges the expired idempotency keys every
+// idempotencyCleanupInterval, until ctx is done
+func (s *Service) StartIdempotencyKeyCleanup(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.Repository.DeleteExpiredIdempotencyKeys(ctx)
+			if err != nil {
+				slog.Error("Failed to purge expired idempotency keys", "error", err)
+				continue
+			}
+			slog.Debug("Purged expired idempotency keys", "deleted", deleted)
+		}
+	}
+}
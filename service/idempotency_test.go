@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+)
+
+func TestIdempotentRequestIsReplayed(t *testing.T) {
+	s, _, _ := newTestService(t)
+	internal.Config.IDEMPOTENCY_KEY_TTL = time.Hour
+	ctx := context.Background()
+
+	stored, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet")
+	if err != nil || stored != nil {
+		t.Fatalf("first request got %+v, %v, want to be handled", stored, err)
+	}
+	if _, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet"); !errors.Is(err, ErrIdempotencyKeyInUse) {
+		t.Errorf("request sent while the first one is handled: got %v, want %v", err, ErrIdempotencyKeyInUse)
+	}
+
+	if err := s.CompleteIdempotentRequest(ctx, testPlayer.ID, "key", http.StatusOK, []byte(`{"status":"PENDING"}`)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet")
+	if err != nil || stored == nil || stored.ResponseStatus != http.StatusOK || string(stored.ResponseBody) != `{"status":"PENDING"}` {
+		t.Fatalf("retried request got %+v, %v, want the first response", stored, err)
+	}
+
+	if _, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "settle"); !errors.Is(err, ErrIdempotencyKeyMismatch) {
+		t.Errorf("key reused for another request: got %v, want %v", err, ErrIdempotencyKeyMismatch)
+	}
+	// Keys are scoped to the player
+	stored, err = s.BeginIdempotentRequest(ctx, testPlayer.ID+1, "key", "settle")
+	if err != nil || stored != nil {
+		t.Errorf("key of another player got %+v, %v, want to be handled", stored, err)
+	}
+}
+
+func TestServerErrorsReleaseTheIdempotencyKey(t *testing.T) {
+	s, _, _ := newTestService(t)
+	internal.Config.IDEMPOTENCY_KEY_TTL = time.Hour
+	ctx := context.Background()
+
+	if _, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteIdempotentRequest(ctx, testPlayer.ID, "key", http.StatusInternalServerError, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet")
+	if err != nil || stored != nil {
+		t.Fatalf("request retried after a server error got %+v, %v, want to be handled again", stored, err)
+	}
+
+	// A request that never completes, e.g. its handler panicked
+	if err := s.ReleaseIdempotentRequest(ctx, testPlayer.ID, "key"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet")
+	if err != nil || stored != nil {
+		t.Errorf("request retried after a release got %+v, %v, want to be handled again", stored, err)
+	}
+}
+
+func TestExpiredIdempotencyKeysAreReused(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	internal.Config.IDEMPOTENCY_KEY_TTL = -time.Second
+	ctx := context.Background()
+
+	if _, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteIdempotentRequest(ctx, testPlayer.ID, "key", http.StatusOK, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another request can use the key once it expired
+	stored, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "settle")
+	if err != nil || stored != nil {
+		t.Errorf("expired key got %+v, %v, want the request handled", stored, err)
+	}
+	if deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx); err != nil || deleted != 1 {
+		t.Errorf("purge deleted %d keys, %v, want 1", deleted, err)
+	}
+}
+
+// releasedKeys is a repository where the first claims of a key fail as if
+// another request held it and released it right after
+type releasedKeys struct {
+	*memoryRepository
+	lostClaims int
+}
+
+func (r *releasedKeys) ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	if r.lostClaims > 0 {
+		r.lostClaims--
+		return false, nil
+	}
+	return r.memoryRepository.ClaimIdempotencyKey(ctx, key)
+}
+
+func TestKeyReleasedDuringTheClaimIsClaimedAgain(t *testing.T) {
+	setTestConfig(t)
+	internal.Config.IDEMPOTENCY_KEY_TTL = time.Hour
+	repo := &releasedKeys{memoryRepository: newMemoryRepository(), lostClaims: 1}
+	s := NewService(repo, walletclient.NewFakeWallet(string(models.CurrencyUSD), 0))
+	ctx := context.Background()
+
+	stored, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "key", "bet")
+	if err != nil || stored != nil {
+		t.Fatalf("request got %+v, %v, want to be handled", stored, err)
+	}
+	if held, err := repo.GetIdempotencyKey(ctx, testPlayer.ID, "key"); err != nil || held == nil {
+		t.Fatalf("key is not held by the request: %v", err)
+	}
+
+	repo.lostClaims = 2
+	if _, err := s.BeginIdempotentRequest(ctx, testPlayer.ID, "other", "bet"); !errors.Is(err, ErrIdempotencyKeyInUse) {
+		t.Errorf("key released twice: got %v, want %v", err, ErrIdempotencyKeyInUse)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// GetWalletBalance returns the balance of a player from the wallet. The first
+// balance read without transactions in flight opens the ledger account of the
+// player, the ledger tracks every movement from there on.
+func (s *Service) GetWalletBalance(ctx context.Context, playerID uint64) (*walletclient.BalanceResponse, error) {
+	// Read before the wallet, the account isn't opened if a movement is
+	// posted in between
+	posted, postedErr := s.Repository.GetLedgerBalances(ctx, playerID)
+
+	balanceResp, err := s.WalletClient.GetBalance(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+	if postedErr != nil {
+		slog.Error("Failed to get ledger balances", "error", postedErr, "player_id", playerID)
+		return balanceResp, nil
+	}
+
+	balance, err := models.ParseAmount(balanceResp.Balance)
+	if err != nil {
+		slog.Error("Wallet returned an invalid balance", "error", err, "player_id", playerID, "balance", balanceResp.Balance)
+		return balanceResp, nil
+	}
+
+	currency := models.Currency(balanceResp.Currency)
+	opened, err := s.Repository.OpenLedgerAccount(ctx, playerID, currency, balance, posted[currency])
+	if err != nil {
+		slog.Error("Failed to open ledger account", "error", err, "player_id", playerID, "currency", currency)
+	} else if opened {
+		slog.Info("Opened ledger account", "player_id", playerID, "currency", currency, "balance", balance)
+	}
+
+	return balanceResp, nil
+}
+
+// GetPlayerLedger returns what the wallet balances of a player should be
+// according to the ledger, along with its latest journal entries
+func (s *Service) GetPlayerLedger(ctx context.Context, playerID uint64, limit, offset int) (*shared.PlayerLedgerResponse, error) {
+	balances, err := s.Repository.GetLedgerBalances(ctx, playerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger balances: %w", err)
+	}
+
+	entries, err := s.Repository.GetJournalEntriesByPlayerID(ctx, playerID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal entries: %w", err)
+	}
+
+	resp := &shared.PlayerLedgerResponse{
+		PlayerID: playerID,
+		Balances: make([]shared.LedgerBalanceResponse, 0, len(balances)),
+		Entries:  make([]shared.JournalEntryResponse, 0, len(entries)),
+	}
+	for currency, balance := range balances {
+		resp.Balances = append(resp.Balances, shared.LedgerBalanceResponse{
+			Currency: currency,
+			Balance:  balance,
+		})
+	}
+	for _, entry := range entries {
+		entryResp := shared.JournalEntryResponse{
+			ID:            entry.ID,
+			TransactionID: entry.TransactionID,
+			Type:          entry.Type,
+			Currency:      entry.Currency,
+			CreatedAt:     entry.CreatedAt,
+		}
+		for _, line := range entry.Lines {
+			lineResp := shared.JournalLineResponse{
+				Debit:  line.Debit,
+				Credit: line.Credit,
+			}
+			if line.Account != nil {
+				lineResp.Account = line.Account.Type
+			}
+			entryResp.Lines = append(entryResp.Lines, lineResp)
+		}
+		resp.Entries = append(resp.Entries, entryResp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// assertLedgerBalance checks the USD ledger balance of the test player
+func assertLedgerBalance(t *testing.T, repo *memoryRepository, want models.Amount) {
+	t.Helper()
+	balances, err := repo.GetLedgerBalances(context.Background(), testPlayer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := balances[models.CurrencyUSD]; got != want {
+		t.Errorf("ledger balance is %s, want %s", got, want)
+	}
+}
+
+// assertOpened checks whether the USD ledger account of the test player got
+// its opening balance
+func assertOpened(t *testing.T, repo *memoryRepository, want bool) {
+	t.Helper()
+	balances, err := repo.ListLedgerBalances(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Opened != want {
+		t.Fatalf("ledger accounts are %+v, want one with opened %t", balances, want)
+	}
+}
+
+// betWithoutOpening places a bet while the wallet balance can't be read, so
+// its movement is the first one of the ledger account
+func betWithoutOpening(t *testing.T, s *Service, wallet *walletclient.FakeWallet, providerID uint64, amount models.Amount) {
+	t.Helper()
+	wallet.FailNext(walletclient.FakeMethodGetBalance, "WALLET_DOWN")
+	placeBet(t, s, providerID, amount)
+}
+
+func TestLedgerFollowsTheWallet(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	placeBet(t, s, 2, models.NewAmount(50))
+	dispatch(t, s)
+	_, err := s.ProcessSettle(context.Background(), testPlayer, shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		Amount:                         models.NewAmount(250),
+		ProviderTransactionID:          3,
+		ProviderWithdrawnTransactionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+
+	assertBalance(t, wallet, models.NewAmount(1100))
+	assertLedgerBalance(t, repo, models.NewAmount(1100))
+	// A lost bet moves no money, it has no entry
+	if len(repo.journal) != 4 {
+		t.Errorf("journal has %d entries, want an opening, two bets and a win", len(repo.journal))
+	}
+}
+
+func TestLedgerOpensOnce(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := s.GetWalletBalance(ctx, testPlayer.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertLedgerBalance(t, repo, models.NewAmount(1000))
+
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(5000))
+	if _, err := s.GetWalletBalance(ctx, testPlayer.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertLedgerBalance(t, repo, models.NewAmount(1000))
+}
+
+func TestLedgerOpensAfterFirstMovement(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	betWithoutOpening(t, s, wallet, 1, models.NewAmount(100))
+	dispatch(t, s)
+	assertOpened(t, repo, false)
+
+	// The opening balance is what the wallet had before the bet
+	if _, err := s.GetWalletBalance(ctx, testPlayer.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertOpened(t, repo, true)
+	assertBalance(t, wallet, models.NewAmount(900))
+	assertLedgerBalance(t, repo, models.NewAmount(900))
+
+	// Opened once
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(5000))
+	if _, err := s.GetWalletBalance(ctx, testPlayer.ID); err != nil {
+		t.Fatal(err)
+	}
+	balances, err := repo.GetLedgerBalances(ctx, testPlayer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := balances[models.CurrencyUSD]; got != models.NewAmount(900) {
+		t.Errorf("ledger balance is %s after a second opening, want 900.00", got)
+	}
+}
+
+func TestLedgerStaysUnopenedWhileInFlight(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	betWithoutOpening(t, s, wallet, 1, models.NewAmount(100))
+	dispatch(t, s)
+	betWithoutOpening(t, s, wallet, 2, models.NewAmount(50))
+
+	// The wallet balance may already include the pending bet
+	if _, err := s.GetWalletBalance(ctx, testPlayer.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertOpened(t, repo, false)
+
+	dispatch(t, s)
+	if _, err := s.GetWalletBalance(ctx, testPlayer.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertOpened(t, repo, true)
+	assertBalance(t, wallet, models.NewAmount(850))
+	assertLedgerBalance(t, repo, models.NewAmount(850))
+}
+
+func TestReconcileOpensLedgerAccounts(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	betWithoutOpening(t, s, wallet, 1, models.NewAmount(100))
+	dispatch(t, s)
+
+	run, err := s.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Accounts != 1 || run.Matched != 1 || run.Discrepancies != 0 {
+		t.Errorf("run counted %d accounts, %d matched and %d discrepancies, want 1 matched", run.Accounts, run.Matched, run.Discrepancies)
+	}
+	assertOpened(t, repo, true)
+	assertBalance(t, wallet, models.NewAmount(900))
+	assertLedgerBalance(t, repo, models.NewAmount(900))
+}
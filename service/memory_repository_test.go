@@ -0,0 +1,1072 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
+)
+
+var errNotSupported = errors.New("not supported by the memory repository")
+
+// memoryRepository is an in-memory repository.Repository for the service
+// tests. It follows what the postgres repository does for the bet, settle
+// and cancel flow, refund reservations included, rows are copied in and out
+// like a db would. WithTx doesn't roll back, and the methods the flow doesn't
+// use return errNotSupported.
+type memoryRepository struct {
+	mu sync.Mutex
+
+	transactions map[uuid.UUID]*models.Transaction
+	attempts     []*models.TransactionAttempt
+	responses    map[uuid.UUID]*models.TransactionResponse
+	// settlementBets holds the bets of the settlements of several bets
+	settlementBets map[uuid.UUID][]*models.SettlementBet
+	deadLetters    []*models.DeadLetter
+	recoveries     []*models.TransactionRecovery
+	// ledgerAccounts tells whether each player account was opened
+	ledgerAccounts map[ledgerKey]bool
+	journal        []*models.JournalEntry
+	runs           map[uuid.UUID]*models.ReconciliationRun
+	discrepancies  []*models.ReconciliationDiscrepancy
+	commands       map[uuid.UUID]*models.WalletCommand
+	idempotency    map[idempotencyKey]*models.IdempotencyKey
+	rounds         map[uuid.UUID]*models.Round
+	// listeners receive the notified player ids and dispatchListeners the
+	// notified transaction ids, like LISTEN connections
+	listeners         []chan uint64
+	dispatchListeners []chan uuid.UUID
+
+	// clock orders created_at, two rows are never created at the same time
+	clock time.Time
+}
+
+type idempotencyKey struct {
+	playerID uint64
+	key      string
+}
+
+type ledgerKey struct {
+	playerID uint64
+	currency models.Currency
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		transactions:   make(map[uuid.UUID]*models.Transaction),
+		responses:      make(map[uuid.UUID]*models.TransactionResponse),
+		settlementBets: make(map[uuid.UUID][]*models.SettlementBet),
+		commands:       make(map[uuid.UUID]*models.WalletCommand),
+		idempotency:    make(map[idempotencyKey]*models.IdempotencyKey),
+		ledgerAccounts: make(map[ledgerKey]bool),
+		runs:           make(map[uuid.UUID]*models.ReconciliationRun),
+		rounds:         make(map[uuid.UUID]*models.Round),
+		clock:          time.Now(),
+	}
+}
+
+func (m *memoryRepository) now() time.Time {
+	m.clock = m.clock.Add(time.Microsecond)
+	return m.clock
+}
+
+func (m *memoryRepository) WithTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	return fn(m)
+}
+
+// Players
+
+func (m *memoryRepository) GetPlayerByID(ctx context.Context, id uint64) (*models.Player, error) {
+	return nil, errNotSupported
+}
+
+func (m *memoryRepository) GetPlayerByUsername(ctx context.Context, username string) (*models.Player, error) {
+	return nil, errNotSupported
+}
+
+func (m *memoryRepository) GetPlayerBySession(ctx context.Context, session uuid.UUID) (*models.Player, error) {
+	return nil, errNotSupported
+}
+
+func (m *memoryRepository) CreatePlayer(ctx context.Context, player *models.Player) error {
+	return errNotSupported
+}
+
+func (m *memoryRepository) CreatePlayerSession(ctx context.Context, playerID uint64) (*models.PlayerSession, error) {
+	return nil, errNotSupported
+}
+
+// Transactions
+
+func copyTransaction(tx *models.Transaction) *models.Transaction {
+	stored := *tx
+	stored.Player = nil
+	stored.Round = nil
+	return &stored
+}
+
+func (m *memoryRepository) CreateTransaction(ctx context.Context, transaction *models.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := models.ValidateTransition(transaction.Type, "", transaction.Status); err != nil {
+		return err
+	}
+	if transaction.ProviderID != 0 && m.byProviderID(transaction.ProviderID) != nil {
+		return fmt.Errorf("provider id %d is already used", transaction.ProviderID)
+	}
+	transaction.ID = uuid.New()
+	transaction.CreatedAt = m.now()
+	transaction.UpdatedAt = transaction.CreatedAt
+	m.transactions[transaction.ID] = copyTransaction(transaction)
+	return nil
+}
+
+// byProviderID returns the stored transaction with a provider id, nil when
+// there is none. A zero provider id is stored as NULL and matches nothing.
+func (m *memoryRepository) byProviderID(providerID uint64) *models.Transaction {
+	if providerID == 0 {
+		return nil
+	}
+	for _, tx := range m.transactions {
+		if tx.ProviderID == providerID {
+			return tx
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) GetTransactionByProviderID(ctx context.Context, providerID uint64) (*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := m.byProviderID(providerID)
+	if tx == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyTransaction(tx), nil
+}
+
+func (m *memoryRepository) GetTransactionByID(ctx context.Context, id uuid.UUID) (*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx, ok := m.transactions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyTransaction(tx), nil
+}
+
+func (m *memoryRepository) UpdateTransaction(ctx context.Context, transaction *models.Transaction, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.updateTransaction(transaction); err != nil {
+		return err
+	}
+	return m.postTransaction(transaction)
+}
+
+// updateTransaction is the conditional UPDATE of the postgres repository,
+// refunded is left as stored
+func (m *memoryRepository) updateTransaction(transaction *models.Transaction) error {
+	previous := models.PreviousStatuses(transaction.Type, transaction.Status)
+	if len(previous) == 0 {
+		return models.ValidateTransition(transaction.Type, "", transaction.Status)
+	}
+
+	stored, ok := m.transactions[transaction.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if stored.Version != transaction.Version {
+		return &models.VersionConflictError{
+			TransactionID: transaction.ID,
+			Version:       transaction.Version,
+			Current:       stored.Version,
+		}
+	}
+	if !slices.Contains(previous, stored.Status) {
+		return models.ValidateTransition(transaction.Type, stored.Status, transaction.Status)
+	}
+
+	from := stored.Status
+	if err := m.adjustRefunded(transaction, from); err != nil {
+		return err
+	}
+	transaction.Version++
+	transaction.UpdatedAt = m.now()
+	updated := copyTransaction(transaction)
+	updated.Refunded = stored.Refunded
+	m.transactions[transaction.ID] = updated
+	return nil
+}
+
+func (m *memoryRepository) adjustRefunded(transaction *models.Transaction, from models.TransactionStatus) error {
+	if transaction.Type != models.TransactionTypeCancel {
+		return nil
+	}
+
+	var refunded models.Amount
+	switch {
+	case transaction.Status == models.TransactionStatusFailed && from != models.TransactionStatusFailed:
+		refunded = -transaction.Amount
+	case from == models.TransactionStatusFailed && transaction.Status != models.TransactionStatusFailed:
+		refunded = transaction.Amount
+	default:
+		return nil
+	}
+	original := m.byProviderID(transaction.WithdrawProviderID)
+	if original == nil || original.Refunded+refunded > original.Amount {
+		return fmt.Errorf("less than %s is left to cancel of transaction %d", transaction.Amount, transaction.WithdrawProviderID)
+	}
+	original.Refunded += refunded
+	return nil
+}
+
+// postTransaction records a confirmed transaction in the ledger, once
+func (m *memoryRepository) postTransaction(transaction *models.Transaction) error {
+	if transaction.Status != models.TransactionStatusConfirmed {
+		return nil
+	}
+
+	var original *models.Transaction
+	if transaction.Type == models.TransactionTypeCancel {
+		original = m.byProviderID(transaction.WithdrawProviderID)
+		if original == nil {
+			return fmt.Errorf("failed to get the transaction cancelled by %s: %w", transaction.ID, sql.ErrNoRows)
+		}
+	}
+
+	entry, err := models.NewTransactionJournalEntry(transaction, original)
+	if err != nil || entry == nil {
+		return err
+	}
+	for _, posted := range m.journal {
+		if posted.TransactionID == entry.TransactionID {
+			return nil
+		}
+	}
+	if err := m.postJournalEntry(entry); err != nil {
+		return err
+	}
+
+	if round, ok := m.rounds[transaction.RoundID]; ok {
+		bet, won := models.RoundTotals(transaction, original)
+		round.TotalBet += bet
+		round.TotalWon += won
+	}
+	return nil
+}
+
+func (m *memoryRepository) postJournalEntry(entry *models.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	entry.ID = uuid.New()
+	entry.CreatedAt = m.now()
+	for _, line := range entry.Lines {
+		key := ledgerKey{line.Account.PlayerID, line.Account.Currency}
+		if _, ok := m.ledgerAccounts[key]; !ok && line.Account.Type == models.LedgerAccountPlayer {
+			m.ledgerAccounts[key] = false
+		}
+	}
+	m.journal = append(m.journal, entry)
+	return nil
+}
+
+// firstTransaction returns the oldest transaction of a player in status
+func (m *memoryRepository) firstTransaction(playerID uint64, status models.TransactionStatus) *models.Transaction {
+	var first *models.Transaction
+	for _, tx := range m.transactions {
+		if tx.PlayerID == playerID && tx.Status == status && (first == nil || tx.CreatedAt.Before(first.CreatedAt)) {
+			first = tx
+		}
+	}
+	return first
+}
+
+func (m *memoryRepository) GetFirstProcessingTransactionsByPlayerID(ctx context.Context, playerID uint64) (*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := m.firstTransaction(playerID, models.TransactionStatusProcessing)
+	if tx == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyTransaction(tx), nil
+}
+
+func (m *memoryRepository) GetFirstPendingTransactionsByPlayerID(ctx context.Context, playerID uint64) (*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := m.firstTransaction(playerID, models.TransactionStatusPending)
+	if tx == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyTransaction(tx), nil
+}
+
+// sortedTransactions returns the stored transactions matching keep, oldest first
+func (m *memoryRepository) sortedTransactions(keep func(tx *models.Transaction) bool) []*models.Transaction {
+	var transactions []*models.Transaction
+	for _, tx := range m.transactions {
+		if keep(tx) {
+			transactions = append(transactions, tx)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].CreatedAt.Before(transactions[j].CreatedAt)
+	})
+	return transactions
+}
+
+func (m *memoryRepository) ClaimTransactions(ctx context.Context, owner string, shard, shards, limit int, lease time.Duration) ([]*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var head *models.Transaction
+	for _, tx := range m.sortedTransactions(func(tx *models.Transaction) bool {
+		return tx.Status == models.TransactionStatusPending && int(tx.PlayerID%uint64(shards)) == shard
+	}) {
+		if tx.NextAttemptAt.After(now) ||
+			m.firstTransaction(tx.PlayerID, models.TransactionStatusPending) != tx ||
+			m.firstTransaction(tx.PlayerID, models.TransactionStatusProcessing) != nil {
+			continue
+		}
+		head = tx
+		break
+	}
+	if head == nil {
+		return nil, nil
+	}
+
+	var claimed []*models.Transaction
+	for _, tx := range m.sortedTransactions(func(tx *models.Transaction) bool {
+		return tx.PlayerID == head.PlayerID && tx.Status == models.TransactionStatusPending
+	}) {
+		if len(claimed) == limit {
+			break
+		}
+		tx.Status = models.TransactionStatusProcessing
+		tx.Version++
+		tx.LockedBy = owner
+		tx.LockedUntil = now.Add(lease)
+		tx.UpdatedAt = m.now()
+		claimed = append(claimed, copyTransaction(tx))
+	}
+	return claimed, nil
+}
+
+func (m *memoryRepository) ReleaseTransactions(ctx context.Context, owner string, transactionIDs []uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range transactionIDs {
+		tx, ok := m.transactions[id]
+		if !ok || tx.Status != models.TransactionStatusProcessing || tx.LockedBy != owner {
+			continue
+		}
+		tx.Status = models.TransactionStatusPending
+		tx.Version++
+		tx.LockedBy = ""
+		tx.LockedUntil = time.Time{}
+		tx.UpdatedAt = m.now()
+	}
+	return nil
+}
+
+func (m *memoryRepository) NotifyPendingTransactions(ctx context.Context, playerID uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, listener := range m.listeners {
+		select {
+		case listener <- playerID:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListenPendingTransactions(ctx context.Context) <-chan uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	listener := make(chan uint64, 100)
+	m.listeners = append(m.listeners, listener)
+	return forward(ctx, listener)
+}
+
+// listening tells whether both the pending transactions and the dispatch
+// results are listened to
+func (m *memoryRepository) listening() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.listeners) > 0 && len(m.dispatchListeners) > 0
+}
+
+// forward returns the values sent to listener until ctx is done
+func forward[T any](ctx context.Context, listener <-chan T) <-chan T {
+	values := make(chan T)
+	go func() {
+		defer close(values)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case value := <-listener:
+				select {
+				case values <- value:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return values
+}
+
+func (m *memoryRepository) CreateTransactionAttempt(ctx context.Context, attempt *models.TransactionAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt.ID = uint64(len(m.attempts) + 1)
+	attempt.AttemptedAt = m.now()
+	stored := *attempt
+	m.attempts = append(m.attempts, &stored)
+	return nil
+}
+
+func (m *memoryRepository) GetLastTransactionAttempt(ctx context.Context, transactionID uuid.UUID) (*models.TransactionAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.attempts) - 1; i >= 0; i-- {
+		if m.attempts[i].TransactionID == transactionID {
+			attempt := *m.attempts[i]
+			return &attempt, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepository) CreateTransactionResponse(ctx context.Context, response *models.TransactionResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.responses[response.TransactionID]; !ok {
+		stored := *response
+		stored.CreatedAt = m.now()
+		m.responses[response.TransactionID] = &stored
+	}
+	return nil
+}
+
+func (m *memoryRepository) GetTransactionResponse(ctx context.Context, transactionID uuid.UUID) (*models.TransactionResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.responses[transactionID]
+	if !ok {
+		return nil, nil
+	}
+	response := *stored
+	return &response, nil
+}
+
+func (m *memoryRepository) ListTransactions(ctx context.Context, filter repository.TransactionFilter) ([]*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transactions := m.sortedTransactions(func(tx *models.Transaction) bool {
+		switch {
+		case tx.PlayerID != filter.PlayerID,
+			filter.Type != "" && tx.Type != filter.Type,
+			filter.Status != "" && tx.Status != filter.Status,
+			filter.Currency != "" && tx.Currency != filter.Currency,
+			filter.RoundID != uuid.Nil && tx.RoundID != filter.RoundID,
+			!filter.From.IsZero() && tx.CreatedAt.Before(filter.From),
+			!filter.To.IsZero() && !tx.CreatedAt.Before(filter.To),
+			filter.BeforeID != uuid.Nil && !tx.CreatedAt.Before(filter.BeforeCreatedAt):
+			return false
+		}
+		return true
+	})
+	slices.Reverse(transactions)
+
+	var page []*models.Transaction
+	for _, tx := range transactions {
+		if len(page) == filter.Limit {
+			break
+		}
+		listed := copyTransaction(tx)
+		if round, ok := m.rounds[tx.RoundID]; ok {
+			stored := *round
+			listed.Round = &stored
+		}
+		page = append(page, listed)
+	}
+	return page, nil
+}
+
+func (m *memoryRepository) ReserveRefund(ctx context.Context, original *models.Transaction, amount models.Amount) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.transactions[original.ID]
+	if !ok || stored.Refunded+amount > stored.Amount {
+		return false, nil
+	}
+	stored.Refunded += amount
+	original.Refunded = stored.Refunded
+	return true, nil
+}
+
+func (m *memoryRepository) GetConfirmedRefund(ctx context.Context, providerID uint64) (models.Amount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var refunded models.Amount
+	for _, tx := range m.transactions {
+		if tx.Type == models.TransactionTypeCancel && tx.WithdrawProviderID == providerID && tx.Status == models.TransactionStatusConfirmed {
+			refunded += tx.Amount
+		}
+	}
+	return refunded, nil
+}
+
+func (m *memoryRepository) GetTransactionsByRoundID(ctx context.Context, roundID uuid.UUID) ([]*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var transactions []*models.Transaction
+	for _, tx := range m.sortedTransactions(func(tx *models.Transaction) bool { return tx.RoundID == roundID }) {
+		transactions = append(transactions, copyTransaction(tx))
+	}
+	return transactions, nil
+}
+
+func (m *memoryRepository) CreateSettlementBets(ctx context.Context, bets []*models.SettlementBet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, bet := range bets {
+		stored := *bet
+		m.settlementBets[bet.TransactionID] = append(m.settlementBets[bet.TransactionID], &stored)
+	}
+	return nil
+}
+
+func (m *memoryRepository) GetSettlementBets(ctx context.Context, transactionID uuid.UUID) ([]*models.SettlementBet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var bets []*models.SettlementBet
+	for _, bet := range m.settlementBets[transactionID] {
+		stored := *bet
+		bets = append(bets, &stored)
+	}
+	sort.Slice(bets, func(i, j int) bool { return bets[i].BetProviderID < bets[j].BetProviderID })
+	return bets, nil
+}
+
+// Dead letters
+
+func (m *memoryRepository) DeadLetterTransaction(ctx context.Context, transaction *models.Transaction, deadLetter *models.DeadLetter, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.updateTransaction(transaction); err != nil {
+		return err
+	}
+	deadLetter.ID = uuid.New()
+	deadLetter.CreatedAt = m.now()
+	stored := *deadLetter
+	m.deadLetters = append(m.deadLetters, &stored)
+	return nil
+}
+
+func (m *memoryRepository) CloseDeadLetter(ctx context.Context, deadLetter *models.DeadLetter, transactions ...*models.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, transaction := range transactions {
+		if err := m.updateTransaction(transaction); err != nil {
+			return err
+		}
+		if err := m.postTransaction(transaction); err != nil {
+			return err
+		}
+	}
+	for i, stored := range m.deadLetters {
+		if stored.ID == deadLetter.ID {
+			closed := *deadLetter
+			closed.Transaction = nil
+			closed.Attempts = nil
+			m.deadLetters[i] = &closed
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) GetDeadLetterByID(ctx context.Context, id uuid.UUID) (*models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.deadLetters {
+		if stored.ID != id {
+			continue
+		}
+		deadLetter := *stored
+		if tx, ok := m.transactions[stored.TransactionID]; ok {
+			deadLetter.Transaction = copyTransaction(tx)
+		}
+		for _, attempt := range m.attempts {
+			if attempt.TransactionID == stored.TransactionID {
+				deadLetter.Attempts = append(deadLetter.Attempts, attempt)
+			}
+		}
+		return &deadLetter, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryRepository) GetLastDeadLetterByTransactionID(ctx context.Context, transactionID uuid.UUID) (*models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.deadLetters) - 1; i >= 0; i-- {
+		if m.deadLetters[i].TransactionID == transactionID {
+			deadLetter := *m.deadLetters[i]
+			return &deadLetter, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepository) ListDeadLetters(ctx context.Context, status models.DeadLetterStatus, limit, offset int) ([]*models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deadLetters []*models.DeadLetter
+	for i := len(m.deadLetters) - 1; i >= 0; i-- {
+		if status == "" || m.deadLetters[i].Status == status {
+			deadLetter := *m.deadLetters[i]
+			if tx, ok := m.transactions[deadLetter.TransactionID]; ok {
+				deadLetter.Transaction = copyTransaction(tx)
+			}
+			deadLetters = append(deadLetters, &deadLetter)
+		}
+	}
+	deadLetters = deadLetters[min(offset, len(deadLetters)):]
+	return deadLetters[:min(limit, len(deadLetters))], nil
+}
+
+// Recovery
+
+func (m *memoryRepository) GetStaleTransactions(ctx context.Context, workerID string, limit int) ([]*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var stale []*models.Transaction
+	for _, tx := range m.sortedTransactions(func(tx *models.Transaction) bool {
+		worker, _, _ := strings.Cut(tx.LockedBy, "/")
+		return tx.Status == models.TransactionStatusProcessing &&
+			(tx.LockedUntil.Before(now) || (workerID != "" && worker == workerID))
+	}) {
+		if len(stale) == limit {
+			break
+		}
+		stale = append(stale, copyTransaction(tx))
+	}
+	return stale, nil
+}
+
+func (m *memoryRepository) RecoverTransaction(ctx context.Context, recovery *models.TransactionRecovery, transaction *models.Transaction, settled ...*models.Transaction) (bool, error) {
+	if err := models.ValidateTransition(transaction.Type, models.TransactionStatusProcessing, transaction.Status); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.transactions[transaction.ID]
+	if !ok || stored.Version != transaction.Version || stored.Status != models.TransactionStatusProcessing ||
+		stored.LockedBy != recovery.PreviousLockedBy || !stored.LockedUntil.Equal(recovery.PreviousLockedUntil) {
+		return false, nil
+	}
+
+	transaction.Version++
+	transaction.UpdatedAt = m.now()
+	recovered := copyTransaction(transaction)
+	recovered.Refunded = stored.Refunded
+	m.transactions[transaction.ID] = recovered
+	for _, tx := range settled {
+		if err := m.updateTransaction(tx); err != nil {
+			return false, err
+		}
+	}
+	if err := m.postTransaction(transaction); err != nil {
+		return false, err
+	}
+
+	recovery.ID = uint64(len(m.recoveries) + 1)
+	recovery.CreatedAt = m.now()
+	audit := *recovery
+	m.recoveries = append(m.recoveries, &audit)
+	return true, nil
+}
+
+// Ledger
+
+func (m *memoryRepository) OpenLedgerAccount(ctx context.Context, playerID uint64, currency models.Currency, balance, posted models.Amount) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := ledgerKey{playerID, currency}
+	if m.ledgerAccounts[key] {
+		return false, nil
+	}
+	inFlight := m.firstTransaction(playerID, models.TransactionStatusPending) != nil ||
+		m.firstTransaction(playerID, models.TransactionStatusProcessing) != nil
+	if inFlight || m.ledgerBalances()[key] != posted {
+		return false, nil
+	}
+	if entry := models.NewOpeningJournalEntry(playerID, currency, balance-posted); entry != nil {
+		if err := m.postJournalEntry(entry); err != nil {
+			return false, err
+		}
+	}
+	m.ledgerAccounts[key] = true
+	return true, nil
+}
+
+// ledgerBalances sums the lines of the player accounts
+func (m *memoryRepository) ledgerBalances() map[ledgerKey]models.Amount {
+	balances := make(map[ledgerKey]models.Amount, len(m.ledgerAccounts))
+	for key := range m.ledgerAccounts {
+		balances[key] = 0
+	}
+	for _, entry := range m.journal {
+		for _, line := range entry.Lines {
+			if line.Account.Type == models.LedgerAccountPlayer {
+				balances[ledgerKey{line.Account.PlayerID, line.Account.Currency}] += line.Credit - line.Debit
+			}
+		}
+	}
+	return balances
+}
+
+func (m *memoryRepository) GetLedgerBalances(ctx context.Context, playerID uint64) (map[models.Currency]models.Amount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balances := make(map[models.Currency]models.Amount)
+	for key, balance := range m.ledgerBalances() {
+		if key.playerID == playerID {
+			balances[key.currency] = balance
+		}
+	}
+	return balances, nil
+}
+
+func (m *memoryRepository) GetJournalEntriesByPlayerID(ctx context.Context, playerID uint64, limit, offset int) ([]*models.JournalEntry, error) {
+	return nil, errNotSupported
+}
+
+func (m *memoryRepository) ListLedgerBalances(ctx context.Context, afterPlayerID uint64, limit int) ([]*models.LedgerBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var balances []*models.LedgerBalance
+	for key, balance := range m.ledgerBalances() {
+		if key.playerID > afterPlayerID {
+			balances = append(balances, &models.LedgerBalance{PlayerID: key.playerID, Currency: key.currency, Balance: balance, Opened: m.ledgerAccounts[key]})
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].PlayerID != balances[j].PlayerID {
+			return balances[i].PlayerID < balances[j].PlayerID
+		}
+		return balances[i].Currency < balances[j].Currency
+	})
+	if len(balances) > limit {
+		balances = balances[:limit]
+	}
+	return balances, nil
+}
+
+// Reconciliation
+
+func (m *memoryRepository) CreateReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run.ID = uuid.New()
+	run.StartedAt = m.now()
+	stored := *run
+	m.runs[run.ID] = &stored
+	return nil
+}
+
+func (m *memoryRepository) FinishReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run.FinishedAt = m.now()
+	stored := *run
+	stored.Items = nil
+	m.runs[run.ID] = &stored
+	return nil
+}
+
+func (m *memoryRepository) CreateReconciliationDiscrepancy(ctx context.Context, discrepancy *models.ReconciliationDiscrepancy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *discrepancy
+	m.discrepancies = append(m.discrepancies, &stored)
+	return nil
+}
+
+func (m *memoryRepository) GetReconciliationRunByID(ctx context.Context, id uuid.UUID) (*models.ReconciliationRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.runs[id]
+	if !ok {
+		return nil, nil
+	}
+	run := *stored
+	for _, discrepancy := range m.discrepancies {
+		if discrepancy.RunID == id {
+			item := *discrepancy
+			run.Items = append(run.Items, &item)
+		}
+	}
+	return &run, nil
+}
+
+func (m *memoryRepository) ListReconciliationRuns(ctx context.Context, limit, offset int) ([]*models.ReconciliationRun, error) {
+	return nil, errNotSupported
+}
+
+// Outbox
+
+func (m *memoryRepository) CreateWalletCommands(ctx context.Context, commands []*models.WalletCommand) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, command := range commands {
+		for _, stored := range m.commands {
+			if stored.Reference == command.Reference {
+				return fmt.Errorf("wallet command reference %s is already used", command.Reference)
+			}
+		}
+		command.ID = uuid.New()
+		command.CreatedAt = m.now()
+		stored := *command
+		m.commands[command.ID] = &stored
+	}
+	return nil
+}
+
+func (m *memoryRepository) GetWalletCommandsByTransactionID(ctx context.Context, transactionID uuid.UUID) ([]*models.WalletCommand, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var commands []*models.WalletCommand
+	for _, stored := range m.commands {
+		if stored.TransactionID == transactionID {
+			command := *stored
+			commands = append(commands, &command)
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Reference < commands[j].Reference })
+	return commands, nil
+}
+
+func (m *memoryRepository) MarkWalletCommandDelivered(ctx context.Context, command *models.WalletCommand) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.commands[command.ID]
+	if !ok || !stored.DeliveredAt.IsZero() {
+		return nil
+	}
+	stored.Balance = command.Balance
+	stored.DeliveredAt = m.now()
+	command.DeliveredAt = stored.DeliveredAt
+	return nil
+}
+
+func (m *memoryRepository) NotifyDispatchResult(ctx context.Context, transactionID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, listener := range m.dispatchListeners {
+		select {
+		case listener <- transactionID:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListenDispatchResults(ctx context.Context) <-chan uuid.UUID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	listener := make(chan uuid.UUID, 100)
+	m.dispatchListeners = append(m.dispatchListeners, listener)
+	return forward(ctx, listener)
+}
+
+// Idempotency keys, they expire on the wall clock like in postgres
+
+func (m *memoryRepository) ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyKey{key.PlayerID, key.Key}
+	if stored, ok := m.idempotency[id]; ok && stored.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	key.CreatedAt = m.now()
+	stored := *key
+	m.idempotency[id] = &stored
+	return true, nil
+}
+
+func (m *memoryRepository) GetIdempotencyKey(ctx context.Context, playerID uint64, key string) (*models.IdempotencyKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.idempotency[idempotencyKey{playerID, key}]
+	if !ok || !stored.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	idempotency := *stored
+	return &idempotency, nil
+}
+
+func (m *memoryRepository) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.idempotency[idempotencyKey{key.PlayerID, key.Key}]
+	if ok && stored.Status == models.IdempotencyKeyStatusInProgress {
+		stored.Status = key.Status
+		stored.ResponseStatus = key.ResponseStatus
+		stored.ResponseBody = key.ResponseBody
+	}
+	return nil
+}
+
+func (m *memoryRepository) DeleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, idempotencyKey{key.PlayerID, key.Key})
+	return nil
+}
+
+func (m *memoryRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, stored := range m.idempotency {
+		if !stored.ExpiresAt.After(time.Now()) {
+			delete(m.idempotency, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Rounds
+
+func (m *memoryRepository) roundByProviderID(playerID uint64, providerRoundID string) *models.Round {
+	for _, round := range m.rounds {
+		if round.PlayerID == playerID && round.ProviderRoundID == providerRoundID {
+			return round
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) OpenRound(ctx context.Context, round *models.Round) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.roundByProviderID(round.PlayerID, round.ProviderRoundID)
+	if stored == nil {
+		round.ID = uuid.New()
+		round.CreatedAt = m.now()
+		round.UpdatedAt = round.CreatedAt
+		opened := *round
+		m.rounds[round.ID] = &opened
+		return nil
+	}
+	if stored.GameID == "" {
+		stored.GameID = round.GameID
+	}
+	*round = *stored
+	return nil
+}
+
+func (m *memoryRepository) CloseRound(ctx context.Context, round *models.Round) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.rounds[round.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if stored.Status == models.RoundStatusOpen {
+		stored.Status = models.RoundStatusClosed
+		stored.ClosedAt = m.now()
+		stored.UpdatedAt = stored.ClosedAt
+	}
+	*round = *stored
+	return nil
+}
+
+func (m *memoryRepository) GetRoundByID(ctx context.Context, id uuid.UUID) (*models.Round, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.rounds[id]
+	if !ok {
+		return nil, nil
+	}
+	round := *stored
+	return &round, nil
+}
+
+func (m *memoryRepository) GetRoundByProviderID(ctx context.Context, playerID uint64, providerRoundID string) (*models.Round, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.roundByProviderID(playerID, providerRoundID)
+	if stored == nil {
+		return nil, nil
+	}
+	round := *stored
+	return &round, nil
+}
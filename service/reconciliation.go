@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+var ErrReconciliationRunNotFound = errors.New("reconciliation run not found")
+
+// reconcileBatchSize is the number of ledger accounts read per query
+const reconcileBatchSize = 100
+
+// StartReconciliationJob reconciles the ledger with the wallet every
+// RECONCILIATION_INTERVAL until ctx is done. It does nothing when the
+// interval is not set.
+func (s *Service) StartReconciliationJob(ctx context.Context) {
+	if internal.Config.RECONCILIATION_INTERVAL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(internal.Config.RECONCILIATION_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Reconcile(ctx); err != nil {
+				slog.Error("Reconciliation failed", "error", err)
+			}
+		}
+	}
+}
+
+// Reconcile compares the balance of every player ledger account with the
+// balance the wallet reports and records the discrepancies. Accounts of
+// players with pending or processing transactions are skipped, their wallet
+// balance may already include movements the ledger doesn't have yet. Accounts
+// that never got their opening balance are opened from the wallet instead.
+func (s *Service) Reconcile(ctx context.Context) (*shared.ReconciliationRunResponse, error) {
+	run := &models.ReconciliationRun{}
+	if err := s.Repository.CreateReconciliationRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to start reconciliation run: %w", err)
+	}
+	slog.Info("Starting reconciliation", "run_id", run.ID)
+
+	var afterPlayerID uint64
+	for {
+		balances, err := s.Repository.ListLedgerBalances(ctx, afterPlayerID, reconcileBatchSize)
+		if err != nil {
+			// The run is finished with what it compared so far
+			slog.Error("Failed to list ledger balances", "error", err, "run_id", run.ID, "after_player_id", afterPlayerID)
+			run.Errors++
+			break
+		}
+
+		// Accounts of a player are compared together, a page cut in the middle
+		// of a player is completed by the next page
+		players := groupByPlayer(balances)
+		if len(balances) == reconcileBatchSize && len(players) > 1 {
+			players = players[:len(players)-1]
+		}
+		for _, accounts := range players {
+			s.reconcilePlayer(ctx, run, accounts)
+			afterPlayerID = accounts[0].PlayerID
+		}
+
+		if len(balances) < reconcileBatchSize || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err := s.Repository.FinishReconciliationRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to finish reconciliation run: %w", err)
+	}
+	slog.Info("Reconciliation finished", "run_id", run.ID, "accounts", run.Accounts, "matched", run.Matched, "discrepancies", run.Discrepancies, "skipped", run.Skipped, "errors", run.Errors)
+
+	return s.GetReconciliationRun(ctx, run.ID)
+}
+
+// reconcilePlayer compares the ledger accounts of a player with the wallet
+func (s *Service) reconcilePlayer(ctx context.Context, run *models.ReconciliationRun, accounts []*models.LedgerBalance) {
+	playerID := accounts[0].PlayerID
+	run.Accounts += len(accounts)
+
+	if s.skipInFlight(ctx, run, accounts) {
+		return
+	}
+
+	balanceResp, err := s.WalletClient.GetBalance(ctx, playerID)
+	if err != nil {
+		slog.Error("Failed to get wallet balance", "error", err, "player_id", playerID)
+		run.Errors += len(accounts)
+		return
+	}
+	actual, err := models.ParseAmount(balanceResp.Balance)
+	if err != nil {
+		slog.Error("Wallet returned an invalid balance", "error", err, "player_id", playerID, "balance", balanceResp.Balance)
+		run.Errors += len(accounts)
+		return
+	}
+
+	// A transaction claimed while the wallet was queried may already be in
+	// the wallet balance, and is in the ledger only once confirmed
+	if s.skipInFlight(ctx, run, accounts) {
+		return
+	}
+
+	// A transaction confirmed while the wallet was queried moved the balance
+	expected, err := s.Repository.GetLedgerBalances(ctx, playerID)
+	if err != nil {
+		slog.Error("Failed to get ledger balances", "error", err, "player_id", playerID)
+		run.Errors += len(accounts)
+		return
+	}
+
+	for _, account := range accounts {
+		if expected[account.Currency] != account.Balance {
+			run.Skipped++
+			continue
+		}
+
+		if !account.Opened && models.Currency(balanceResp.Currency) == account.Currency {
+			s.openLedgerAccount(ctx, run, account, actual)
+			continue
+		}
+
+		discrepancy := &models.ReconciliationDiscrepancy{
+			RunID:          run.ID,
+			PlayerID:       playerID,
+			Currency:       account.Currency,
+			Expected:       account.Balance,
+			WalletCurrency: balanceResp.Currency,
+		}
+		switch {
+		case models.Currency(balanceResp.Currency) != account.Currency:
+			discrepancy.Kind = models.DiscrepancyCurrencyMismatch
+		case actual != account.Balance:
+			discrepancy.Kind = models.DiscrepancyBalanceMismatch
+			discrepancy.Actual = actual
+		default:
+			run.Matched++
+			continue
+		}
+
+		if err := s.Repository.CreateReconciliationDiscrepancy(ctx, discrepancy); err != nil {
+			slog.Error("Failed to record discrepancy", "error", err, "player_id", playerID, "currency", account.Currency)
+			run.Errors++
+			continue
+		}
+		run.Discrepancies++
+		slog.Warn("Wallet balance doesn't match the ledger", "run_id", run.ID, "player_id", playerID, "currency", account.Currency, "kind", discrepancy.Kind, "expected", discrepancy.Expected, "actual", discrepancy.Actual, "wallet_currency", discrepancy.WalletCurrency)
+	}
+}
+
+// skipInFlight counts the accounts of a player as skipped and returns true
+// when the player has pending or processing transactions, or as errors when
+// they can't be checked
+func (s *Service) skipInFlight(ctx context.Context, run *models.ReconciliationRun, accounts []*models.LedgerBalance) bool {
+	playerID := accounts[0].PlayerID
+	inFlight, err := s.hasPendingTransactions(ctx, playerID)
+	if err != nil {
+		slog.Error("Failed to check pending transactions", "error", err, "player_id", playerID)
+		run.Errors += len(accounts)
+		return true
+	}
+	if inFlight {
+		run.Skipped += len(accounts)
+	}
+	return inFlight
+}
+
+// openLedgerAccount opens an account created by a movement from the wallet
+// balance, counting it as matched
+func (s *Service) openLedgerAccount(ctx context.Context, run *models.ReconciliationRun, account *models.LedgerBalance, actual models.Amount) {
+	opened, err := s.Repository.OpenLedgerAccount(ctx, account.PlayerID, account.Currency, actual, account.Balance)
+	switch {
+	case err != nil:
+		slog.Error("Failed to open ledger account", "error", err, "player_id", account.PlayerID, "currency", account.Currency)
+		run.Errors++
+	case !opened:
+		// A movement was posted or queued meanwhile
+		run.Skipped++
+	default:
+		run.Matched++
+		slog.Info("Opened ledger account", "run_id", run.ID, "player_id", account.PlayerID, "currency", account.Currency, "balance", actual, "posted", account.Balance)
+	}
+}
+
+// groupByPlayer splits balances ordered by player into the accounts of each player
+func groupByPlayer(balances []*models.LedgerBalance) [][]*models.LedgerBalance {
+	var players [][]*models.LedgerBalance
+	for i, balance := range balances {
+		if i == 0 || balance.PlayerID != balances[i-1].PlayerID {
+			players = append(players, nil)
+		}
+		players[len(players)-1] = append(players[len(players)-1], balance)
+	}
+	return players
+}
+
+func (s *Service) ListReconciliationRuns(ctx context.Context, limit, offset int) ([]shared.ReconciliationRunResponse, error) {
+	runs, err := s.Repository.ListReconciliationRuns(ctx, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reconciliation runs: %w", err)
+	}
+
+	resp := make([]shared.ReconciliationRunResponse, 0, len(runs))
+	for _, run := range runs {
+		resp = append(resp, reconciliationRunResponse(run))
+	}
+	return resp, nil
+}
+
+func (s *Service) GetReconciliationRun(ctx context.Context, id uuid.UUID) (*shared.ReconciliationRunResponse, error) {
+	run, err := s.Repository.GetReconciliationRunByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reconciliation run: %w", err)
+	}
+	if run == nil {
+		return nil, ErrReconciliationRunNotFound
+	}
+
+	resp := reconciliationRunResponse(run)
+	return &resp, nil
+}
+
+func reconciliationRunResponse(run *models.ReconciliationRun) shared.ReconciliationRunResponse {
+	resp := shared.ReconciliationRunResponse{
+		ID:            run.ID,
+		Accounts:      run.Accounts,
+		Matched:       run.Matched,
+		Discrepancies: run.Discrepancies,
+		Skipped:       run.Skipped,
+		Errors:        run.Errors,
+		StartedAt:     run.StartedAt,
+	}
+	if !run.FinishedAt.IsZero() {
+		resp.FinishedAt = &run.FinishedAt
+	}
+
+	for _, item := range run.Items {
+		resp.Items = append(resp.Items, shared.ReconciliationDiscrepancyResponse{
+			PlayerID:       item.PlayerID,
+			Currency:       item.Currency,
+			Kind:           item.Kind,
+			Expected:       item.Expected,
+			Actual:         item.Actual,
+			Difference:     item.Actual - item.Expected,
+			WalletCurrency: item.WalletCurrency,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+)
+
+// balanceServer serves the wallet balance endpoint from balances, USD
+// unless a currency is set for the player
+type balanceServer struct {
+	mu         sync.Mutex
+	balances   map[uint64]string
+	currencies map[uint64]string
+	// served is called with the player id before each balance is served
+	served func(playerID uint64)
+}
+
+func (b *balanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if b.served != nil {
+		b.served(id)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	balance, ok := b.balances[id]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(walletclient.ErrorResponse{Code: walletclient.ErrCodeUserNotFound, Msg: "user not found"})
+		return
+	}
+	currency := b.currencies[id]
+	if currency == "" {
+		currency = string(models.CurrencyUSD)
+	}
+	json.NewEncoder(w).Encode(walletclient.BalanceResponse{Balance: balance, Currency: currency})
+}
+
+// newReconciliationService returns a service reconciling against a wallet
+// served over HTTP by wallet
+func newReconciliationService(t *testing.T, wallet *balanceServer) (*Service, *memoryRepository) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/balance/{id}", wallet)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	timeouts := walletclient.Timeouts{Connect: time.Second, Read: time.Second}
+	repo := newMemoryRepository()
+	return NewService(repo, walletclient.NewWalletClient(server.URL, "test", timeouts, timeouts)), repo
+}
+
+// openAccount opens the USD ledger account of a player with balance
+func openAccount(t *testing.T, repo *memoryRepository, playerID uint64, balance models.Amount) {
+	t.Helper()
+	opened, err := repo.OpenLedgerAccount(context.Background(), playerID, models.CurrencyUSD, balance, 0)
+	if err != nil || !opened {
+		t.Fatalf("opening the account of player %d: %t, %v", playerID, opened, err)
+	}
+}
+
+func TestReconcileAgainstWallet(t *testing.T) {
+	wallet := &balanceServer{
+		balances: map[uint64]string{
+			1: "1000.00",
+			2: "990.50",
+			3: "1000.00",
+		},
+		currencies: map[uint64]string{3: string(models.CurrencyEUR)},
+	}
+	s, repo := newReconciliationService(t, wallet)
+	openAccount(t, repo, 1, models.NewAmount(1000))
+	openAccount(t, repo, 2, models.NewAmount(1000))
+	openAccount(t, repo, 3, models.NewAmount(1000))
+	// Unknown to the wallet
+	openAccount(t, repo, 4, models.NewAmount(1000))
+
+	run, err := s.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Accounts != 4 || run.Matched != 1 || run.Discrepancies != 2 || run.Errors != 1 || run.Skipped != 0 {
+		t.Errorf("run counted %d accounts, %d matched, %d discrepancies, %d errors and %d skipped, want 4, 1, 2, 1 and 0",
+			run.Accounts, run.Matched, run.Discrepancies, run.Errors, run.Skipped)
+	}
+	if run.FinishedAt == nil {
+		t.Error("run is not finished")
+	}
+
+	if len(run.Items) != 2 {
+		t.Fatalf("run recorded %d discrepancies, want 2: %+v", len(run.Items), run.Items)
+	}
+	for _, item := range run.Items {
+		switch item.PlayerID {
+		case 2:
+			if item.Kind != models.DiscrepancyBalanceMismatch || item.Expected != models.NewAmount(1000) || item.Actual != 9905000 || item.Difference != -95000 {
+				t.Errorf("drifted balance recorded as %+v", item)
+			}
+		case 3:
+			if item.Kind != models.DiscrepancyCurrencyMismatch || item.WalletCurrency != string(models.CurrencyEUR) {
+				t.Errorf("currency mismatch recorded as %+v", item)
+			}
+		default:
+			t.Errorf("discrepancy recorded for player %d: %+v", item.PlayerID, item)
+		}
+	}
+}
+
+func TestReconcileSkipsPlayersInFlight(t *testing.T) {
+	wallet := &balanceServer{balances: map[uint64]string{testPlayer.ID: "900.00"}}
+	s, repo := newReconciliationService(t, wallet)
+	openAccount(t, repo, testPlayer.ID, models.NewAmount(1000))
+
+	// The wallet already applied a bet the ledger doesn't have yet
+	setTestConfig(t)
+	placeBet(t, s, 1, models.NewAmount(100))
+
+	run, err := s.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Skipped != 1 || run.Discrepancies != 0 {
+		t.Errorf("run counted %d skipped and %d discrepancies, want the account skipped", run.Skipped, run.Discrepancies)
+	}
+}
+
+func TestReconcileSkipsPlayersClaimedDuringTheWalletRead(t *testing.T) {
+	wallet := &balanceServer{balances: map[uint64]string{testPlayer.ID: "900.00"}}
+	s, repo := newReconciliationService(t, wallet)
+	openAccount(t, repo, testPlayer.ID, models.NewAmount(1000))
+
+	// A bet is claimed and applied by the wallet while its balance is read
+	wallet.served = func(playerID uint64) {
+		err := repo.CreateTransaction(context.Background(), &models.Transaction{
+			PlayerID:   playerID,
+			ProviderID: 1,
+			Amount:     models.NewAmount(100),
+			Currency:   models.CurrencyUSD,
+			Status:     models.TransactionStatusPending,
+			Type:       models.TransactionTypeWithdraw,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if _, err := repo.ClaimTransactions(context.Background(), "worker/0", 0, 1, 10, time.Minute); err != nil {
+			t.Error(err)
+		}
+	}
+
+	run, err := s.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Skipped != 1 || run.Discrepancies != 0 {
+		t.Errorf("run counted %d skipped and %d discrepancies, want the account skipped", run.Skipped, run.Discrepancies)
+	}
+}
+
+// ledgerOutage is a repository whose ledger balances can't be listed
+type ledgerOutage struct {
+	*memoryRepository
+}
+
+func (ledgerOutage) ListLedgerBalances(ctx context.Context, afterPlayerID uint64, limit int) ([]*models.LedgerBalance, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestReconcileFinishesTheRunWhenTheLedgerCantBeRead(t *testing.T) {
+	repo := newMemoryRepository()
+	s := NewService(ledgerOutage{repo}, walletclient.NewFakeWallet(string(models.CurrencyUSD), 0))
+
+	run, err := s.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Errors != 1 || run.FinishedAt == nil {
+		t.Errorf("run counted %d errors and finished at %v, want 1 error and finished", run.Errors, run.FinishedAt)
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+// retryPolicy returns the configured retry policy of a transaction type
+func retryPolicy(txType models.TransactionType) internal.RetryPolicy {
+	return internal.Config.RETRY_POLICIES[string(txType)]
+}
+
+// nextAttemptAt schedules the next attempt of a transaction that failed
+// attempts times. The delay is jittered between half and all of retryDelay
+// so transactions that failed together are not all retried at the same time.
+func nextAttemptAt(txType models.TransactionType, attempts int) time.Time {
+	delay := retryDelay(retryPolicy(txType), attempts)
+	if delay <= 0 {
+		return time.Now()
+	}
+
+	half := delay / 2
+	return time.Now().Add(half + rand.N(delay-half+1))
+}
+
+// retryDelay is the delay before retrying a transaction that failed attempts
+// times. It doubles after each attempt from the policy base delay, capped at
+// its max delay. The delay stops doubling once it is past half the max delay,
+// so it never overflows however many attempts were made.
+func retryDelay(policy internal.RetryPolicy, attempts int) time.Duration {
+	delay := policy.BaseDelay
+	for attempt := 1; attempt < attempts && delay > 0 && delay < policy.MaxDelay; attempt++ {
+		if delay > policy.MaxDelay>>1 {
+			return policy.MaxDelay
+		}
+		delay <<= 1
+	}
+	return min(delay, policy.MaxDelay)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+func TestRetryDelay(t *testing.T) {
+	policy := internal.RetryPolicy{MaxAttempts: 100, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute}
+	unbounded := internal.RetryPolicy{MaxAttempts: 100, BaseDelay: 5 * time.Second, MaxDelay: math.MaxInt64}
+
+	tests := []struct {
+		name     string
+		policy   internal.RetryPolicy
+		attempts int
+		want     time.Duration
+	}{
+		{"no attempt yet", policy, 0, 5 * time.Second},
+		{"first attempt", policy, 1, 5 * time.Second},
+		{"second attempt", policy, 2, 10 * time.Second},
+		{"sixth attempt", policy, 6, 160 * time.Second},
+		{"capped", policy, 7, 5 * time.Minute},
+		{"shift of 31", policy, 32, 5 * time.Minute},
+		{"shift of 32", policy, 33, 5 * time.Minute},
+		{"shift past the int64 width", policy, 100, 5 * time.Minute},
+		{"max attempts", policy, math.MaxInt, 5 * time.Minute},
+		{"base delay past the max delay", internal.RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Minute}, 1, time.Minute},
+		{"no base delay", internal.RetryPolicy{MaxDelay: time.Minute}, 10, 0},
+		// 5s << 31 overflows int64, the delay stops at the max delay instead
+		{"unbounded max delay", unbounded, 32, math.MaxInt64},
+		{"unbounded max delay, last doubling", unbounded, 31, 5 * time.Second << 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(tt.policy, tt.attempts); got != tt.want {
+				t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextAttemptAtBacksOff(t *testing.T) {
+	config := internal.Config
+	t.Cleanup(func() { internal.Config = config })
+	internal.Config.RETRY_POLICIES = map[string]internal.RetryPolicy{
+		string(models.TransactionTypeWithdraw): {MaxAttempts: 1000, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute},
+	}
+
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{0, 5 * time.Second},
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{6, 160 * time.Second},
+		{7, 5 * time.Minute},
+		{10, 5 * time.Minute},
+		{64, 5 * time.Minute},
+		{1000, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		before := time.Now()
+		next := nextAttemptAt(models.TransactionTypeWithdraw, tt.attempts)
+		if next.Before(before.Add(tt.delay/2)) || next.After(time.Now().Add(tt.delay)) {
+			t.Errorf("attempt %d is retried in %s, want between %s and %s", tt.attempts, next.Sub(before), tt.delay/2, tt.delay)
+		}
+	}
+}
+
+func TestWorkerWaitsForTheRetryDelay(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	internal.Config.RETRY_POLICIES[string(models.TransactionTypeWithdraw)] = internal.RetryPolicy{
+		MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour,
+	}
+
+	placeBet(t, s, 1, models.NewAmount(5000))
+	placeBet(t, s, 2, models.NewAmount(10))
+	dispatch(t, s)
+
+	bet := storedTransaction(t, repo, 1)
+	assertStatus(t, bet, models.TransactionStatusPending)
+	if bet.Attempts != 1 {
+		t.Errorf("bet took %d attempts before its retry was due, want 1", bet.Attempts)
+	}
+	if wait := time.Until(bet.NextAttemptAt); wait < 30*time.Minute {
+		t.Errorf("bet is retried in %s, want at least 30m", wait)
+	}
+
+	// The later bet was sent along with the first one and is not retried
+	// before it either
+	later := storedTransaction(t, repo, 2)
+	assertStatus(t, later, models.TransactionStatusPending)
+	if later.Attempts != 1 {
+		t.Errorf("later bet took %d attempts, want 1", later.Attempts)
+	}
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+var (
+	ErrRoundNotFound = errors.New("round not found")
+	ErrRoundClosed   = errors.New("round is closed")
+)
+
+// attachRound attaches tx to the round of the request, opening it when the
+// provider reports it for the first time. Bets and wins are refused once the
+// round is closed. The round is closed after tx when the request says so.
+func attachRound(ctx context.Context, repo repository.Repository, tx *models.Transaction, req shared.RoundRequest) (*models.Round, error) {
+	if req.RoundID == "" {
+		if req.RoundClosed {
+			return nil, errors.New("round_closed needs a round_id")
+		}
+		return nil, nil
+	}
+
+	round := &models.Round{
+		PlayerID:        tx.PlayerID,
+		ProviderRoundID: req.RoundID,
+		GameID:          req.GameID,
+		Currency:        tx.Currency,
+		Status:          models.RoundStatusOpen,
+	}
+	if err := repo.OpenRound(ctx, round); err != nil {
+		return nil, fmt.Errorf("failed to open round: %w", err)
+	}
+	if round.Status == models.RoundStatusClosed {
+		return nil, fmt.Errorf("%w: %s", ErrRoundClosed, round.ProviderRoundID)
+	}
+	if round.Currency != tx.Currency {
+		return nil, fmt.Errorf("round %s is played in %s", round.ProviderRoundID, round.Currency)
+	}
+	tx.RoundID = round.ID
+	return round, nil
+}
+
+// CloseRound closes a round of a player, i.e. the explicit end of round
+// signal of the provider. Closing a closed round is a no-op.
+func (s *Service) CloseRound(ctx context.Context, player *models.Player, req shared.CloseRoundRequest) (*shared.RoundResponse, error) {
+	round, err := s.Repository.GetRoundByProviderID(ctx, player.ID, req.RoundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get round: %w", err)
+	}
+	if round == nil {
+		return nil, ErrRoundNotFound
+	}
+
+	if err := s.Repository.CloseRound(ctx, round); err != nil {
+		return nil, fmt.Errorf("failed to close round: %w", err)
+	}
+	return roundResponse(round), nil
+}
+
+// RollbackRound cancels what is left of every bet and win of a round of a
+// player, oldest first so the bets are given back before the wins are taken
+// back. The cancels are queued in a single db transaction and answered
+// pending, a round with nothing left to cancel is answered without any.
+func (s *Service) RollbackRound(ctx context.Context, player *models.Player, req shared.RollbackRoundRequest) (*shared.RoundRollbackResponse, error) {
+	round, err := s.Repository.GetRoundByProviderID(ctx, player.ID, req.RoundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get round: %w", err)
+	}
+	if round == nil {
+		return nil, ErrRoundNotFound
+	}
+
+	transactions, err := s.Repository.GetTransactionsByRoundID(ctx, round.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the transactions of the round: %w", err)
+	}
+
+	var cancels []*models.Transaction
+	err = s.Repository.WithTx(ctx, func(repo repository.Repository) error {
+		cancels = nil
+		for _, original := range transactions {
+			if original.Type == models.TransactionTypeCancel ||
+				original.Status == models.TransactionStatusFailed ||
+				original.Refundable() <= 0 {
+				continue
+			}
+
+			cancel := &models.Transaction{
+				PlayerID:           player.ID,
+				WithdrawProviderID: original.ProviderID,
+				Amount:             original.Refundable(),
+				Currency:           original.Currency,
+				Status:             models.TransactionStatusPending,
+				Type:               models.TransactionTypeCancel,
+				RoundID:            round.ID,
+			}
+			if err := queueTransaction(ctx, repo, cancel, original, nil); err != nil {
+				return err
+			}
+			cancels = append(cancels, cancel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back round: %w", err)
+	}
+
+	resp := &shared.RoundRollbackResponse{
+		RoundID: round.ProviderRoundID,
+		Cancels: make([]shared.BetOperationResponse, 0, len(cancels)),
+	}
+	for _, cancel := range cancels {
+		resp.Cancels = append(resp.Cancels, shared.BetOperationResponse{
+			TransactionID:         cancel.ID,
+			ProviderTransactionID: cancel.WithdrawProviderID,
+			Status:                cancel.Status,
+		})
+	}
+	if len(cancels) > 0 {
+		s.notifyPending(ctx, cancels[0])
+	}
+
+	slog.Info("Round rolled back", "round_id", round.ProviderRoundID, "player_id", player.ID, "cancels", len(cancels))
+	return resp, nil
+}
+
+func roundResponse(round *models.Round) *shared.RoundResponse {
+	resp := &shared.RoundResponse{
+		ID:        round.ID,
+		RoundID:   round.ProviderRoundID,
+		GameID:    round.GameID,
+		Currency:  round.Currency,
+		Status:    round.Status,
+		TotalBet:  round.TotalBet,
+		TotalWon:  round.TotalWon,
+		CreatedAt: round.CreatedAt,
+	}
+	if !round.ClosedAt.IsZero() {
+		closedAt := round.ClosedAt
+		resp.ClosedAt = &closedAt
+	}
+	return resp
+}
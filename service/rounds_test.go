@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+func TestRoundTotalsFollowConfirmedTransactions(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.ProcessBet(ctx, testPlayer, shared.WithdrawRequest{
+		Currency:              models.CurrencyUSD,
+		Amount:                models.NewAmount(100),
+		ProviderTransactionID: 1,
+		RoundRequest:          shared.RoundRequest{RoundID: "r-1", GameID: "starburst"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	round, err := repo.GetRoundByProviderID(ctx, testPlayer.ID, "r-1")
+	if err != nil || round == nil {
+		t.Fatalf("round r-1 is %+v: %v", round, err)
+	}
+	if round.TotalBet != 0 {
+		t.Errorf("round bet %s before the bet is confirmed, want 0.00", round.TotalBet)
+	}
+	dispatch(t, s)
+
+	// The settlement is attached to the round of its bet and closes it
+	_, err = s.ProcessSettle(ctx, testPlayer, shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		Amount:                         models.NewAmount(250),
+		ProviderTransactionID:          2,
+		ProviderWithdrawnTransactionID: 1,
+		RoundRequest:                   shared.RoundRequest{RoundClosed: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+
+	if settle := storedTransaction(t, repo, 2); settle.RoundID != round.ID {
+		t.Errorf("settlement is in round %s, want %s", settle.RoundID, round.ID)
+	}
+	round, err = repo.GetRoundByID(ctx, round.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round.Status != models.RoundStatusClosed || round.TotalBet != models.NewAmount(100) || round.TotalWon != models.NewAmount(250) {
+		t.Errorf("round is %s with %s bet and %s won, want CLOSED with 100.00 and 250.00", round.Status, round.TotalBet, round.TotalWon)
+	}
+}
+
+func TestClosedRoundsRefuseBets(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	bet := func(providerID uint64) error {
+		_, err := s.ProcessBet(ctx, testPlayer, shared.WithdrawRequest{
+			Currency:              models.CurrencyUSD,
+			Amount:                models.NewAmount(100),
+			ProviderTransactionID: providerID,
+			RoundRequest:          shared.RoundRequest{RoundID: "r-1"},
+		})
+		return err
+	}
+	if err := bet(1); err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+
+	resp, err := s.CloseRound(ctx, testPlayer, shared.CloseRoundRequest{RoundID: "r-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != models.RoundStatusClosed || resp.ClosedAt == nil {
+		t.Errorf("closed round answered %+v", resp)
+	}
+	// Closing twice is a no-op
+	if _, err := s.CloseRound(ctx, testPlayer, shared.CloseRoundRequest{RoundID: "r-1"}); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+
+	if err := bet(2); !errors.Is(err, ErrRoundClosed) {
+		t.Errorf("bet in a closed round returned %v, want ErrRoundClosed", err)
+	}
+
+	// Cancels are still accepted and net out of the totals
+	_, err = s.ProcessCancel(ctx, testPlayer, shared.CancelRequest{ProviderTransactionID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+	assertBalance(t, wallet, models.NewAmount(1000))
+
+	round, err := repo.GetRoundByProviderID(ctx, testPlayer.ID, "r-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round.TotalBet != 0 {
+		t.Errorf("round bet is %s after the cancel, want 0.00", round.TotalBet)
+	}
+
+	if _, err := s.CloseRound(ctx, testPlayer, shared.CloseRoundRequest{RoundID: "r-2"}); !errors.Is(err, ErrRoundNotFound) {
+		t.Errorf("closing an unknown round returned %v, want ErrRoundNotFound", err)
+	}
+}
@@ -1,20 +1,70 @@
 package service
 
 import (
+	"log/slog"
+
 	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
 	"github.com/jihedmastouri/game-integration-api-demo/repository"
 	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
 )
 
 type Service struct {
 	repository.Repository
-	WalletClient *walletclient.WalletClient
+	WalletClient walletclient.Wallet
+
+	dispatches *dispatchWaiters
 }
 
-func NewService(repo repository.Repository) *Service {
-	walletClient := walletclient.NewWalletClient(internal.Config.WALLET_API_URL, internal.Config.WALLET_API_KEY)
+func NewService(repo repository.Repository, wallet walletclient.Wallet) *Service {
 	return &Service{
 		Repository:   repo,
-		WalletClient: walletClient,
+		WalletClient: wallet,
+		dispatches:   newDispatchWaiters(),
+	}
+}
+
+// NewWallet builds the wallet configured in internal.Config, behind a
+// circuit breaker
+func NewWallet() walletclient.Wallet {
+	var wallet walletclient.Wallet
+	if internal.Config.WALLET_FAKE {
+		slog.Warn("Using the in-memory fake wallet")
+		wallet = walletclient.NewFakeWallet(string(models.CurrencyUSD), models.NewAmount(1000))
+	} else {
+		wallet = walletclient.NewWalletClient(
+			internal.Config.WALLET_API_URL,
+			internal.Config.WALLET_API_KEY,
+			walletclient.Timeouts{
+				Connect: internal.Config.WALLET_BALANCE_CONNECT_TIMEOUT,
+				Read:    internal.Config.WALLET_BALANCE_READ_TIMEOUT,
+			},
+			walletclient.Timeouts{
+				Connect: internal.Config.WALLET_OPERATION_CONNECT_TIMEOUT,
+				Read:    internal.Config.WALLET_OPERATION_READ_TIMEOUT,
+			},
+		)
 	}
+
+	return walletclient.NewCircuitBreaker(wallet, walletclient.BreakerConfig{
+		FailureThreshold: internal.Config.WALLET_BREAKER_FAILURE_THRESHOLD,
+		OpenTimeout:      internal.Config.WALLET_BREAKER_OPEN_TIMEOUT,
+		HalfOpenProbes:   internal.Config.WALLET_BREAKER_HALF_OPEN_PROBES,
+	})
+}
+
+// WalletState returns the state of the wallet circuit breaker, or an empty
+// state when the wallet is not behind one.
+func (s *Service) WalletState() walletclient.BreakerState {
+	breaker, ok := s.WalletClient.(*walletclient.CircuitBreaker)
+	if !ok {
+		return ""
+	}
+	return breaker.State()
+}
+
+// walletAvailable is false while the wallet circuit breaker is open. Callers
+// should queue their transaction instead of calling the wallet.
+func (s *Service) walletAvailable() bool {
+	return s.WalletState() != walletclient.BreakerOpen
 }
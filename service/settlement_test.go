@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+func TestSettleSeveralBets(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	for providerID := uint64(1); providerID <= 3; providerID++ {
+		placeBet(t, s, providerID, models.NewAmount(100))
+	}
+	dispatch(t, s)
+
+	resp, err := s.ProcessSettle(ctx, testPlayer, shared.DepositRequest{
+		Currency:              models.CurrencyUSD,
+		ProviderTransactionID: 4,
+		Bets: []shared.SettleBetRequest{
+			{ProviderWithdrawnTransactionID: 1, Amount: models.NewAmount(250)},
+			{ProviderWithdrawnTransactionID: 2},
+			{ProviderWithdrawnTransactionID: 3, Amount: models.NewAmount(50)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settlement := storedTransaction(t, repo, 4)
+	if settlement.Amount != models.NewAmount(300) || settlement.WithdrawProviderID != 1 {
+		t.Errorf("settlement is for %s of bet %d, want 300.00 of bet 1", settlement.Amount, settlement.WithdrawProviderID)
+	}
+	// The lost bet moves no money, it has no command
+	commands := walletCommands(t, s, repo, 4)
+	if len(commands) != 2 || commands[0].BetID != 1 || commands[0].Amount != models.NewAmount(250) ||
+		commands[1].BetID != 3 || commands[1].Amount != models.NewAmount(50) {
+		t.Errorf("settlement commands are %+v, want 250.00 on bet 1 and 50.00 on bet 3", commands)
+	}
+
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 4), models.TransactionStatusConfirmed)
+	for providerID := uint64(1); providerID <= 3; providerID++ {
+		assertStatus(t, storedTransaction(t, repo, providerID), models.TransactionStatusFinalized)
+	}
+	assertBalance(t, wallet, models.NewAmount(1000))
+
+	// A retry is answered like the first time
+	again, err := s.ProcessSettle(ctx, testPlayer, shared.DepositRequest{
+		Currency:              models.CurrencyUSD,
+		ProviderTransactionID: 4,
+		Bets: []shared.SettleBetRequest{
+			{ProviderWithdrawnTransactionID: 1, Amount: models.NewAmount(250)},
+			{ProviderWithdrawnTransactionID: 2},
+			{ProviderWithdrawnTransactionID: 3, Amount: models.NewAmount(50)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.TransactionID != resp.TransactionID {
+		t.Errorf("retry answered transaction %s, want %s", again.TransactionID, resp.TransactionID)
+	}
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestSettleSeveralBetsChecksTheRequest(t *testing.T) {
+	s, _, _ := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	for providerID, roundID := range map[uint64]string{2: "r-1", 3: "r-2"} {
+		_, err := s.ProcessBet(ctx, testPlayer, shared.WithdrawRequest{
+			Currency:              models.CurrencyUSD,
+			Amount:                models.NewAmount(100),
+			ProviderTransactionID: providerID,
+			RoundRequest:          shared.RoundRequest{RoundID: roundID},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dispatch(t, s)
+
+	tests := []struct {
+		name string
+		req  shared.DepositRequest
+		want string
+	}{
+		{
+			name: "single and several bets",
+			req: shared.DepositRequest{ProviderWithdrawnTransactionID: 1, Bets: []shared.SettleBetRequest{
+				{ProviderWithdrawnTransactionID: 1},
+			}},
+			want: "Settle either provider_withdrawn_transaction_id or bets, not both.",
+		},
+		{
+			name: "bet settled twice",
+			req: shared.DepositRequest{Bets: []shared.SettleBetRequest{
+				{ProviderWithdrawnTransactionID: 1, Amount: models.NewAmount(10)},
+				{ProviderWithdrawnTransactionID: 1, Amount: models.NewAmount(10)},
+			}},
+			want: "Bet 1 is settled twice.",
+		},
+		{
+			name: "amount is not the sum",
+			req: shared.DepositRequest{Amount: models.NewAmount(30), Bets: []shared.SettleBetRequest{
+				{ProviderWithdrawnTransactionID: 2, Amount: models.NewAmount(10)},
+				{ProviderWithdrawnTransactionID: 3, Amount: models.NewAmount(10)},
+			}},
+			want: "The amount should be the sum of the wins, 20.00.",
+		},
+		{
+			name: "bets of different rounds",
+			req: shared.DepositRequest{Bets: []shared.SettleBetRequest{
+				{ProviderWithdrawnTransactionID: 2, Amount: models.NewAmount(10)},
+				{ProviderWithdrawnTransactionID: 3, Amount: models.NewAmount(10)},
+			}},
+			want: "Bets 2 and 3 were placed in different rounds.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Currency = models.CurrencyUSD
+			req.ProviderTransactionID = 10
+			_, err := s.ProcessSettle(ctx, testPlayer, req)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
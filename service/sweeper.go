@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
+)
+
+// sweepBatchSize is the number of stale transactions recovered per query
+const sweepBatchSize = 100
+
+// runTransactionSweeper periodically recovers the processing transactions
+// whose lease expired, until ctx is done
+func (s *Service) runTransactionSweeper(ctx context.Context) {
+	ticker := time.NewTicker(internal.Config.SWEEPER_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepStaleTransactions(ctx, "")
+		}
+	}
+}
+
+// sweepStaleTransactions recovers the stale processing transactions, see
+// GetStaleTransactions for workerID. The wallet can't be queried by
+// reference, so a transaction is only confirmed when its last recorded
+// attempt was acknowledged, otherwise it goes back to the pending queue and
+// is re-submitted with the same reference, which the wallet deduplicates.
+func (s *Service) sweepStaleTransactions(ctx context.Context, workerID string) {
+	for {
+		stale, err := s.Repository.GetStaleTransactions(ctx, workerID, sweepBatchSize)
+		if err != nil {
+			slog.Error("Failed to get stale transactions", "error", err)
+			return
+		}
+
+		recovered := 0
+		for _, tx := range stale {
+			if s.recoverStaleTransaction(ctx, tx) {
+				recovered++
+			}
+		}
+
+		// Stop when everything was swept, or when the remaining rows can't be
+		// recovered right now so the next sweep retries them
+		if len(stale) < sweepBatchSize || recovered == 0 {
+			return
+		}
+	}
+}
+
+// recoverStaleTransaction decides the state of a stale processing transaction
+// and records the decision in the audit trail. It returns false when the
+// transaction was not recovered.
+func (s *Service) recoverStaleTransaction(ctx context.Context, tx *models.Transaction) bool {
+	recovery := &models.TransactionRecovery{
+		TransactionID:       tx.ID,
+		PlayerID:            tx.PlayerID,
+		PreviousLockedBy:    tx.LockedBy,
+		PreviousLockedUntil: tx.LockedUntil,
+		SweptBy:             internal.Config.WORKER_ID,
+	}
+
+	lastAttempt, err := s.Repository.GetLastTransactionAttempt(ctx, tx.ID)
+	if err != nil {
+		slog.Error("Failed to get last transaction attempt", "error", err, "transaction_id", tx.ID)
+		return false
+	}
+
+	var (
+		settled  []*models.Transaction
+		commands []*models.WalletCommand
+	)
+	switch {
+	case lastAttempt != nil && lastAttempt.ErrorCode == "":
+		// The worker died between the wallet answer and saving the transaction
+		recovery.Decision = models.RecoveryDecisionConfirmed
+		recovery.Reason = fmt.Sprintf("the wallet acknowledged the last attempt at %s", lastAttempt.AttemptedAt.Format(time.RFC3339))
+		tx.Status = models.TransactionStatusConfirmed
+
+		settles, err := s.settledTransactions(ctx, tx)
+		if err != nil {
+			slog.Error("Failed to get the transactions settled by a stale transaction", "error", err, "transaction_id", tx.ID)
+			return false
+		}
+		settled, err = finalizedBy(ctx, s.Repository, tx, settles)
+		if err != nil {
+			slog.Error("Failed to get the transactions finalized by a stale transaction", "error", err, "transaction_id", tx.ID)
+			return false
+		}
+		for _, settledTx := range settled {
+			settledTx.Status = models.TransactionStatusFinalized
+		}
+
+		commands, err = s.Repository.GetWalletCommandsByTransactionID(ctx, tx.ID)
+		if err != nil {
+			slog.Error("Failed to get the wallet commands of a stale transaction", "error", err, "transaction_id", tx.ID)
+			return false
+		}
+		balance := s.walletBalance(ctx, tx)
+		for _, command := range commands {
+			command.Balance = balance
+		}
+
+	case lastAttempt != nil:
+		recovery.Decision = models.RecoveryDecisionRequeued
+		recovery.Reason = fmt.Sprintf("the last attempt failed with %s, re-submitting with the same reference", lastAttempt.ErrorCode)
+		tx.Status = models.TransactionStatusPending
+		tx.NextAttemptAt = time.Now()
+
+	default:
+		recovery.Decision = models.RecoveryDecisionRequeued
+		recovery.Reason = "no wallet attempt was recorded, re-submitting with the same reference"
+		tx.Status = models.TransactionStatusPending
+		tx.NextAttemptAt = time.Now()
+	}
+
+	tx.LockedBy = ""
+	tx.LockedUntil = time.Time{}
+	recovery.Status = tx.Status
+
+	var recovered bool
+	err = s.Repository.WithTx(ctx, func(repo repository.Repository) error {
+		recovered, err = repo.RecoverTransaction(ctx, recovery, tx, settled...)
+		if err != nil || !recovered {
+			return err
+		}
+		return markDelivered(ctx, repo, commands)
+	})
+	if err != nil {
+		slog.Error("Failed to recover stale transaction", "error", err, "transaction_id", tx.ID)
+		return false
+	}
+	if !recovered {
+		slog.Info("Stale transaction was recovered or completed concurrently", "transaction_id", tx.ID)
+		return false
+	}
+
+	s.notifyPending(ctx, tx)
+
+	slog.Warn("Recovered stale transaction", "transaction_id", tx.ID, "player_id", tx.PlayerID, "decision", recovery.Decision, "reason", recovery.Reason, "previous_locked_by", recovery.PreviousLockedBy, "previous_locked_until", recovery.PreviousLockedUntil)
+	return true
+}
+
+// walletBalance returns the wallet balance of the player of a stale
+// transaction the wallet acknowledged, empty when it can't be read. No other
+// transaction of the player was sent to the wallet since, the stale one still
+// holds the player's queue.
+func (s *Service) walletBalance(ctx context.Context, tx *models.Transaction) string {
+	balanceResp, err := s.WalletClient.GetBalance(ctx, tx.PlayerID)
+	if err != nil {
+		slog.Warn("Failed to get the wallet balance of a stale transaction", "error", err, "transaction_id", tx.ID)
+		return ""
+	}
+	if balanceResp.Currency != string(tx.Currency) {
+		return ""
+	}
+	return balanceResp.Balance
+}
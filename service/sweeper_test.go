@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+// strandBet places a bet the wallet can't pay yet, then leases it to worker
+// the way a worker that died while processing it would have left it
+func strandBet(t *testing.T, s *Service, repo *memoryRepository, providerID uint64, worker string, lease time.Duration) *models.Transaction {
+	t.Helper()
+
+	placeBet(t, s, providerID, models.NewAmount(5000))
+	claimed, err := repo.ClaimTransactions(context.Background(), worker, 0, 1, 10, lease)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("claimed %d transactions (%v), want the bet", len(claimed), err)
+	}
+	return claimed[0]
+}
+
+func lastRecovery(t *testing.T, repo *memoryRepository) *models.TransactionRecovery {
+	t.Helper()
+	if len(repo.recoveries) == 0 {
+		t.Fatal("no recovery was recorded")
+	}
+	return repo.recoveries[len(repo.recoveries)-1]
+}
+
+func TestSweeperRequeuesStaleTransaction(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	bet := strandBet(t, s, repo, 1, "dead/0", -time.Second)
+
+	s.sweepStaleTransactions(context.Background(), "")
+
+	stored := storedTransaction(t, repo, 1)
+	assertStatus(t, stored, models.TransactionStatusPending)
+	if stored.LockedBy != "" || !stored.LockedUntil.IsZero() {
+		t.Errorf("requeued bet is still leased to %q", stored.LockedBy)
+	}
+	recovery := lastRecovery(t, repo)
+	if recovery.Decision != models.RecoveryDecisionRequeued || recovery.PreviousLockedBy != "dead/0" || recovery.TransactionID != bet.ID {
+		t.Errorf("recorded %s of %s leased to %q, want REQUEUED of the bet leased to dead/0", recovery.Decision, recovery.TransactionID, recovery.PreviousLockedBy)
+	}
+
+	// It is re-submitted like any pending transaction
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(10000))
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(5000))
+}
+
+func TestSweeperConfirmsAcknowledgedAttempt(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	bet := strandBet(t, s, repo, 1, "dead/0", -time.Second)
+
+	// The wallet took the bet, the worker died before saving it
+	err := repo.CreateTransactionAttempt(context.Background(), &models.TransactionAttempt{
+		TransactionID: bet.ID,
+		Operation:     models.TransactionTypeWithdraw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.sweepStaleTransactions(context.Background(), "")
+
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	if recovery := lastRecovery(t, repo); recovery.Decision != models.RecoveryDecisionConfirmed {
+		t.Errorf("recorded %s, want CONFIRMED", recovery.Decision)
+	}
+	if command := walletCommand(t, s, repo, 1); command.DeliveredAt.IsZero() || command.Balance != "1000.00" {
+		t.Errorf("command is delivered at %v with balance %q, want delivered with 1000.00", command.DeliveredAt, command.Balance)
+	}
+	// Nothing is sent to the wallet again
+	dispatch(t, s)
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestSweeperLeavesLiveLeases(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	strandBet(t, s, repo, 1, "alive/0", time.Minute)
+
+	s.sweepStaleTransactions(context.Background(), "")
+
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusProcessing)
+	if len(repo.recoveries) != 0 {
+		t.Errorf("recorded %d recoveries, want none", len(repo.recoveries))
+	}
+}
+
+func TestSweeperRecoversLeasesOfAPreviousRun(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	strandBet(t, s, repo, 1, "test/2", time.Minute)
+
+	// Only the leases of the worker id are taken before they expire
+	s.sweepStaleTransactions(context.Background(), "tes")
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusProcessing)
+
+	s.sweepStaleTransactions(context.Background(), "test")
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusPending)
+}
@@ -3,13 +3,15 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jihedmastouri/game-integration-api-demo/models"
-	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
 	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
 )
 
@@ -29,232 +31,305 @@ func (s *Service) hasPendingTransactions(ctx context.Context, playerID uint64) (
 	return processingTxs != nil || pendingTxs != nil, nil
 }
 
-func (s *Service) ProcessBet(ctx context.Context, player *models.Player, req shared.WithdrawRequest) (*shared.BetOperationResponse, error) {
-	prevTx, err := s.GetTransactionByProviderID(ctx, req.ProviderTransactionID)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to check for any previous transactions: %w", err)
-	}
+// maxConflictRetries bounds how many times a transaction saved concurrently
+// by someone else is reloaded and its change re-evaluated
+const maxConflictRetries = 3
+
+// saveTransaction applies change to tx and saves it in repo on behalf of
+// actor. When tx was saved by someone else since it was read, it is reloaded
+// and change is re-evaluated on the stored copy. It returns false, leaving tx
+// as stored, when change no longer applies.
+func saveTransaction(ctx context.Context, repo repository.Repository, tx *models.Transaction, actor string, change func(tx *models.Transaction) bool) (bool, error) {
+	for attempt := 1; ; attempt++ {
+		if !change(tx) {
+			return false, nil
+		}
 
-	// reject duplicate transaction
-	if prevTx != nil {
-		return nil, fmt.Errorf("Duplicate transaction")
-	}
+		err := repo.UpdateTransaction(ctx, tx, actor)
+		var conflict *models.VersionConflictError
+		if !errors.As(err, &conflict) || attempt == maxConflictRetries {
+			return err == nil, err
+		}
+		slog.Info("Transaction was saved concurrently, reloading it", "transaction_id", tx.ID, "version", conflict.Version, "current_version", conflict.Current)
 
-	// Check if player has any pending transactions
-	hasPending, err := s.hasPendingTransactions(ctx, player.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check pending transactions: %w", err)
+		stored, err := repo.GetTransactionByID(ctx, tx.ID)
+		if err != nil {
+			return false, err
+		}
+		if stored == nil {
+			return false, conflict
+		}
+		*tx = *stored
 	}
+}
 
-	// Create transaction record
-	transaction := &models.Transaction{
-		PlayerID:   player.ID,
-		ProviderID: req.ProviderTransactionID,
-		Amount:     strconv.FormatFloat(req.Amount, 'f', -1, 64),
-		Currency:   req.Currency,
-		Status:     models.TransactionStatusPending,
-		Type:       models.TransactionTypeWithdraw,
-		Attempts:   0,
+// confirmTransaction confirms a transaction still waiting for the wallet
+func confirmTransaction(tx *models.Transaction) bool {
+	if tx.Status != models.TransactionStatusPending && tx.Status != models.TransactionStatusProcessing {
+		return false
 	}
+	tx.Status = models.TransactionStatusConfirmed
+	tx.LockedBy = ""
+	tx.LockedUntil = time.Time{}
+	return true
+}
 
-	err = s.Repository.CreateTransaction(ctx, transaction)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction: %w", err)
+// finalizeTransaction finalizes a confirmed transaction that was settled or cancelled
+func finalizeTransaction(tx *models.Transaction) bool {
+	if tx.Status != models.TransactionStatusConfirmed {
+		return false
 	}
+	tx.Status = models.TransactionStatusFinalized
+	return true
+}
 
-	// If player has pending transactions, keep this one pending too
-	if hasPending {
-		slog.Info("Player has pending transactions, keeping bet transaction pending", "player_id", player.ID, "transaction_id", transaction.ID)
-		return &shared.BetOperationResponse{
-			TransactionID:         transaction.ID,
-			ProviderTransactionID: req.ProviderTransactionID,
-			Status:                transaction.Status, // PENDING
-		}, nil
-	}
+var (
+	// ErrTransactionMismatch is returned when a provider transaction id is
+	// reused with a different payload
+	ErrTransactionMismatch = errors.New("provider transaction id was already used with a different payload")
+	// ErrRefundExceeded is returned when a cancel would reverse more than is
+	// left of its original transaction
+	ErrRefundExceeded = errors.New("refund exceeds the amount left to cancel")
+)
 
-	// Try to process with wallet service
-	balanceResp, err := s.WalletClient.GetBalance(player.ID)
+// replayTransaction answers a request retried with the provider transaction
+// id of prevTx, request being the transaction it would create. The original
+// response is returned when the payload is the same, ErrTransactionMismatch
+// otherwise.
+func (s *Service) replayTransaction(ctx context.Context, prevTx, request *models.Transaction) (*shared.BetOperationResponse, error) {
+	switch {
+	case prevTx.Type != request.Type:
+		return nil, fmt.Errorf("%w: it is a %s", ErrTransactionMismatch, prevTx.Type)
+	case prevTx.PlayerID != request.PlayerID:
+		return nil, fmt.Errorf("%w: it belongs to another player", ErrTransactionMismatch)
+	case prevTx.Amount != request.Amount || prevTx.Currency != request.Currency:
+		return nil, fmt.Errorf("%w: it was for %s %s", ErrTransactionMismatch, prevTx.Amount, prevTx.Currency)
+	case prevTx.WithdrawProviderID != request.WithdrawProviderID:
+		return nil, fmt.Errorf("%w: it settles bet %d", ErrTransactionMismatch, prevTx.WithdrawProviderID)
+	}
+
+	stored, err := s.GetTransactionResponse(ctx, prevTx.ID)
 	if err != nil {
-		slog.Error("Failed to get balance, keeping transaction pending", "error", err, "player_id", player.ID, "transaction_id", transaction.ID)
+		return nil, fmt.Errorf("failed to get the original response: %w", err)
+	}
+	if stored == nil {
+		// The first request is still being answered, or failed before storing it
 		return &shared.BetOperationResponse{
-			TransactionID:         transaction.ID,
-			ProviderTransactionID: req.ProviderTransactionID,
-			Status:                transaction.Status, // PENDING
+			TransactionID:         prevTx.ID,
+			ProviderTransactionID: prevTx.ProviderID,
+			Status:                prevTx.Status,
 		}, nil
 	}
-	oldBalance := balanceResp.Balance
 
-	// Process withdrawal through wallet client
-	withdrawReq := walletclient.WithdrawRequest{
-		UserID:   int(player.ID),
-		Currency: string(req.Currency),
-		Transactions: []walletclient.WithdrawRequestTransaction{
-			{
-				Amount:    float64(req.Amount),
-				BetID:     req.ProviderTransactionID,
-				Reference: transaction.ID.String(),
-			},
-		},
+	var resp shared.BetOperationResponse
+	if err := json.Unmarshal(stored.Response, &resp); err != nil {
+		return nil, fmt.Errorf("failed to read the original response: %w", err)
 	}
+	slog.Info("Replaying the response of a retried transaction", "transaction_id", prevTx.ID, "provider_transaction_id", prevTx.ProviderID)
+	return &resp, nil
+}
 
-	withdrawResp, err := s.WalletClient.Withdraw(withdrawReq)
-	if err != nil {
-		slog.Error("Failed to process withdrawal, keeping transaction pending", "error", err, "player_id", player.ID, "transaction_id", transaction.ID)
-		return &shared.BetOperationResponse{
-			TransactionID:         transaction.ID,
-			ProviderTransactionID: req.ProviderTransactionID,
-			OldBalance:            oldBalance,
-			NewBalance:            oldBalance,         // No change since withdrawal failed
-			Status:                transaction.Status, // PENDING
-		}, nil
+// saveResponse stores the response answered for a transaction, so a retry
+// of the request gets it again
+func (s *Service) saveResponse(ctx context.Context, resp *shared.BetOperationResponse) {
+	payload, err := json.Marshal(resp)
+	if err == nil {
+		err = s.CreateTransactionResponse(ctx, &models.TransactionResponse{
+			TransactionID: resp.TransactionID,
+			Response:      payload,
+		})
 	}
-
-	// Update transaction status
-	transaction.Status = models.TransactionStatusConfirmed
-	err = s.Repository.UpdateTransaction(ctx, transaction)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update transaction: %w", err)
+		slog.Warn("Failed to store transaction response", "error", err, "transaction_id", resp.TransactionID)
 	}
-
-	return &shared.BetOperationResponse{
-		TransactionID:         transaction.ID,
-		ProviderTransactionID: req.ProviderTransactionID,
-		OldBalance:            oldBalance,
-		NewBalance:            withdrawResp.Balance,
-		Status:                transaction.Status,
-	}, nil
 }
 
-func (s *Service) ProcessSettle(ctx context.Context, player *models.Player, req shared.DepositRequest) (*shared.BetOperationResponse, error) {
+func (s *Service) ProcessBet(ctx context.Context, player *models.Player, req shared.WithdrawRequest) (*shared.BetOperationResponse, error) {
 	prevTx, err := s.GetTransactionByProviderID(ctx, req.ProviderTransactionID)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to check for any previous transactions: %w", err)
 	}
 
-	// reject duplicate transaction
-	if prevTx != nil {
-		return nil, fmt.Errorf("Duplicate transaction")
-	}
-
-	oldTx, err := s.GetTransactionByProviderID(ctx, req.ProviderWithdrawnTransactionID)
-	if err != nil || oldTx == nil {
-		return nil, fmt.Errorf("Failed to get previous bet. make sure to include a valide previous bet_id to settle it.")
+	// Create transaction record
+	transaction := &models.Transaction{
+		PlayerID:   player.ID,
+		ProviderID: req.ProviderTransactionID,
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+		Status:     models.TransactionStatusPending,
+		Type:       models.TransactionTypeWithdraw,
+		Attempts:   0,
 	}
 
-	if oldTx.Status == models.TransactionStatusFinalized {
-		return nil, fmt.Errorf("This bet is already settled.")
+	// A retried request is answered like the first time
+	if prevTx != nil {
+		return s.replayTransaction(ctx, prevTx, transaction)
 	}
 
-	if oldTx.Status == models.TransactionStatusFailed {
-		return nil, fmt.Errorf("The bet failed. you can not settle failed bets")
-	}
+	return s.submitTransaction(ctx, transaction, nil, nil, req.ProviderTransactionID, req.RoundRequest)
+}
 
-	// Check if player has any pending transactions
-	hasPending, err := s.hasPendingTransactions(ctx, player.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check pending transactions: %w", err)
+func (s *Service) ProcessSettle(ctx context.Context, player *models.Player, req shared.DepositRequest) (*shared.BetOperationResponse, error) {
+	prevTx, err := s.GetTransactionByProviderID(ctx, req.ProviderTransactionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to check for any previous transactions: %w", err)
 	}
 
 	// Create transaction record
 	transaction := &models.Transaction{
-		PlayerID:   player.ID,
-		ProviderID: req.ProviderTransactionID,
-		Amount:     strconv.FormatFloat(req.Amount, 'f', -1, 64),
-		Currency:   req.Currency,
-		Status:     models.TransactionStatusPending,
-		Type:       models.TransactionTypeDeposit,
-		Attempts:   0,
+		PlayerID:           player.ID,
+		ProviderID:         req.ProviderTransactionID,
+		WithdrawProviderID: req.ProviderWithdrawnTransactionID,
+		Amount:             req.Amount,
+		Currency:           req.Currency,
+		Status:             models.TransactionStatusPending,
+		Type:               models.TransactionTypeDeposit,
+		Attempts:           0,
 	}
 
-	err = s.Repository.CreateTransaction(ctx, transaction)
+	bets, err := settlementBets(transaction, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction: %w", err)
+		return nil, err
 	}
 
-	// If player has pending transactions, keep this one pending too
-	if hasPending {
-		slog.Info("Player has pending transactions, keeping settle transaction pending", "player_id", player.ID, "transaction_id", transaction.ID)
-		return &shared.BetOperationResponse{
-			TransactionID:         transaction.ID,
-			ProviderTransactionID: req.ProviderTransactionID,
-			Status:                transaction.Status, // PENDING
-		}, nil
+	// A retried request is answered like the first time, even once the bet is settled
+	if prevTx != nil {
+		return s.replayTransaction(ctx, prevTx, transaction)
 	}
 
-	// Try to process with wallet service
-	balanceResp, err := s.WalletClient.GetBalance(player.ID)
-	if err != nil {
-		slog.Error("Failed to get balance, keeping transaction pending", "error", err, "player_id", player.ID, "transaction_id", transaction.ID)
-		return &shared.BetOperationResponse{
-			TransactionID:         transaction.ID,
-			ProviderTransactionID: req.ProviderTransactionID,
-			Status:                transaction.Status, // PENDING
-		}, nil
-	}
-	oldBalance := balanceResp.Balance
-
-	// Process deposit through wallet client (only if amount > 0)
-	var newBalance string
-	if req.Amount > 0 {
-		depositReq := walletclient.DepositRequest{
-			UserID:   int(player.ID),
-			Currency: string(req.Currency),
-			Transactions: []walletclient.DepositRequestTransaction{
-				{
-					Amount:    float64(req.Amount),
-					BetID:     req.ProviderWithdrawnTransactionID,
-					Reference: transaction.ID.String(),
-				},
-			},
+	// The bets are finalized together with the settlement, they must all be
+	// confirmed bets of the player
+	betIDs := []uint64{req.ProviderWithdrawnTransactionID}
+	if len(bets) > 0 {
+		betIDs = nil
+		for _, bet := range bets {
+			betIDs = append(betIDs, bet.BetProviderID)
 		}
-
-		depositResp, err := s.WalletClient.Deposit(depositReq)
+	}
+	var settled []*models.Transaction
+	for _, betID := range betIDs {
+		betTx, err := s.settleableBet(ctx, transaction, betID)
 		if err != nil {
-			slog.Error("Failed to process deposit, keeping transaction pending", "error", err, "player_id", player.ID, "transaction_id", transaction.ID)
-			return &shared.BetOperationResponse{
-				TransactionID:         transaction.ID,
-				ProviderTransactionID: req.ProviderTransactionID,
-				OldBalance:            oldBalance,
-				NewBalance:            oldBalance,         // No change since deposit failed
-				Status:                transaction.Status, // PENDING
-			}, nil
+			return nil, err
 		}
+		settled = append(settled, betTx)
+	}
 
-		oldTx.Status = models.TransactionStatusFinalized
-		err = s.UpdateTransaction(ctx, oldTx)
-		if err != nil {
-			slog.Error("failed to update withdraw transaction", "error", err)
+	// A settlement is reported in the round of its bets
+	roundID := settled[0].RoundID
+	for _, betTx := range settled[1:] {
+		if betTx.RoundID != roundID {
+			return nil, fmt.Errorf("Bets %d and %d were placed in different rounds.", settled[0].ProviderID, betTx.ProviderID)
+		}
+	}
+	if roundID != uuid.Nil {
+		betRound, err := s.GetRoundByID(ctx, roundID)
+		if err != nil || betRound == nil {
+			return nil, fmt.Errorf("failed to get the round of the bet: %w", err)
+		}
+		if req.RoundID == "" {
+			req.RoundID = betRound.ProviderRoundID
+		} else if req.RoundID != betRound.ProviderRoundID {
+			return nil, fmt.Errorf("The bet was placed in round %s.", betRound.ProviderRoundID)
 		}
+	}
 
-		newBalance = depositResp.Balance
-	} else {
-		// If amount is 0, bet is lost - no deposit needed
-		newBalance = oldBalance
+	// The bets are finalized by the dispatcher along with the settlement
+	return s.submitTransaction(ctx, transaction, settled[0], bets, req.ProviderTransactionID, req.RoundRequest)
+}
 
-		oldTx.Status = models.TransactionStatusFinalized
-		err = s.UpdateTransaction(ctx, oldTx)
-		if err != nil {
-			slog.Error("failed to update withdraw transaction", "error", err)
+// settleableBet returns the bet with provider id betID settled by tx. It
+// must be a confirmed bet of the player of tx, placed in its currency.
+func (s *Service) settleableBet(ctx context.Context, tx *models.Transaction, betID uint64) (*models.Transaction, error) {
+	betTx, err := s.GetTransactionByProviderID(ctx, betID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get bet %d: %w", betID, err)
+	}
+
+	switch {
+	case betTx == nil:
+		return nil, fmt.Errorf("Bet %d not found. make sure to include a valid previous bet_id to settle it.", betID)
+	case betTx.PlayerID != tx.PlayerID:
+		return nil, fmt.Errorf("Bet %d does not belong to this player.", betID)
+	case betTx.Type != models.TransactionTypeWithdraw:
+		return nil, fmt.Errorf("Transaction %d is not a bet.", betID)
+	case betTx.Status == models.TransactionStatusFinalized:
+		return nil, fmt.Errorf("Bet %d is already settled.", betID)
+	case betTx.Status == models.TransactionStatusFailed:
+		return nil, fmt.Errorf("Bet %d failed. you can not settle failed bets.", betID)
+	case betTx.Status != models.TransactionStatusConfirmed:
+		return nil, fmt.Errorf("Bet %d is %s. you can only settle confirmed bets.", betID, betTx.Status)
+	case betTx.Currency != tx.Currency:
+		return nil, fmt.Errorf("Bet %d was placed in %s.", betID, betTx.Currency)
+	}
+	return betTx, nil
+}
+
+// settlementBets returns the bets of a settlement of several bets, none when
+// req settles a single bet. tx is then for the sum of their wins, and its
+// WithdrawProviderID is the first of them.
+func settlementBets(tx *models.Transaction, req shared.DepositRequest) ([]*models.SettlementBet, error) {
+	if len(req.Bets) == 0 {
+		return nil, nil
+	}
+	if req.ProviderWithdrawnTransactionID != 0 {
+		return nil, errors.New("Settle either provider_withdrawn_transaction_id or bets, not both.")
+	}
+
+	var (
+		bets  []*models.SettlementBet
+		total models.Amount
+		seen  = make(map[uint64]bool, len(req.Bets))
+	)
+	for _, bet := range req.Bets {
+		if seen[bet.ProviderWithdrawnTransactionID] {
+			return nil, fmt.Errorf("Bet %d is settled twice.", bet.ProviderWithdrawnTransactionID)
 		}
-	}
+		seen[bet.ProviderWithdrawnTransactionID] = true
 
-	// Update transaction status
-	transaction.Status = models.TransactionStatusConfirmed
-	err = s.Repository.UpdateTransaction(ctx, transaction)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update transaction: %w", err)
+		if !bet.Amount.FitsCurrency(tx.Currency) {
+			return nil, fmt.Errorf("The win of bet %d has too many decimals for %s.", bet.ProviderWithdrawnTransactionID, tx.Currency)
+		}
+		total += bet.Amount
+		bets = append(bets, &models.SettlementBet{
+			BetProviderID: bet.ProviderWithdrawnTransactionID,
+			Amount:        bet.Amount,
+		})
+	}
+	if req.Amount != 0 && req.Amount != total {
+		return nil, fmt.Errorf("The amount should be the sum of the wins, %s.", total)
 	}
 
-	return &shared.BetOperationResponse{
-		TransactionID:         transaction.ID,
-		ProviderTransactionID: req.ProviderTransactionID,
-		OldBalance:            oldBalance,
-		NewBalance:            newBalance,
-		Status:                transaction.Status,
-	}, nil
+	tx.Amount = total
+	tx.WithdrawProviderID = bets[0].BetProviderID
+	return bets, nil
 }
 
+// ProcessCancel reverses a transaction, or part of it. A rollback with its
+// own provider id can be retried, its first response is replayed.
 func (s *Service) ProcessCancel(ctx context.Context, player *models.Player, req shared.CancelRequest) (*shared.BetOperationResponse, error) {
+	if req.ProviderRollbackID != 0 {
+		prevTx, err := s.GetTransactionByProviderID(ctx, req.ProviderRollbackID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to check for any previous transactions: %w", err)
+		}
+		if prevTx != nil {
+			request := &models.Transaction{
+				PlayerID:           player.ID,
+				ProviderID:         req.ProviderRollbackID,
+				WithdrawProviderID: req.ProviderTransactionID,
+				Amount:             req.Amount,
+				Currency:           prevTx.Currency,
+				Type:               models.TransactionTypeCancel,
+			}
+			// A rollback of what was left was for the amount left then
+			if req.Amount == 0 {
+				request.Amount = prevTx.Amount
+			}
+			return s.replayTransaction(ctx, prevTx, request)
+		}
+	}
+
 	// Find the original transaction to cancel
 	originalTx, err := s.GetTransactionByProviderID(ctx, req.ProviderTransactionID)
 	if err != nil || originalTx == nil {
@@ -272,133 +347,41 @@ func (s *Service) ProcessCancel(ctx context.Context, player *models.Player, req
 		return nil, errors.New("transaction already finalized")
 	}
 
-	// Create cancel transaction record
-	cancelTx := &models.Transaction{
-		PlayerID:           player.ID,
-		WithdrawProviderID: req.ProviderTransactionID,
-		Amount:             originalTx.Amount,
-		Currency:           originalTx.Currency,
-		Status:             models.TransactionStatusPending,
-		Type:               models.TransactionTypeCancel,
-		Attempts:           0,
+	if originalTx.Status == models.TransactionStatusFailed {
+		return nil, errors.New("the transaction failed. you can not cancel failed transactions")
 	}
 
-	err = s.Repository.CreateTransaction(ctx, cancelTx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cancel transaction: %w", err)
-	}
-
-	// Check if player has any pending transactions
-	hasPending, err := s.hasPendingTransactions(ctx, player.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check pending transactions: %w", err)
+	if originalTx.Type == models.TransactionTypeCancel {
+		return nil, errors.New("cannot cancel a cancel transaction")
 	}
 
-	// If player has pending transactions, keep this one pending too
-	if hasPending {
-		slog.Info("Player has pending transactions, keeping cancel transaction pending", "player_id", player.ID, "transaction_id", cancelTx.ID)
-		return &shared.BetOperationResponse{
-			TransactionID:         cancelTx.ID,
-			ProviderTransactionID: req.ProviderTransactionID,
-			Status:                cancelTx.Status, // PENDING
-		}, nil
+	// Without an amount, what is left of the transaction is cancelled
+	amount := req.Amount
+	if amount == 0 {
+		amount = originalTx.Refundable()
 	}
-
-	// Try to process with wallet service
-	balanceResp, err := s.WalletClient.GetBalance(player.ID)
-	if err != nil {
-		slog.Error("Failed to get balance, keeping transaction pending", "error", err, "player_id", player.ID, "transaction_id", cancelTx.ID)
-		return &shared.BetOperationResponse{
-			TransactionID:         cancelTx.ID,
-			ProviderTransactionID: req.ProviderTransactionID,
-			Status:                cancelTx.Status, // PENDING
-		}, nil
+	if !amount.FitsCurrency(originalTx.Currency) {
+		return nil, fmt.Errorf("the amount has too many decimals for %s", originalTx.Currency)
 	}
-	oldBalance := balanceResp.Balance
-
-	ogAmount, err := strconv.ParseFloat(originalTx.Amount, 64)
-	if err != nil {
-		return nil, err
-	}
-
-	var newBalance string
-
-	originalTx.Status = models.TransactionStatusFinalized
-	err = s.Repository.UpdateTransaction(ctx, originalTx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update original transaction: %w", err)
-	}
-
-	// Reverse the original transaction
-	if originalTx.Type == models.TransactionTypeWithdraw {
-		// Original was a withdrawal (bet), so we need to deposit back
-		depositReq := walletclient.DepositRequest{
-			UserID:   int(player.ID),
-			Currency: string(originalTx.Currency),
-			Transactions: []walletclient.DepositRequestTransaction{
-				{
-					Amount:    ogAmount,
-					BetID:     originalTx.ProviderID,
-					Reference: fmt.Sprintf("cancel-%d", req.ProviderTransactionID),
-				},
-			},
-		}
-
-		depositResp, err := s.WalletClient.Deposit(depositReq)
-		if err != nil {
-			slog.Error("Failed to process cancel deposit, keeping transaction pending", "error", err, "player_id", player.ID, "transaction_id", cancelTx.ID)
-			return &shared.BetOperationResponse{
-				TransactionID:         cancelTx.ID,
-				ProviderTransactionID: req.ProviderTransactionID,
-				OldBalance:            oldBalance,
-				NewBalance:            oldBalance,      // No change since deposit failed
-				Status:                cancelTx.Status, // PENDING
-			}, nil
-		}
-		newBalance = depositResp.Balance
-
-	} else if originalTx.Type == models.TransactionTypeDeposit {
-		// Original was a deposit (settle), so we need to withdraw back
-		withdrawReq := walletclient.WithdrawRequest{
-			UserID:   int(player.ID),
-			Currency: string(originalTx.Currency),
-			Transactions: []walletclient.WithdrawRequestTransaction{
-				{
-					Amount:    ogAmount,
-					BetID:     originalTx.ProviderID,
-					Reference: fmt.Sprintf("cancel-%d", req.ProviderTransactionID),
-				},
-			},
-		}
-
-		withdrawResp, err := s.WalletClient.Withdraw(withdrawReq)
-		if err != nil {
-			slog.Error("Failed to process cancel withdrawal, keeping transaction pending", "error", err, "player_id", player.ID, "transaction_id", cancelTx.ID)
-			return &shared.BetOperationResponse{
-				TransactionID:         cancelTx.ID,
-				ProviderTransactionID: req.ProviderTransactionID,
-				OldBalance:            oldBalance,
-				NewBalance:            oldBalance,      // No change since withdrawal failed
-				Status:                cancelTx.Status, // PENDING
-			}, nil
-		}
-		newBalance = withdrawResp.Balance
-	} else {
-		return nil, errors.New("cannot cancel a cancel transaction")
+	if amount < 0 || amount > originalTx.Refundable() || (amount == 0 && originalTx.Amount != 0) {
+		return nil, fmt.Errorf("%w: %s is left to cancel of transaction %d", ErrRefundExceeded, originalTx.Refundable(), originalTx.ProviderID)
 	}
 
-	// Update transaction statuses
-	cancelTx.Status = models.TransactionStatusConfirmed
-	err = s.Repository.UpdateTransaction(ctx, cancelTx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update cancel transaction: %w", err)
+	// Create cancel transaction record
+	cancelTx := &models.Transaction{
+		PlayerID:           player.ID,
+		ProviderID:         req.ProviderRollbackID,
+		WithdrawProviderID: req.ProviderTransactionID,
+		Amount:             amount,
+		Currency:           originalTx.Currency,
+		Status:             models.TransactionStatusPending,
+		Type:               models.TransactionTypeCancel,
+		Attempts:           0,
+		// Cancels are accepted in closed rounds
+		RoundID: originalTx.RoundID,
 	}
 
-	return &shared.BetOperationResponse{
-		TransactionID:         cancelTx.ID,
-		ProviderTransactionID: req.ProviderTransactionID,
-		OldBalance:            oldBalance,
-		NewBalance:            newBalance,
-		Status:                cancelTx.Status,
-	}, nil
+	// The original transaction is finalized by the dispatcher along with the
+	// cancel that leaves nothing of it
+	return s.submitTransaction(ctx, cancelTx, originalTx, nil, req.ProviderTransactionID, shared.RoundRequest{})
 }
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+var testPlayer = &models.Player{ID: 7}
+
+// newTestService returns a service on top of the memory repository and a
+// fake wallet opening accounts with 1000.00 USD
+func newTestService(t *testing.T) (*Service, *memoryRepository, *walletclient.FakeWallet) {
+	t.Helper()
+	setTestConfig(t)
+
+	repo := newMemoryRepository()
+	wallet := walletclient.NewFakeWallet(string(models.CurrencyUSD), models.NewAmount(1000))
+	return NewService(repo, wallet), repo, wallet
+}
+
+// setTestConfig runs the worker without pausing between batches and makes
+// retries due right away until the test ends
+func setTestConfig(t *testing.T) {
+	t.Helper()
+
+	config := internal.Config
+	t.Cleanup(func() { internal.Config = config })
+	internal.Config.WALLET_DISPATCH_WAIT = 0
+	internal.Config.WORKER_TRANSACTION_DELAY = 0
+	internal.Config.WORKER_BATCH_SIZE = 20
+	internal.Config.WORKER_ID = "test"
+	internal.Config.WORKER_LEASE_DURATION = time.Minute
+	internal.Config.RETRY_POLICIES = map[string]internal.RetryPolicy{
+		string(models.TransactionTypeWithdraw): {MaxAttempts: 3},
+		string(models.TransactionTypeDeposit):  {MaxAttempts: 3},
+		string(models.TransactionTypeCancel):   {MaxAttempts: 3},
+	}
+}
+
+// dispatch runs the worker until no pending transaction is left to attempt
+func dispatch(t *testing.T, s *Service) {
+	t.Helper()
+	s.processPendingTransactions(context.Background(), 0, 1)
+}
+
+// storedTransaction returns the stored transaction with a provider id
+func storedTransaction(t *testing.T, repo *memoryRepository, providerID uint64) *models.Transaction {
+	t.Helper()
+	tx, err := repo.GetTransactionByProviderID(context.Background(), providerID)
+	if err != nil {
+		t.Fatalf("transaction %d: %v", providerID, err)
+	}
+	return tx
+}
+
+func assertStatus(t *testing.T, tx *models.Transaction, status models.TransactionStatus) {
+	t.Helper()
+	if tx.Status != status {
+		t.Errorf("transaction %d is %s, want %s", tx.ProviderID, tx.Status, status)
+	}
+}
+
+// assertBalance checks the wallet balance of the test player
+func assertBalance(t *testing.T, wallet *walletclient.FakeWallet, want models.Amount) {
+	t.Helper()
+	if got := wallet.Balance(testPlayer.ID, string(models.CurrencyUSD)); got != want {
+		t.Errorf("wallet balance is %s, want %s", got, want)
+	}
+}
+
+func placeBet(t *testing.T, s *Service, providerID uint64, amount models.Amount) *shared.BetOperationResponse {
+	t.Helper()
+	resp, err := s.ProcessBet(context.Background(), testPlayer, shared.WithdrawRequest{
+		Currency:              models.CurrencyUSD,
+		Amount:                amount,
+		ProviderTransactionID: providerID,
+	})
+	if err != nil {
+		t.Fatalf("bet %d: %v", providerID, err)
+	}
+	return resp
+}
+
+func TestBetThenSettle(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	resp := placeBet(t, s, 1, models.NewAmount(100))
+	if resp.Status != models.TransactionStatusPending || resp.OldBalance != "1000.00" {
+		t.Errorf("bet answered %s with balance %s, want PENDING with 1000.00", resp.Status, resp.OldBalance)
+	}
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(900))
+
+	_, err := s.ProcessSettle(context.Background(), testPlayer, shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		Amount:                         models.NewAmount(250),
+		ProviderTransactionID:          2,
+		ProviderWithdrawnTransactionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+
+	assertStatus(t, storedTransaction(t, repo, 2), models.TransactionStatusConfirmed)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFinalized)
+	assertBalance(t, wallet, models.NewAmount(1150))
+}
+
+func TestBetThenLose(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+	_, err := s.ProcessSettle(context.Background(), testPlayer, shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		ProviderTransactionID:          2,
+		ProviderWithdrawnTransactionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFinalized)
+	assertBalance(t, wallet, models.NewAmount(900))
+}
+
+func TestDuplicateBet(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	first := placeBet(t, s, 1, models.NewAmount(100))
+	retried := placeBet(t, s, 1, models.NewAmount(100))
+	if *retried != *first {
+		t.Errorf("retried bet answered %+v, want the first response %+v", retried, first)
+	}
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(900))
+
+	// The response is replayed as it was first answered
+	retried = placeBet(t, s, 1, models.NewAmount(100))
+	if retried.Status != models.TransactionStatusPending {
+		t.Errorf("bet retried once confirmed answered %s, want the first PENDING", retried.Status)
+	}
+
+	_, err := s.ProcessBet(context.Background(), testPlayer, shared.WithdrawRequest{
+		Currency:              models.CurrencyUSD,
+		Amount:                models.NewAmount(200),
+		ProviderTransactionID: 1,
+	})
+	if !errors.Is(err, ErrTransactionMismatch) {
+		t.Errorf("bet reusing a provider id with another amount: got %v, want %v", err, ErrTransactionMismatch)
+	}
+}
+
+func TestRetriedSettlement(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+	settle := shared.DepositRequest{
+		Currency:                       models.CurrencyUSD,
+		Amount:                         models.NewAmount(250),
+		ProviderTransactionID:          2,
+		ProviderWithdrawnTransactionID: 1,
+	}
+	first, err := s.ProcessSettle(ctx, testPlayer, settle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+
+	// Retried once the bet is settled, the settlement is not paid twice
+	retried, err := s.ProcessSettle(ctx, testPlayer, settle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *retried != *first {
+		t.Errorf("retried settlement answered %+v, want the first response %+v", retried, first)
+	}
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 2), models.TransactionStatusConfirmed)
+	assertBalance(t, wallet, models.NewAmount(1150))
+
+	settle.ProviderWithdrawnTransactionID = 3
+	if _, err := s.ProcessSettle(ctx, testPlayer, settle); !errors.Is(err, ErrTransactionMismatch) {
+		t.Errorf("settlement reusing a provider id for another bet: got %v, want %v", err, ErrTransactionMismatch)
+	}
+	other := &models.Player{ID: testPlayer.ID + 1}
+	settle.ProviderWithdrawnTransactionID = 1
+	if _, err := s.ProcessSettle(ctx, other, settle); !errors.Is(err, ErrTransactionMismatch) {
+		t.Errorf("settlement reusing a provider id of another player: got %v, want %v", err, ErrTransactionMismatch)
+	}
+}
+
+func TestBetWithInsufficientFunds(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	resp := placeBet(t, s, 1, models.NewAmount(5000))
+	if resp.Status != models.TransactionStatusPending {
+		t.Errorf("bet answered %s, want PENDING", resp.Status)
+	}
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusPending)
+	assertBalance(t, wallet, models.NewAmount(1000))
+
+	// Bets placed while another one is pending wait for it
+	resp = placeBet(t, s, 2, models.NewAmount(10))
+	if resp.Status != models.TransactionStatusPending {
+		t.Errorf("bet placed behind a pending one answered %s, want PENDING", resp.Status)
+	}
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestSettleValidatesBets(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	placeBet(t, s, 2, models.NewAmount(100))
+	dispatch(t, s)
+	placeBet(t, s, 3, models.NewAmount(100)) // Left pending
+	other := &models.Player{ID: testPlayer.ID + 1}
+	if _, err := s.ProcessBet(ctx, other, shared.WithdrawRequest{Currency: models.CurrencyUSD, Amount: models.NewAmount(100), ProviderTransactionID: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  shared.DepositRequest
+		want string
+	}{
+		{
+			name: "unknown bet",
+			req:  shared.DepositRequest{ProviderWithdrawnTransactionID: 9},
+			want: "Bet 9 not found. make sure to include a valid previous bet_id to settle it.",
+		},
+		{
+			name: "unknown bet of several",
+			req: shared.DepositRequest{Bets: []shared.SettleBetRequest{
+				{ProviderWithdrawnTransactionID: 1, Amount: models.NewAmount(10)},
+				{ProviderWithdrawnTransactionID: 9, Amount: models.NewAmount(10)},
+			}},
+			want: "Bet 9 not found. make sure to include a valid previous bet_id to settle it.",
+		},
+		{
+			name: "bet of another player",
+			req:  shared.DepositRequest{ProviderWithdrawnTransactionID: 4},
+			want: "Bet 4 does not belong to this player.",
+		},
+		{
+			name: "pending bet",
+			req:  shared.DepositRequest{ProviderWithdrawnTransactionID: 3},
+			want: "Bet 3 is PENDING. you can only settle confirmed bets.",
+		},
+		{
+			name: "pending bet of several",
+			req: shared.DepositRequest{Bets: []shared.SettleBetRequest{
+				{ProviderWithdrawnTransactionID: 2, Amount: models.NewAmount(10)},
+				{ProviderWithdrawnTransactionID: 3, Amount: models.NewAmount(10)},
+			}},
+			want: "Bet 3 is PENDING. you can only settle confirmed bets.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Currency = models.CurrencyUSD
+			req.ProviderTransactionID = 10
+			_, err := s.ProcessSettle(ctx, testPlayer, req)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	_, err := s.ProcessSettle(ctx, testPlayer, shared.DepositRequest{
+		Currency:              models.CurrencyUSD,
+		ProviderTransactionID: 10,
+		Bets: []shared.SettleBetRequest{
+			{ProviderWithdrawnTransactionID: 1, Amount: models.NewAmount(30)},
+			{ProviderWithdrawnTransactionID: 2, Amount: models.NewAmount(20)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(t, s)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFinalized)
+	assertStatus(t, storedTransaction(t, repo, 2), models.TransactionStatusFinalized)
+	// The pending bet 3 was confirmed by the same dispatch
+	assertBalance(t, wallet, models.NewAmount(750))
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+)
+
+func TestUpdateTransactionRejectsStaleCopies(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+	first := storedTransaction(t, repo, 1)
+	second := storedTransaction(t, repo, 1)
+
+	first.Status = models.TransactionStatusFinalized
+	if err := repo.UpdateTransaction(ctx, first, "test"); err != nil {
+		t.Fatal(err)
+	}
+	second.Status = models.TransactionStatusFinalized
+	err := repo.UpdateTransaction(ctx, second, "test")
+	var conflict *models.VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Version != second.Version || conflict.Current != first.Version {
+		t.Fatalf("saving a stale copy returned %v, want a conflict from version %d to %d", err, second.Version, first.Version)
+	}
+}
+
+func TestSaveTransactionReevaluatesTheStoredCopy(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	ctx := context.Background()
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+	stale := storedTransaction(t, repo, 1)
+
+	// Finalized meanwhile, the stale copy must not finalize it a second time
+	saved, err := saveTransaction(ctx, s.Repository, storedTransaction(t, repo, 1), "test", finalizeTransaction)
+	if err != nil || !saved {
+		t.Fatalf("finalizing the bet returned %t, %v", saved, err)
+	}
+	saved, err = saveTransaction(ctx, s.Repository, stale, "test", finalizeTransaction)
+	if err != nil || saved {
+		t.Fatalf("finalizing a stale copy returned %t, %v, want it left as stored", saved, err)
+	}
+	if stale.Status != models.TransactionStatusFinalized || stale.Version != storedTransaction(t, repo, 1).Version {
+		t.Errorf("stale copy is %s at version %d, want it reloaded", stale.Status, stale.Version)
+	}
+}
+
+func TestSaveTransactionRetriesAfterAConflict(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	ctx := context.Background()
+
+	wallet.FailNext(walletclient.FakeMethodWithdraw, "WALLET_DOWN")
+	placeBet(t, s, 1, models.NewAmount(100))
+	stale := storedTransaction(t, repo, 1)
+
+	// Claimed by a worker since it was read, it can still be confirmed
+	if _, err := repo.ClaimTransactions(ctx, "other/0", 0, 1, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := saveTransaction(ctx, s.Repository, stale, "test", confirmTransaction)
+	if err != nil || !saved {
+		t.Fatalf("confirming a claimed bet returned %t, %v", saved, err)
+	}
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+}
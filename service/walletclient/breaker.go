@@ -0,0 +1,183 @@
+package walletclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "CLOSED"
+	BreakerOpen     BreakerState = "OPEN"
+	BreakerHalfOpen BreakerState = "HALF_OPEN"
+)
+
+// ErrCircuitOpen is returned without calling the wallet while the breaker is
+// open, or half-open with all its probes in flight.
+var ErrCircuitOpen = errors.New("WALLET_CIRCUIT_OPEN")
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens
+	// the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting probes
+	// through.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of calls let through while half-open. The
+	// breaker closes once they all succeed and opens again on any failure.
+	HalfOpenProbes int
+}
+
+// CircuitBreaker is a Wallet that stops calling the wrapped wallet after
+// repeated failures, so callers fail fast while it is down.
+//
+// Only availability problems count as failures: transport errors, timeouts
+// and 5xx answers. Business errors such as INSUFFICIENT_FUNDS mean the
+// wallet is up and reset the failure count.
+type CircuitBreaker struct {
+	wallet Wallet
+	cfg    BreakerConfig
+	// now is the breaker clock, replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+func NewCircuitBreaker(wallet Wallet, cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &CircuitBreaker{
+		wallet: wallet,
+		cfg:    cfg,
+		now:    time.Now,
+		state:  BreakerClosed,
+	}
+}
+
+// State returns the current state. An open breaker whose OpenTimeout has
+// elapsed is reported as half-open.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *CircuitBreaker) Deposit(ctx context.Context, req DepositRequest) (*OperationResponse, error) {
+	if err := b.before(); err != nil {
+		return nil, err
+	}
+	resp, err := b.wallet.Deposit(ctx, req)
+	b.after(err)
+	return resp, err
+}
+
+func (b *CircuitBreaker) Withdraw(ctx context.Context, req WithdrawRequest) (*OperationResponse, error) {
+	if err := b.before(); err != nil {
+		return nil, err
+	}
+	resp, err := b.wallet.Withdraw(ctx, req)
+	b.after(err)
+	return resp, err
+}
+
+func (b *CircuitBreaker) GetBalance(ctx context.Context, userID uint64) (*BalanceResponse, error) {
+	if err := b.before(); err != nil {
+		return nil, err
+	}
+	resp, err := b.wallet.GetBalance(ctx, userID)
+	b.after(err)
+	return resp, err
+}
+
+func (b *CircuitBreaker) before() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probes = 0
+		b.successes = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) after(err error) {
+	// The caller gave up, this says nothing about the wallet
+	if errors.Is(err, context.Canceled) {
+		b.mu.Lock()
+		if b.state == BreakerHalfOpen {
+			b.probes--
+		}
+		b.mu.Unlock()
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isAvailabilityError(err) {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.successes++
+			if b.successes >= b.cfg.HalfOpenProbes {
+				b.setState(BreakerClosed)
+			}
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	slog.Warn("Wallet circuit breaker state changed", "from", b.state, "to", state, "failures", b.failures)
+	b.state = state
+}
+
+// isAvailabilityError reports whether err means the wallet could not serve
+// the request, as opposed to refusing it.
+func isAvailabilityError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var walletErr *ErrorResponse
+	if errors.As(err, &walletErr) {
+		return walletErr.Status >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package walletclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errWalletDown = errors.New("connection refused")
+
+// stubWallet answers GetBalance with err and counts the calls reaching it
+type stubWallet struct {
+	err   error
+	calls int
+}
+
+func (w *stubWallet) Deposit(context.Context, DepositRequest) (*OperationResponse, error) {
+	w.calls++
+	return &OperationResponse{}, w.err
+}
+
+func (w *stubWallet) Withdraw(context.Context, WithdrawRequest) (*OperationResponse, error) {
+	w.calls++
+	return &OperationResponse{}, w.err
+}
+
+func (w *stubWallet) GetBalance(context.Context, uint64) (*BalanceResponse, error) {
+	w.calls++
+	return &BalanceResponse{}, w.err
+}
+
+// fakeClock is a breaker clock only moved by advance
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestBreaker(cfg BreakerConfig) (*CircuitBreaker, *stubWallet, *fakeClock) {
+	wallet := &stubWallet{}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := NewCircuitBreaker(wallet, cfg)
+	b.now = clock.Now
+	return b, wallet, clock
+}
+
+func assertState(t *testing.T, b *CircuitBreaker, want BreakerState) {
+	t.Helper()
+	if got := b.State(); got != want {
+		t.Fatalf("breaker is %s, want %s", got, want)
+	}
+}
+
+func TestCircuitBreakerLifecycle(t *testing.T) {
+	b, wallet, clock := newTestBreaker(BreakerConfig{
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+		HalfOpenProbes:   2,
+	})
+	ctx := context.Background()
+
+	// It opens after FailureThreshold consecutive failures
+	wallet.err = errWalletDown
+	for range 2 {
+		if _, err := b.GetBalance(ctx, 1); !errors.Is(err, errWalletDown) {
+			t.Fatalf("closed breaker returned %v, want the wallet error", err)
+		}
+		assertState(t, b, BreakerClosed)
+	}
+	b.GetBalance(ctx, 1)
+	assertState(t, b, BreakerOpen)
+
+	// It fails fast without calling the wallet while open
+	calls := wallet.calls
+	clock.advance(time.Minute - time.Second)
+	if _, err := b.Withdraw(ctx, WithdrawRequest{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker returned %v, want %v", err, ErrCircuitOpen)
+	}
+	if wallet.calls != calls {
+		t.Fatalf("open breaker called the wallet")
+	}
+
+	// It half-opens once OpenTimeout elapsed and a failed probe opens it again
+	clock.advance(time.Second)
+	assertState(t, b, BreakerHalfOpen)
+	b.GetBalance(ctx, 1)
+	assertState(t, b, BreakerOpen)
+	if wallet.calls != calls+1 {
+		t.Fatalf("half-open breaker made %d calls, want 1 probe", wallet.calls-calls)
+	}
+
+	// It closes once all its probes succeed
+	clock.advance(time.Minute)
+	wallet.err = nil
+	b.GetBalance(ctx, 1)
+	assertState(t, b, BreakerHalfOpen)
+	b.Deposit(ctx, DepositRequest{})
+	assertState(t, b, BreakerClosed)
+
+	// Closed again, it needs FailureThreshold new failures to open
+	wallet.err = errWalletDown
+	b.GetBalance(ctx, 1)
+	b.GetBalance(ctx, 1)
+	assertState(t, b, BreakerClosed)
+}
+
+func TestCircuitBreakerLimitsProbes(t *testing.T) {
+	b, wallet, clock := newTestBreaker(BreakerConfig{
+		FailureThreshold: 1,
+		OpenTimeout:      time.Second,
+		HalfOpenProbes:   1,
+	})
+	ctx := context.Background()
+
+	wallet.err = errWalletDown
+	b.GetBalance(ctx, 1)
+	clock.advance(time.Second)
+
+	// The probe is still in flight, every other call fails fast
+	wallet.err = nil
+	if err := b.before(); err != nil {
+		t.Fatalf("first half-open call returned %v, want a probe", err)
+	}
+	if _, err := b.GetBalance(ctx, 1); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("call past the probes returned %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A probe the caller gave up on frees its slot without opening
+	b.after(context.Canceled)
+	assertState(t, b, BreakerHalfOpen)
+	if _, err := b.GetBalance(ctx, 1); err != nil {
+		t.Fatalf("freed probe returned %v", err)
+	}
+	assertState(t, b, BreakerClosed)
+}
+
+func TestCircuitBreakerFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		opens bool
+	}{
+		{"transport error", errWalletDown, true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"server error", &ErrorResponse{Code: "INTERNAL", Status: http.StatusBadGateway}, true},
+		{"business error", &ErrorResponse{Code: ErrCodeInsufficientFunds, Status: http.StatusBadRequest}, false},
+		{"cancelled", context.Canceled, false},
+		{"success", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, wallet, _ := newTestBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+			wallet.err = tt.err
+			b.GetBalance(context.Background(), 1)
+			b.GetBalance(context.Background(), 1)
+
+			want := BreakerClosed
+			if tt.opens {
+				want = BreakerOpen
+			}
+			assertState(t, b, want)
+		})
+	}
+}
+
+func TestCircuitBreakerBusinessErrorResetsFailures(t *testing.T) {
+	b, wallet, _ := newTestBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	ctx := context.Background()
+
+	wallet.err = errWalletDown
+	b.GetBalance(ctx, 1)
+	wallet.err = &ErrorResponse{Code: ErrCodeUserNotFound, Status: http.StatusNotFound}
+	b.GetBalance(ctx, 1)
+	wallet.err = errWalletDown
+	b.GetBalance(ctx, 1)
+	assertState(t, b, BreakerClosed)
+}
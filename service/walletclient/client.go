@@ -1,23 +1,60 @@
 package walletclient
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
 )
 
+// Wallet is the set of wallet operations the service relies on. It is
+// implemented by WalletClient for the remote wallet API and by FakeWallet
+// for running without it.
+type Wallet interface {
+	Deposit(ctx context.Context, req DepositRequest) (*OperationResponse, error)
+	Withdraw(ctx context.Context, req WithdrawRequest) (*OperationResponse, error)
+	GetBalance(ctx context.Context, userID uint64) (*BalanceResponse, error)
+}
+
+// Timeouts bounds one kind of wallet call. Connect limits establishing the
+// connection and Read limits waiting for the response once it is sent.
+type Timeouts struct {
+	Connect time.Duration
+	Read    time.Duration
+}
+
 type WalletClient struct {
 	baseURL string
 	token   string
-	client  *http.Client
+
+	// balanceClient is used for balance lookups, operationClient for calls
+	// that move money, so each can have its own deadlines.
+	balanceClient   *http.Client
+	operationClient *http.Client
 }
 
-func NewWalletClient(baseURL, token string) *WalletClient {
+func NewWalletClient(baseURL, token string, balance, operation Timeouts) *WalletClient {
 	return &WalletClient{
-		baseURL: baseURL,
-		token:   token,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		baseURL:         baseURL,
+		token:           token,
+		balanceClient:   newHTTPClient(balance),
+		operationClient: newHTTPClient(operation),
+	}
+}
+
+func newHTTPClient(timeouts Timeouts) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   timeouts.Connect,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.ResponseHeaderTimeout = timeouts.Read
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeouts.Connect + timeouts.Read,
 	}
 }
 
@@ -33,9 +70,9 @@ type DepositRequest struct {
 }
 
 type DepositRequestTransaction struct {
-	Amount    float64 `json:"amount" binding:"required"`
-	BetID     uint64  `json:"betId" binding:"required"`
-	Reference string  `json:"reference" binding:"required"`
+	Amount    models.Amount `json:"amount" binding:"required"`
+	BetID     uint64        `json:"betId" binding:"required"`
+	Reference string        `json:"reference" binding:"required"`
 }
 
 type WithdrawRequest struct {
@@ -45,9 +82,9 @@ type WithdrawRequest struct {
 }
 
 type WithdrawRequestTransaction struct {
-	Amount    float64 `json:"amount" binding:"required"`
-	BetID     uint64  `json:"betId" binding:"required"`
-	Reference string  `json:"reference" binding:"required"`
+	Amount    models.Amount `json:"amount" binding:"required"`
+	BetID     uint64        `json:"betId" binding:"required"`
+	Reference string        `json:"reference" binding:"required"`
 }
 
 type OperationResponse struct {
@@ -63,4 +100,12 @@ type OperationResponseTransaction struct {
 type ErrorResponse struct {
 	Code string `json:"code"`
 	Msg  string `json:"msg"`
+
+	// Status is the HTTP status the wallet answered with
+	Status int `json:"-"`
+}
+
+// Error returns the wallet error code so callers can keep matching on it.
+func (e *ErrorResponse) Error() string {
+	return e.Code
 }
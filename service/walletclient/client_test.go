@@ -0,0 +1,66 @@
+package walletclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+// slowServer answers every request after delay, or as soon as the client
+// goes away.
+func slowServer(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"currency":"USD","balance":"10.00"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientUsesPerCallDeadlines(t *testing.T) {
+	srv := slowServer(t, 200*time.Millisecond)
+	short := Timeouts{Connect: time.Second, Read: 20 * time.Millisecond}
+	long := Timeouts{Connect: time.Second, Read: time.Second}
+
+	c := NewWalletClient(srv.URL, "token", short, long)
+	start := time.Now()
+	if _, err := c.GetBalance(context.Background(), 1); err == nil {
+		t.Fatal("balance lookup outlived its read deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("balance lookup gave up after %s", elapsed)
+	}
+
+	c = NewWalletClient(srv.URL, "token", long, short)
+	resp, err := c.GetBalance(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("balance lookup used the operation deadline: %v", err)
+	}
+	if resp.Balance != "10.00" {
+		t.Errorf("balance is %s, want 10.00", resp.Balance)
+	}
+}
+
+func TestClientStopsWhenContextIsDone(t *testing.T) {
+	srv := slowServer(t, time.Second)
+	long := Timeouts{Connect: time.Second, Read: 5 * time.Second}
+	c := NewWalletClient(srv.URL, "token", long, long)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.Withdraw(ctx, withdraw(1, models.NewAmount(5), 1, "bet-1"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -2,40 +2,42 @@ package walletclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 )
 
-func (w *WalletClient) Deposit(req DepositRequest) (*OperationResponse, error) {
+func (w *WalletClient) Deposit(ctx context.Context, req DepositRequest) (*OperationResponse, error) {
 	var resp OperationResponse
-	if err := w.makeJSONRequest("POST", "/api/v1/deposit", req, &resp); err != nil {
+	if err := w.makeJSONRequest(ctx, w.operationClient, "POST", "/api/v1/deposit", req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (w *WalletClient) Withdraw(req WithdrawRequest) (*OperationResponse, error) {
+func (w *WalletClient) Withdraw(ctx context.Context, req WithdrawRequest) (*OperationResponse, error) {
 	var resp OperationResponse
-	if err := w.makeJSONRequest("POST", "/api/v1/withdraw", req, &resp); err != nil {
+	if err := w.makeJSONRequest(ctx, w.operationClient, "POST", "/api/v1/withdraw", req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (w *WalletClient) GetBalance(userID uint64) (*BalanceResponse, error) {
+func (w *WalletClient) GetBalance(ctx context.Context, userID uint64) (*BalanceResponse, error) {
 	var resp BalanceResponse
 	url := fmt.Sprintf("/api/v1/balance/%d", userID)
-	if err := w.makeJSONRequest("GET", url, nil, &resp); err != nil {
+	if err := w.makeJSONRequest(ctx, w.balanceClient, "GET", url, nil, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (w *WalletClient) makeJSONRequest(method, endpoint string, payload any, response any) error {
+// makeJSONRequest sends the request with client. The call is aborted as soon
+// as ctx is done, whichever of ctx and the client deadlines comes first.
+func (w *WalletClient) makeJSONRequest(ctx context.Context, client *http.Client, method, endpoint string, payload any, response any) error {
 	url := fmt.Sprintf("%s%s", w.baseURL, endpoint)
 
 	var body io.Reader
@@ -47,7 +49,7 @@ func (w *WalletClient) makeJSONRequest(method, endpoint string, payload any, res
 		body = bytes.NewReader(data)
 	}
 
-	httpReq, err := http.NewRequest(method, url, body)
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil || httpReq == nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -55,7 +57,7 @@ func (w *WalletClient) makeJSONRequest(method, endpoint string, payload any, res
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", w.token)
 
-	resp, err := w.client.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		return fmt.Errorf("failed to make request: %w", err)
 	}
@@ -66,8 +68,9 @@ func (w *WalletClient) makeJSONRequest(method, endpoint string, payload any, res
 		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
 			return fmt.Errorf("failed to decode error response: %w", err)
 		}
-		slog.Error(errResp.Msg, "error", errResp.Code)
-		return errors.New(errResp.Code)
+		errResp.Status = resp.StatusCode
+		slog.Error(errResp.Msg, "error", errResp.Code, "status", resp.StatusCode)
+		return &errResp
 	}
 
 	if response != nil {
@@ -0,0 +1,384 @@
+package walletclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+// Error codes returned by FakeWallet. They mirror the codes the remote wallet
+// reports in ErrorResponse.Code.
+const (
+	ErrCodeUserNotFound       = "USER_NOT_FOUND"
+	ErrCodeInsufficientFunds  = "INSUFFICIENT_FUNDS"
+	ErrCodeInvalidRequest     = "INVALID_REQUEST"
+	ErrCodeDuplicateReference = "DUPLICATE_REFERENCE"
+	ErrCodeDuplicateBet       = "DUPLICATE_BET"
+)
+
+type FakeMethod string
+
+const (
+	FakeMethodDeposit    FakeMethod = "DEPOSIT"
+	FakeMethodWithdraw   FakeMethod = "WITHDRAW"
+	FakeMethodGetBalance FakeMethod = "BALANCE"
+)
+
+// FakeWallet is an in-memory Wallet. It keeps a balance per user and
+// currency, replays operations that reuse a reference instead of applying
+// them twice, and can be told to fail calls with a given error code.
+type FakeWallet struct {
+	mu sync.Mutex
+
+	// DefaultCurrency and DefaultBalance are used to open an account the
+	// first time an unknown user is seen. Unknown users are rejected with
+	// USER_NOT_FOUND when DefaultCurrency is empty.
+	DefaultCurrency string
+	DefaultBalance  models.Amount
+
+	accounts   map[uint64]*fakeAccount
+	references map[string]fakeOperation
+	bets       map[fakeBetKey]string
+	failNext   map[FakeMethod][]string
+	failAlways map[FakeMethod]string
+	lastID     int
+}
+
+type fakeAccount struct {
+	currency string
+	balances map[string]models.Amount
+}
+
+type fakeOperation struct {
+	method   FakeMethod
+	userID   int
+	currency string
+	amount   models.Amount
+	betID    uint64
+	id       int
+}
+
+type fakeBetKey struct {
+	userID int
+	betID  uint64
+}
+
+func NewFakeWallet(defaultCurrency string, defaultBalance models.Amount) *FakeWallet {
+	return &FakeWallet{
+		DefaultCurrency: defaultCurrency,
+		DefaultBalance:  defaultBalance,
+		accounts:        make(map[uint64]*fakeAccount),
+		references:      make(map[string]fakeOperation),
+		bets:            make(map[fakeBetKey]string),
+		failNext:        make(map[FakeMethod][]string),
+		failAlways:      make(map[FakeMethod]string),
+	}
+}
+
+// SetBalance opens the account if needed and sets its balance in currency.
+// The first currency set for a user becomes the one GetBalance reports.
+func (f *FakeWallet) SetBalance(userID uint64, currency string, amount models.Amount) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	acc, ok := f.accounts[userID]
+	if !ok {
+		acc = &fakeAccount{currency: currency, balances: make(map[string]models.Amount)}
+		f.accounts[userID] = acc
+	}
+	acc.balances[currency] = amount
+}
+
+// Balance returns the balance of a user in currency.
+func (f *FakeWallet) Balance(userID uint64, currency string) models.Amount {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	acc, ok := f.accounts[userID]
+	if !ok {
+		return 0
+	}
+	return acc.balances[currency]
+}
+
+// FailNext makes the next call to method fail with code. Queued failures are
+// consumed in order.
+func (f *FakeWallet) FailNext(method FakeMethod, code string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failNext[method] = append(f.failNext[method], code)
+}
+
+// FailAlways makes every call to method fail with code until ClearFailures.
+func (f *FakeWallet) FailAlways(method FakeMethod, code string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failAlways[method] = code
+}
+
+func (f *FakeWallet) ClearFailures() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failNext = make(map[FakeMethod][]string)
+	f.failAlways = make(map[FakeMethod]string)
+}
+
+func (f *FakeWallet) GetBalance(ctx context.Context, userID uint64) (*BalanceResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injectedFailure(FakeMethodGetBalance); err != nil {
+		return nil, err
+	}
+
+	acc, err := f.account(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BalanceResponse{
+		Balance:  formatFakeAmount(acc.balances[acc.currency]),
+		Currency: acc.currency,
+	}, nil
+}
+
+func (f *FakeWallet) Deposit(ctx context.Context, req DepositRequest) (*OperationResponse, error) {
+	ops := make([]fakeOperation, 0, len(req.Transactions))
+	refs := make([]string, 0, len(req.Transactions))
+	for _, t := range req.Transactions {
+		ops = append(ops, fakeOperation{
+			method:   FakeMethodDeposit,
+			userID:   req.UserID,
+			currency: req.Currency,
+			amount:   t.Amount,
+			betID:    t.BetID,
+		})
+		refs = append(refs, t.Reference)
+	}
+	return f.apply(ctx, FakeMethodDeposit, req.UserID, req.Currency, ops, refs)
+}
+
+func (f *FakeWallet) Withdraw(ctx context.Context, req WithdrawRequest) (*OperationResponse, error) {
+	ops := make([]fakeOperation, 0, len(req.Transactions))
+	refs := make([]string, 0, len(req.Transactions))
+	for _, t := range req.Transactions {
+		ops = append(ops, fakeOperation{
+			method:   FakeMethodWithdraw,
+			userID:   req.UserID,
+			currency: req.Currency,
+			amount:   t.Amount,
+			betID:    t.BetID,
+		})
+		refs = append(refs, t.Reference)
+	}
+	return f.apply(ctx, FakeMethodWithdraw, req.UserID, req.Currency, ops, refs)
+}
+
+// apply validates every entry of a request before touching any balance, so
+// a request either applies fully or not at all. Entries whose reference was
+// already applied with the same payload are replayed, not applied again.
+func (f *FakeWallet) apply(ctx context.Context, method FakeMethod, userID int, currency string, ops []fakeOperation, refs []string) (*OperationResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injectedFailure(method); err != nil {
+		return nil, err
+	}
+
+	if userID <= 0 || currency == "" || len(ops) == 0 {
+		return nil, &ErrorResponse{Code: ErrCodeInvalidRequest, Msg: "userId, currency and transactions are required"}
+	}
+
+	acc, err := f.account(uint64(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var total models.Amount
+	replayed := make([]bool, len(ops))
+	seen := make(map[string]bool, len(refs))
+	for i, op := range ops {
+		ref := refs[i]
+		if ref == "" || op.amount < 0 {
+			return nil, &ErrorResponse{Code: ErrCodeInvalidRequest, Msg: "every transaction needs a reference and a positive amount"}
+		}
+		if seen[ref] {
+			return nil, &ErrorResponse{Code: ErrCodeDuplicateReference, Msg: "reference " + ref + " used twice in one request"}
+		}
+		seen[ref] = true
+
+		if prev, ok := f.references[ref]; ok {
+			prev.id = 0
+			if prev != op {
+				return nil, &ErrorResponse{Code: ErrCodeDuplicateReference, Msg: "reference " + ref + " was used for a different operation"}
+			}
+			replayed[i] = true
+			continue
+		}
+
+		if method == FakeMethodWithdraw {
+			if prevRef, ok := f.bets[fakeBetKey{userID, op.betID}]; ok && prevRef != ref {
+				return nil, &ErrorResponse{Code: ErrCodeDuplicateBet, Msg: "bet already placed"}
+			}
+		}
+		total += op.amount
+	}
+
+	if method == FakeMethodWithdraw && acc.balances[currency] < total {
+		return nil, &ErrorResponse{Code: ErrCodeInsufficientFunds, Msg: "insufficient funds"}
+	}
+
+	resp := &OperationResponse{Transactions: make([]OperationResponseTransaction, 0, len(ops))}
+	for i, op := range ops {
+		ref := refs[i]
+		if replayed[i] {
+			resp.Transactions = append(resp.Transactions, OperationResponseTransaction{
+				ID:        f.references[ref].id,
+				Reference: ref,
+			})
+			continue
+		}
+
+		f.lastID++
+		op.id = f.lastID
+		f.references[ref] = op
+		if method == FakeMethodWithdraw {
+			f.bets[fakeBetKey{userID, op.betID}] = ref
+			acc.balances[currency] -= op.amount
+		} else {
+			acc.balances[currency] += op.amount
+		}
+
+		resp.Transactions = append(resp.Transactions, OperationResponseTransaction{
+			ID:        op.id,
+			Reference: ref,
+		})
+	}
+	resp.Balance = formatFakeAmount(acc.balances[currency])
+
+	return resp, nil
+}
+
+func (f *FakeWallet) account(userID uint64) (*fakeAccount, error) {
+	if acc, ok := f.accounts[userID]; ok {
+		return acc, nil
+	}
+	if f.DefaultCurrency == "" {
+		return nil, &ErrorResponse{Code: ErrCodeUserNotFound, Msg: "user not found"}
+	}
+
+	acc := &fakeAccount{
+		currency: f.DefaultCurrency,
+		balances: map[string]models.Amount{f.DefaultCurrency: f.DefaultBalance},
+	}
+	f.accounts[userID] = acc
+	return acc, nil
+}
+
+func (f *FakeWallet) injectedFailure(method FakeMethod) error {
+	if code, ok := f.failAlways[method]; ok {
+		return &ErrorResponse{Code: code, Msg: "injected failure"}
+	}
+	if queue := f.failNext[method]; len(queue) > 0 {
+		f.failNext[method] = queue[1:]
+		return &ErrorResponse{Code: queue[0], Msg: "injected failure"}
+	}
+	return nil
+}
+
+func formatFakeAmount(amount models.Amount) string {
+	return amount.String()
+}
+
+// FakeWalletState is a serializable copy of the accounts and applied
+// references of a FakeWallet.
+type FakeWalletState struct {
+	Accounts   map[uint64]FakeAccountState   `json:"accounts"`
+	References map[string]FakeOperationState `json:"references"`
+	LastID     int                           `json:"last_id"`
+}
+
+type FakeAccountState struct {
+	Currency string                   `json:"currency"`
+	Balances map[string]models.Amount `json:"balances"`
+}
+
+type FakeOperationState struct {
+	Method   FakeMethod    `json:"method"`
+	UserID   int           `json:"user_id"`
+	Currency string        `json:"currency"`
+	Amount   models.Amount `json:"amount"`
+	BetID    uint64        `json:"bet_id"`
+	ID       int           `json:"id"`
+}
+
+// Snapshot returns a copy of the wallet state.
+func (f *FakeWallet) Snapshot() FakeWalletState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state := FakeWalletState{
+		Accounts:   make(map[uint64]FakeAccountState, len(f.accounts)),
+		References: make(map[string]FakeOperationState, len(f.references)),
+		LastID:     f.lastID,
+	}
+	for userID, acc := range f.accounts {
+		balances := make(map[string]models.Amount, len(acc.balances))
+		for currency, balance := range acc.balances {
+			balances[currency] = balance
+		}
+		state.Accounts[userID] = FakeAccountState{Currency: acc.currency, Balances: balances}
+	}
+	for ref, op := range f.references {
+		state.References[ref] = FakeOperationState{
+			Method:   op.method,
+			UserID:   op.userID,
+			Currency: op.currency,
+			Amount:   op.amount,
+			BetID:    op.betID,
+			ID:       op.id,
+		}
+	}
+	return state
+}
+
+// Restore replaces the wallet state with a previous Snapshot.
+func (f *FakeWallet) Restore(state FakeWalletState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.accounts = make(map[uint64]*fakeAccount, len(state.Accounts))
+	f.references = make(map[string]fakeOperation, len(state.References))
+	f.bets = make(map[fakeBetKey]string)
+	f.lastID = state.LastID
+
+	for userID, acc := range state.Accounts {
+		balances := make(map[string]models.Amount, len(acc.Balances))
+		for currency, balance := range acc.Balances {
+			balances[currency] = balance
+		}
+		f.accounts[userID] = &fakeAccount{currency: acc.Currency, balances: balances}
+	}
+	for ref, op := range state.References {
+		f.references[ref] = fakeOperation{
+			method:   op.Method,
+			userID:   op.UserID,
+			currency: op.Currency,
+			amount:   op.Amount,
+			betID:    op.BetID,
+			id:       op.ID,
+		}
+		if op.Method == FakeMethodWithdraw {
+			f.bets[fakeBetKey{op.UserID, op.BetID}] = ref
+		}
+	}
+}
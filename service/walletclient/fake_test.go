@@ -0,0 +1,141 @@
+package walletclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+)
+
+func withdraw(userID int, amount models.Amount, betID uint64, reference string) WithdrawRequest {
+	return WithdrawRequest{
+		UserID:   userID,
+		Currency: "USD",
+		Transactions: []WithdrawRequestTransaction{
+			{Amount: amount, BetID: betID, Reference: reference},
+		},
+	}
+}
+
+func assertCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var walletErr *ErrorResponse
+	if !errors.As(err, &walletErr) || walletErr.Code != code {
+		t.Fatalf("got %v, want %s", err, code)
+	}
+}
+
+func TestFakeWalletBalances(t *testing.T) {
+	f := NewFakeWallet("USD", models.NewAmount(100))
+
+	resp, err := f.Withdraw(context.Background(), withdraw(1, models.NewAmount(30), 1, "bet-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Balance != "70.00" || len(resp.Transactions) != 1 || resp.Transactions[0].Reference != "bet-1" {
+		t.Errorf("withdraw answered %+v", resp)
+	}
+
+	_, err = f.Deposit(context.Background(), DepositRequest{
+		UserID:   1,
+		Currency: "USD",
+		Transactions: []DepositRequestTransaction{
+			{Amount: models.NewAmount(50), BetID: 1, Reference: "win-1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance, err := f.GetBalance(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Balance != "120.00" || balance.Currency != "USD" {
+		t.Errorf("balance is %s %s, want 120.00 USD", balance.Balance, balance.Currency)
+	}
+	// Other users have their own account
+	if got := f.Balance(2, "USD"); got != 0 {
+		t.Errorf("untouched user has %s", got)
+	}
+}
+
+func TestFakeWalletReplaysReferences(t *testing.T) {
+	f := NewFakeWallet("USD", models.NewAmount(100))
+
+	first, err := f.Withdraw(context.Background(), withdraw(1, models.NewAmount(30), 1, "bet-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := f.Withdraw(context.Background(), withdraw(1, models.NewAmount(30), 1, "bet-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Transactions[0].ID != first.Transactions[0].ID {
+		t.Errorf("replay has id %d, want %d", replayed.Transactions[0].ID, first.Transactions[0].ID)
+	}
+	if got := f.Balance(1, "USD"); got != models.NewAmount(70) {
+		t.Errorf("balance is %s after a replay, want 70.00", got)
+	}
+
+	_, err = f.Withdraw(context.Background(), withdraw(1, models.NewAmount(40), 1, "bet-1"))
+	assertCode(t, err, ErrCodeDuplicateReference)
+	_, err = f.Withdraw(context.Background(), withdraw(1, models.NewAmount(30), 1, "bet-2"))
+	assertCode(t, err, ErrCodeDuplicateBet)
+}
+
+func TestFakeWalletAppliesRequestsWhole(t *testing.T) {
+	f := NewFakeWallet("USD", models.NewAmount(100))
+
+	_, err := f.Withdraw(context.Background(), WithdrawRequest{
+		UserID:   1,
+		Currency: "USD",
+		Transactions: []WithdrawRequestTransaction{
+			{Amount: models.NewAmount(60), BetID: 1, Reference: "bet-1"},
+			{Amount: models.NewAmount(60), BetID: 2, Reference: "bet-2"},
+		},
+	})
+	assertCode(t, err, ErrCodeInsufficientFunds)
+	if got := f.Balance(1, "USD"); got != models.NewAmount(100) {
+		t.Errorf("balance is %s after a refused request, want 100.00", got)
+	}
+}
+
+func TestFakeWalletInjectedFailures(t *testing.T) {
+	f := NewFakeWallet("", 0)
+	_, err := f.GetBalance(context.Background(), 1)
+	assertCode(t, err, ErrCodeUserNotFound)
+
+	f.SetBalance(1, "EUR", models.NewAmount(10))
+	f.FailNext(FakeMethodGetBalance, "WALLET_DOWN")
+	_, err = f.GetBalance(context.Background(), 1)
+	assertCode(t, err, "WALLET_DOWN")
+	if _, err := f.GetBalance(context.Background(), 1); err != nil {
+		t.Fatalf("failure was not consumed: %v", err)
+	}
+
+	f.FailAlways(FakeMethodWithdraw, "WALLET_DOWN")
+	for range 2 {
+		_, err = f.Withdraw(context.Background(), WithdrawRequest{UserID: 1, Currency: "EUR", Transactions: []WithdrawRequestTransaction{{Amount: models.NewAmount(1), BetID: 1, Reference: "bet-1"}}})
+		assertCode(t, err, "WALLET_DOWN")
+	}
+	f.ClearFailures()
+	if _, err := f.Withdraw(context.Background(), WithdrawRequest{UserID: 1, Currency: "EUR", Transactions: []WithdrawRequestTransaction{{Amount: models.NewAmount(1), BetID: 1, Reference: "bet-1"}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeWalletHonoursContext(t *testing.T) {
+	f := NewFakeWallet("USD", models.NewAmount(100))
+	f.SetBalance(1, "USD", models.NewAmount(100))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := f.Withdraw(ctx, withdraw(1, models.NewAmount(30), 1, "bet-1")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if got := f.Balance(1, "USD"); got != models.NewAmount(100) {
+		t.Errorf("balance is %s after a cancelled call, want 100.00", got)
+	}
+}
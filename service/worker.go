@@ -2,247 +2,483 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
 	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/repository"
 	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
 )
 
-const (
-	MaxRetryAttempts = 3
-	RetryInterval    = 30 * time.Second
-)
-
-// StartPendingTransactionWorker starts a background worker to process pending transactions
+// StartPendingTransactionWorker starts the background workers processing
+// pending transactions, i.e. the dispatchers delivering the wallet commands
+// of the outbox, and blocks until ctx is done. Players are partitioned
+// across WORKER_COUNT workers by id: a player is always handled by the same
+// worker, so its transactions stay in order while players of different
+// workers are processed in parallel.
+//
+// Workers wake up as soon as transactions of one of their players are queued,
+// and every WORKER_TICK_INTERVAL in case a notification was missed.
 func (s *Service) StartPendingTransactionWorker(ctx context.Context) {
-	ticker := time.NewTicker(RetryInterval)
-	defer ticker.Stop()
+	workers := internal.Config.WORKER_COUNT
+
+	slog.Info("Starting pending transaction worker", "workers", workers)
+
+	// Recover what a previous run of this process left processing before
+	// claiming anything, the other stale transactions are swept periodically
+	s.sweepStaleTransactions(ctx, internal.Config.WORKER_ID)
+
+	wakeups := make([]chan struct{}, workers)
+	for shard := range wakeups {
+		wakeups[shard] = make(chan struct{}, 1)
+	}
 
-	slog.Info("Starting pending transaction worker")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.runTransactionSweeper(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.listenDispatchResults(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Only the worker of the player is woken up, a pending wake-up is enough
+		for playerID := range s.Repository.ListenPendingTransactions(ctx) {
+			select {
+			case wakeups[playerID%uint64(workers)] <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	for shard := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runPendingTransactionWorker(ctx, shard, workers, wakeups[shard])
+		}()
+	}
+	wg.Wait()
+
+	slog.Info("Stopping pending transaction worker")
+}
+
+func (s *Service) runPendingTransactionWorker(ctx context.Context, shard, shards int, wakeup <-chan struct{}) {
+	ticker := time.NewTicker(internal.Config.WORKER_TICK_INTERVAL)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info("Stopping pending transaction worker")
 			return
 		case <-ticker.C:
-			s.processPendingTransactions(ctx)
+		case <-wakeup:
 		}
+		s.processPendingTransactions(ctx, shard, shards)
 	}
 }
 
-// processPendingTransactions processes pending transactions one at a time per user
-func (s *Service) processPendingTransactions(ctx context.Context) {
-	// Process transactions one at a time until no more processable transactions
+// notifyPending wakes up the workers when tx is left pending for them
+func (s *Service) notifyPending(ctx context.Context, tx *models.Transaction) {
+	if tx.Status != models.TransactionStatusPending {
+		return
+	}
+	if err := s.Repository.NotifyPendingTransactions(ctx, tx.PlayerID); err != nil {
+		slog.Warn("Failed to notify pending transaction", "error", err, "transaction_id", tx.ID)
+	}
+}
+
+// processPendingTransactions processes the pending transactions of a shard,
+// one batch at a time per user
+func (s *Service) processPendingTransactions(ctx context.Context, shard, shards int) {
+	owner := fmt.Sprintf("%s/%d", internal.Config.WORKER_ID, shard)
+
+	// Process batches until no more processable transactions
 	for {
-		// Get the next processable transaction
-		tx, err := s.Repository.GetNextProcessableTransaction(ctx)
-		if err != nil {
-			// If no rows found, it means no processable transactions available
-			if err == sql.ErrNoRows {
-				return // No more transactions to process
-			}
-			slog.Error("Failed to get next processable transaction", "error", err)
+		// Leave everything pending until the wallet circuit breaker lets calls through
+		if !s.walletAvailable() {
+			slog.Warn("Wallet circuit breaker is open, postponing pending transactions", "shard", shard)
 			return
 		}
 
-		if tx == nil {
+		// Atomically claim the next transactions of a player, so other
+		// workers and replicas skip them until the lease expires
+		claimed, err := s.Repository.ClaimTransactions(ctx, owner, shard, shards, internal.Config.WORKER_BATCH_SIZE, internal.Config.WORKER_LEASE_DURATION)
+		if err != nil {
+			slog.Error("Failed to claim pending transactions", "error", err, "shard", shard)
+			return
+		}
+		if len(claimed) == 0 {
 			return // No more transactions to process
 		}
 
-		// Check if transaction exceeded max retry attempts
-		if tx.Attempts >= MaxRetryAttempts {
-			slog.Warn("Transaction exceeded max retry attempts, marking as failed", "transaction_id", tx.ID, "attempts", tx.Attempts)
-			tx.Status = models.TransactionStatusFailed
-			if err := s.Repository.UpdateTransaction(ctx, tx); err != nil {
-				slog.Error("Failed to update failed transaction", "error", err, "transaction_id", tx.ID)
+		entries := s.nextWalletBatch(ctx, claimed)
+
+		// Give back the claimed transactions that don't fit in the batch
+		var released []uuid.UUID
+		for _, tx := range claimed[len(entries):] {
+			if tx.Status == models.TransactionStatusProcessing {
+				released = append(released, tx.ID)
 			}
-			continue // Try next transaction
+		}
+		if err := s.Repository.ReleaseTransactions(ctx, owner, released); err != nil {
+			slog.Error("Failed to release claimed transactions", "error", err, "player_id", claimed[0].PlayerID)
+		}
+		if len(entries) == 0 {
+			continue // The first transaction was failed, try the next one
 		}
 
-		// Atomically start processing this transaction
-		if err := s.Repository.StartProcessingTransaction(ctx, tx.ID); err != nil {
-			slog.Warn("Failed to start processing transaction (may already be processing)", "error", err, "transaction_id", tx.ID)
-			continue // Try next transaction
+		slog.Info("Processing transactions", "player_id", claimed[0].PlayerID, "type", entries[0].tx.Type, "count", len(entries), "shard", shard)
+
+		s.submitWalletBatch(ctx, entries)
+		for _, entry := range entries {
+			err := s.saveWalletEntry(ctx, entry, "worker:"+owner)
+			if errors.Is(err, models.ErrVersionConflict) {
+				// Someone else (e.g. the sweeper) saved it meanwhile, a new
+				// attempt reuses the reference which the wallet deduplicates
+				slog.Warn("Transaction was saved concurrently, dropping the worker result", "error", err, "transaction_id", entry.tx.ID)
+			} else if err != nil {
+				slog.Error("Failed to update transaction after retry", "error", err, "transaction_id", entry.tx.ID)
+			}
 		}
 
-		slog.Info("Processing transaction", "transaction_id", tx.ID, "type", tx.Type, "player_id", tx.PlayerID)
+		// Small delay between batches to prevent overwhelming the wallet service
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(internal.Config.WORKER_TRANSACTION_DELAY):
+		}
+	}
+}
+
+// walletEntry is a pending transaction translated into wallet operations
+type walletEntry struct {
+	tx *models.Transaction
+	// op is the wallet operation, a cancel reverses its original transaction
+	op models.TransactionType
+	// commands are the outbox rows the entry delivers, marked once confirmed.
+	// A settlement of several bets has a command per bet won.
+	commands []*models.WalletCommand
+	// settles are the transactions the entry settles, see finalizedBy
+	settles []*models.Transaction
+	// noop entries are confirmed without calling the wallet, e.g. a lost bet
+	noop bool
+}
 
-		// Increment attempt counter
-		tx.Attempts++
+// nextWalletBatch returns the first claimed transaction and the ones that
+// directly follow it, as long as they share its type, currency and wallet
+// operation so they fit in a single wallet request.
+//
+// When the first transaction can never succeed it is marked as failed and an
+// empty batch is returned.
+func (s *Service) nextWalletBatch(ctx context.Context, claimed []*models.Transaction) []*walletEntry {
+	var entries []*walletEntry
+	for _, tx := range claimed {
+		// Later transactions whose own retry is not due yet wait for the next batch
+		if len(entries) > 0 && tx.NextAttemptAt.After(time.Now()) {
+			break
+		}
 
-		// Process the transaction
-		retrySTatus := models.TransactionStatusPending
-		switch tx.Type {
-		case models.TransactionTypeWithdraw:
-			retrySTatus = s.retryWithdraw(ctx, tx)
-		case models.TransactionTypeDeposit:
-			retrySTatus = s.retryDeposit(ctx, tx)
-		case models.TransactionTypeCancel:
-			retrySTatus = s.retryCancel(ctx, tx)
-		default:
-			slog.Error("Unknown transaction type", "transaction_id", tx.ID, "type", tx.Type)
+		// Check if transaction exceeded max retry attempts
+		if tx.Attempts >= retryPolicy(tx.Type).MaxAttempts {
+			if len(entries) == 0 {
+				slog.Warn("Transaction exceeded max retry attempts, marking as failed", "transaction_id", tx.ID, "attempts", tx.Attempts)
+				s.deadLetter(ctx, tx, fmt.Sprintf("exceeded max retry attempts (%d)", tx.Attempts))
+			}
+			break
 		}
 
-		tx.Status = retrySTatus
-		if err := s.Repository.UpdateTransaction(ctx, tx); err != nil {
-			slog.Error("Failed to update transaction after retry", "error", err, "transaction_id", tx.ID)
+		entry, err := s.prepareWalletEntry(ctx, tx)
+		if err != nil {
+			if len(entries) == 0 {
+				slog.Error("Transaction can not be processed, marking as failed", "error", err, "transaction_id", tx.ID)
+				s.deadLetter(ctx, tx, err.Error())
+			}
+			break
 		}
 
-		// Small delay between transactions to prevent overwhelming the wallet service
-		time.Sleep(1 * time.Second)
+		if len(entries) > 0 {
+			head := entries[0]
+			if head.noop || entry.noop || entry.tx.Type != head.tx.Type ||
+				entry.tx.Currency != head.tx.Currency || entry.op != head.op {
+				break
+			}
+		}
+		entries = append(entries, entry)
 	}
+
+	return entries
 }
 
-// retryWithdraw retries a pending withdrawal transaction
-func (s *Service) retryWithdraw(ctx context.Context, tx *models.Transaction) models.TransactionStatus {
-	ogAmount, err := strconv.ParseFloat(tx.Amount, 64)
-	if err != nil {
-		slog.Error(err.Error())
-		return models.TransactionStatusFailed
+// prepareWalletEntry builds the wallet operations for a pending transaction
+// from its wallet commands in the outbox. An error means the transaction can
+// never succeed.
+func (s *Service) prepareWalletEntry(ctx context.Context, tx *models.Transaction) (*walletEntry, error) {
+	if tx.Amount < 0 {
+		return nil, errors.New("amount should not be negative")
 	}
 
-	withdrawReq := walletclient.WithdrawRequest{
-		UserID:   int(tx.PlayerID),
-		Currency: string(tx.Currency),
-		Transactions: []walletclient.WithdrawRequestTransaction{
-			{
-				Amount:    ogAmount,
-				BetID:     tx.ProviderID,
-				Reference: tx.ID.String(),
-			},
-		},
+	settles, err := s.settledTransactions(ctx, tx)
+	if err != nil {
+		return nil, err
 	}
+	for _, settled := range settles {
+		applied := settled.Status == models.TransactionStatusConfirmed ||
+			// Finalized by another cancel, or by its settlement for a round rollback
+			(tx.Type == models.TransactionTypeCancel && settled.Status == models.TransactionStatusFinalized)
+		if !applied {
+			return nil, fmt.Errorf("transaction %d is %s. you can only settle or cancel confirmed transactions", settled.ProviderID, settled.Status)
+		}
+	}
+	entry := &walletEntry{tx: tx, op: tx.Type, settles: settles}
 
-	_, err = s.WalletClient.Withdraw(withdrawReq)
+	commands, err := s.GetWalletCommandsByTransactionID(ctx, tx.ID)
 	if err != nil {
-		slog.Error("Failed to retry withdrawal", "error", err, "transaction_id", tx.ID)
-		return models.TransactionStatusPending
+		return nil, fmt.Errorf("failed to get wallet commands: %w", err)
+	}
+	if len(commands) == 0 {
+		// Transactions queued before the outbox, or lost bets which have no command
+		var original *models.Transaction
+		if len(settles) > 0 {
+			original = settles[0]
+		}
+		command, err := models.NewWalletCommand(tx, original)
+		if err != nil {
+			return nil, err
+		}
+		if command == nil {
+			// If amount is 0, bet is lost - no deposit needed
+			entry.noop = true
+			return entry, nil
+		}
+		commands = append(commands, command)
 	}
 
-	return models.TransactionStatusConfirmed
+	entry.commands = commands
+	entry.op = commands[0].Operation
+	return entry, nil
 }
 
-// retryDeposit retries a pending deposit transaction
-func (s *Service) retryDeposit(ctx context.Context, tx *models.Transaction) models.TransactionStatus {
-	ogAmount, err := strconv.ParseFloat(tx.Amount, 64)
-	if err != nil {
-		slog.Error(err.Error())
-		return models.TransactionStatusFailed
+// settledTransactions returns the transactions settled by tx: the bets a
+// settlement settles, or the original transaction of a cancel
+func (s *Service) settledTransactions(ctx context.Context, tx *models.Transaction) ([]*models.Transaction, error) {
+	var providerIDs []uint64
+	switch tx.Type {
+	case models.TransactionTypeWithdraw:
+		return nil, nil
+	case models.TransactionTypeDeposit:
+		bets, err := s.GetSettlementBets(ctx, tx.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get settled bets: %w", err)
+		}
+		for _, bet := range bets {
+			providerIDs = append(providerIDs, bet.BetProviderID)
+		}
+		if len(providerIDs) == 0 {
+			providerIDs = append(providerIDs, tx.WithdrawProviderID)
+		}
+	case models.TransactionTypeCancel:
+		providerIDs = append(providerIDs, tx.WithdrawProviderID)
+	default:
+		return nil, fmt.Errorf("unknown transaction type %q", tx.Type)
 	}
 
-	oldTx, err := s.GetTransactionByProviderID(ctx, tx.WithdrawProviderID)
-	if err != nil || oldTx == nil {
-		slog.Error("failed to get withdraw transaction", "error", err)
-		return models.TransactionStatusFailed
+	settles := make([]*models.Transaction, 0, len(providerIDs))
+	for _, providerID := range providerIDs {
+		settled, err := s.GetTransactionByProviderID(ctx, providerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transaction %d settled by %s: %w", providerID, tx.ID, err)
+		}
+		if settled == nil {
+			return nil, fmt.Errorf("transaction %d settled by %s not found", providerID, tx.ID)
+		}
+		settles = append(settles, settled)
 	}
+	return settles, nil
+}
 
-	if oldTx.Status == models.TransactionStatusFailed {
-		slog.Error("Withdraw transaction is failed. you cannot deposite")
-		return models.TransactionStatusFailed
+// finalizedBy returns the transactions of settles that tx finalizes once it
+// is confirmed: all the bets of a settlement, the original transaction of a
+// cancel once its confirmed cancels, tx included, leave nothing of it. The
+// refunds reserved by cancels still waiting for the wallet don't count, one
+// of them may fail and give its part back. tx must not be saved as confirmed
+// yet.
+func finalizedBy(ctx context.Context, repo repository.Repository, tx *models.Transaction, settles []*models.Transaction) ([]*models.Transaction, error) {
+	if tx.Type != models.TransactionTypeCancel {
+		return settles, nil
+	}
+	var finalized []*models.Transaction
+	for _, settled := range settles {
+		if settled.Status == models.TransactionStatusFinalized {
+			continue
+		}
+		refunded, err := repo.GetConfirmedRefund(ctx, settled.ProviderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the confirmed refund of transaction %d: %w", settled.ProviderID, err)
+		}
+		if refunded+tx.Amount >= settled.Amount {
+			finalized = append(finalized, settled)
+		}
 	}
+	return finalized, nil
+}
 
-	if ogAmount < 0 {
-		slog.Error("og amount should not be negative", "transaction_id", tx.ID.String())
-		return models.TransactionStatusFailed
+// submitWalletBatch sends the entries in a single wallet request and sets
+// the resulting status on each transaction. Only the entries whose commands
+// the wallet all acknowledges by reference are confirmed, the others stay
+// pending.
+func (s *Service) submitWalletBatch(ctx context.Context, entries []*walletEntry) {
+	for _, entry := range entries {
+		entry.tx.Attempts++
+		entry.tx.Status = models.TransactionStatusPending
+		entry.tx.LockedBy = ""
+		entry.tx.LockedUntil = time.Time{}
 	}
 
-	if ogAmount > 0 {
-		depositReq := walletclient.DepositRequest{
-			UserID:   int(tx.PlayerID),
-			Currency: string(tx.Currency),
-			Transactions: []walletclient.DepositRequestTransaction{
-				{
-					Amount:    ogAmount,
-					BetID:     tx.ProviderID,
-					Reference: tx.ID.String(),
-				},
-			},
-		}
-		_, err := s.WalletClient.Deposit(depositReq)
+	head := entries[0]
+	confirmed := make(map[*walletEntry]bool, len(entries))
+	if head.noop {
+		confirmed[head] = true
+	} else {
+		resp, req, err := s.sendWalletBatch(ctx, entries)
 		if err != nil {
-			slog.Error("Failed to retry deposit", "error", err, "transaction_id", tx.ID)
-			return models.TransactionStatusPending
+			for _, entry := range entries {
+				entry.tx.NextAttemptAt = nextAttemptAt(entry.tx.Type, entry.tx.Attempts)
+				s.recordWalletAttempt(ctx, entry.tx.ID, entry.op, req, err)
+			}
+			slog.Error("Failed to retry transactions", "error", err, "player_id", head.tx.PlayerID, "type", head.tx.Type, "count", len(entries), "next_attempt_at", head.tx.NextAttemptAt)
+			return
+		}
+
+		acknowledged := make(map[string]bool, len(resp.Transactions))
+		for _, t := range resp.Transactions {
+			acknowledged[t.Reference] = true
+		}
+
+		// An entry is confirmed once all of its commands are, a wallet that
+		// doesn't itemize its answer applied the whole request
+		for _, entry := range entries {
+			confirmed[entry] = true
+			for _, command := range entry.commands {
+				if len(resp.Transactions) > 0 && !acknowledged[command.Reference] {
+					confirmed[entry] = false
+				}
+			}
+			if confirmed[entry] {
+				for _, command := range entry.commands {
+					command.Balance = resp.Balance
+				}
+			}
+		}
+
+		for _, entry := range entries {
+			var attemptErr error
+			if !confirmed[entry] {
+				attemptErr = errNotConfirmed
+			}
+			s.recordWalletAttempt(ctx, entry.tx.ID, entry.op, req, attemptErr)
 		}
 	}
 
-	oldTx.Status = models.TransactionStatusFinalized
-	err = s.UpdateTransaction(ctx, oldTx)
-	if err != nil {
-		slog.Error("failed to update withdraw transaction", "error", err)
+	for _, entry := range entries {
+		if !confirmed[entry] {
+			entry.tx.NextAttemptAt = nextAttemptAt(entry.tx.Type, entry.tx.Attempts)
+			slog.Warn("Wallet did not confirm transaction, keeping it pending", "transaction_id", entry.tx.ID, "commands", len(entry.commands), "next_attempt_at", entry.tx.NextAttemptAt)
+			continue
+		}
+
+		entry.tx.Status = models.TransactionStatusConfirmed
 	}
+}
 
-	return models.TransactionStatusConfirmed
+// saveWalletEntry saves the transaction of a submitted entry on behalf of
+// actor, and once it is confirmed marks its wallet commands as delivered and
+// finalizes the transactions it settles, in the same db transaction. The
+// requests waiting for the transaction are woken up once it commits.
+func (s *Service) saveWalletEntry(ctx context.Context, entry *walletEntry, actor string) error {
+	return s.Repository.WithTx(ctx, func(repo repository.Repository) error {
+		if entry.tx.Status == models.TransactionStatusConfirmed {
+			finalized, err := finalizedBy(ctx, repo, entry.tx, entry.settles)
+			if err != nil {
+				return err
+			}
+			for _, settled := range finalized {
+				if _, err := saveTransaction(ctx, repo, settled, actor, finalizeTransaction); err != nil {
+					return fmt.Errorf("failed to update settled transaction %s: %w", settled.ID, err)
+				}
+			}
+			if err := markDelivered(ctx, repo, entry.commands); err != nil {
+				return err
+			}
+		}
+		if err := repo.UpdateTransaction(ctx, entry.tx, actor); err != nil {
+			return err
+		}
+		return repo.NotifyDispatchResult(ctx, entry.tx.ID)
+	})
 }
 
-// retryCancel retries a pending cancel transaction
-func (s *Service) retryCancel(ctx context.Context, tx *models.Transaction) models.TransactionStatus {
-	ogAmount, err := strconv.ParseFloat(tx.Amount, 64)
-	if err != nil {
-		slog.Error(err.Error())
-		return models.TransactionStatusFailed
+// markDelivered marks the wallet commands of a confirmed transaction as
+// delivered, along with the balance set on them. Whoever confirms the
+// transaction does it in the same db transaction, so the outbox never
+// disagrees with the transaction.
+func markDelivered(ctx context.Context, repo repository.Repository, commands []*models.WalletCommand) error {
+	for _, command := range commands {
+		if command.ID == uuid.Nil {
+			continue // Built for a transaction queued before the outbox
+		}
+		if err := repo.MarkWalletCommandDelivered(ctx, command); err != nil {
+			return fmt.Errorf("failed to mark wallet command %s as delivered: %w", command.ID, err)
+		}
 	}
+	return nil
+}
 
-	// Find the original transaction to understand what to reverse
-	originalTx, err := s.Repository.GetTransactionByProviderID(ctx, tx.ProviderID)
-	if err != nil {
-		slog.Error("Failed to find original transaction for cancel", "error", err, "transaction_id", tx.ID)
-		return models.TransactionStatusFailed
-	}
-
-	// Reverse the original transaction
-	if originalTx.Type == models.TransactionTypeWithdraw {
-		// Original was a withdrawal (bet), so we need to deposit back
-		depositReq := walletclient.DepositRequest{
-			UserID:   int(tx.PlayerID),
-			Currency: string(tx.Currency),
-			Transactions: []walletclient.DepositRequestTransaction{
-				{
-					Amount:    ogAmount,
-					BetID:     originalTx.ProviderID,
-					Reference: fmt.Sprintf("cancel-%d", tx.ProviderID),
-				},
-			},
-		}
-
-		_, err := s.WalletClient.Deposit(depositReq)
-		if err != nil {
-			slog.Error("Failed to retry cancel deposit", "error", err, "transaction_id", tx.ID)
-			return models.TransactionStatusPending
-		}
+// sendWalletBatch sends the entries in a single wallet request and returns
+// the wallet response along with the request that was sent
+func (s *Service) sendWalletBatch(ctx context.Context, entries []*walletEntry) (*walletclient.OperationResponse, any, error) {
+	head := entries[0]
 
-	} else if originalTx.Type == models.TransactionTypeDeposit {
-		// Original was a deposit (settle), so we need to withdraw back
+	if head.op == models.TransactionTypeWithdraw {
 		withdrawReq := walletclient.WithdrawRequest{
-			UserID:   int(tx.PlayerID),
-			Currency: string(tx.Currency),
-			Transactions: []walletclient.WithdrawRequestTransaction{
-				{
-					Amount:    ogAmount,
-					BetID:     originalTx.ProviderID,
-					Reference: fmt.Sprintf("cancel-%d", tx.ProviderID),
-				},
-			},
-		}
-
-		_, err := s.WalletClient.Withdraw(withdrawReq)
-		if err != nil {
-			slog.Error("Failed to retry cancel withdrawal", "error", err, "transaction_id", tx.ID)
-			return models.TransactionStatusPending
+			UserID:   int(head.tx.PlayerID),
+			Currency: string(head.tx.Currency),
 		}
-	} else {
-		slog.Error("Cannot cancel a cancel transaction", "transaction_id", tx.ID, "original_type", originalTx.Type)
-		return models.TransactionStatusFailed
+		for _, entry := range entries {
+			for _, command := range entry.commands {
+				withdrawReq.Transactions = append(withdrawReq.Transactions, walletclient.WithdrawRequestTransaction{
+					Amount:    command.Amount,
+					BetID:     command.BetID,
+					Reference: command.Reference,
+				})
+			}
+		}
+		resp, err := s.WalletClient.Withdraw(ctx, withdrawReq)
+		return resp, withdrawReq, err
 	}
 
-	originalTx.Status = models.TransactionStatusFinalized
-	if err := s.Repository.UpdateTransaction(ctx, originalTx); err != nil {
-		slog.Error("Failed to update original transaction status", "error", err, "transaction_id", originalTx.ID)
+	depositReq := walletclient.DepositRequest{
+		UserID:   int(head.tx.PlayerID),
+		Currency: string(head.tx.Currency),
 	}
-
-	return models.TransactionStatusConfirmed
+	for _, entry := range entries {
+		for _, command := range entry.commands {
+			depositReq.Transactions = append(depositReq.Transactions, walletclient.DepositRequestTransaction{
+				Amount:    command.Amount,
+				BetID:     command.BetID,
+				Reference: command.Reference,
+			})
+		}
+	}
+	resp, err := s.WalletClient.Deposit(ctx, depositReq)
+	return resp, depositReq, err
 }
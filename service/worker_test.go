@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+)
+
+// recordingWallet records the operation requests sent to the wallet
+type recordingWallet struct {
+	walletclient.Wallet
+
+	mu        sync.Mutex
+	withdraws []walletclient.WithdrawRequest
+	deposits  []walletclient.DepositRequest
+}
+
+func (r *recordingWallet) Withdraw(ctx context.Context, req walletclient.WithdrawRequest) (*walletclient.OperationResponse, error) {
+	r.mu.Lock()
+	r.withdraws = append(r.withdraws, req)
+	r.mu.Unlock()
+	return r.Wallet.Withdraw(ctx, req)
+}
+
+func (r *recordingWallet) Deposit(ctx context.Context, req walletclient.DepositRequest) (*walletclient.OperationResponse, error) {
+	r.mu.Lock()
+	r.deposits = append(r.deposits, req)
+	r.mu.Unlock()
+	return r.Wallet.Deposit(ctx, req)
+}
+
+func TestWorkerBatchesPendingBets(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	// The first bet can't be paid yet, so the next ones queue behind it
+	placeBet(t, s, 1, models.NewAmount(5000))
+	placeBet(t, s, 2, models.NewAmount(10))
+	placeBet(t, s, 3, models.NewAmount(20))
+	assertBalance(t, wallet, models.NewAmount(1000))
+
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(10000))
+	recorder := &recordingWallet{Wallet: wallet}
+	s.WalletClient = recorder
+	dispatch(t, s)
+
+	if len(recorder.withdraws) != 1 || len(recorder.withdraws[0].Transactions) != 3 {
+		t.Fatalf("sent %d withdraw requests, want a single one with the 3 bets", len(recorder.withdraws))
+	}
+	for _, providerID := range []uint64{1, 2, 3} {
+		tx := storedTransaction(t, repo, providerID)
+		assertStatus(t, tx, models.TransactionStatusConfirmed)
+		if tx.Attempts != 1 {
+			t.Errorf("transaction %d took %d attempts, want 1", providerID, tx.Attempts)
+		}
+	}
+	assertBalance(t, wallet, models.NewAmount(4970))
+}
+
+func TestWorkerCancelsBet(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(100))
+	dispatch(t, s)
+	resp, err := s.ProcessCancel(context.Background(), testPlayer, shared.CancelRequest{ProviderTransactionID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != models.TransactionStatusPending {
+		t.Errorf("cancel answered %s, want PENDING", resp.Status)
+	}
+
+	recorder := &recordingWallet{Wallet: wallet}
+	s.WalletClient = recorder
+	dispatch(t, s)
+
+	// The bet is reversed by depositing its amount back
+	if len(recorder.deposits) != 1 || len(recorder.withdraws) != 0 {
+		t.Fatalf("sent %d deposits and %d withdrawals, want a single deposit", len(recorder.deposits), len(recorder.withdraws))
+	}
+	cancel, err := repo.GetTransactionByID(context.Background(), resp.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, cancel, models.TransactionStatusConfirmed)
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusFinalized)
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestWorkerFailsAfterMaxAttempts(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+
+	placeBet(t, s, 1, models.NewAmount(5000))
+	dispatch(t, s)
+
+	bet := storedTransaction(t, repo, 1)
+	assertStatus(t, bet, models.TransactionStatusFailed)
+	if bet.Attempts != 3 {
+		t.Errorf("bet took %d attempts, want 3", bet.Attempts)
+	}
+	assertBalance(t, wallet, models.NewAmount(1000))
+}
+
+func TestWorkerOnlyTakesItsShard(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	other := &models.Player{ID: testPlayer.ID + 1}
+
+	for i, player := range []*models.Player{testPlayer, other} {
+		wallet.SetBalance(player.ID, string(models.CurrencyUSD), 0)
+		_, err := s.ProcessBet(context.Background(), player, shared.WithdrawRequest{
+			Currency:              models.CurrencyUSD,
+			Amount:                models.NewAmount(10),
+			ProviderTransactionID: uint64(i + 1),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wallet.SetBalance(player.ID, string(models.CurrencyUSD), models.NewAmount(100))
+	}
+
+	// Two workers split the players by id, the test player is odd
+	s.processPendingTransactions(context.Background(), 1, 2)
+
+	assertStatus(t, storedTransaction(t, repo, 1), models.TransactionStatusConfirmed)
+	assertStatus(t, storedTransaction(t, repo, 2), models.TransactionStatusPending)
+
+	s.processPendingTransactions(context.Background(), 0, 2)
+	assertStatus(t, storedTransaction(t, repo, 2), models.TransactionStatusConfirmed)
+}
+
+func TestWorkerWakesUpOnNotification(t *testing.T) {
+	s, repo, wallet := newTestService(t)
+	internal.Config.WORKER_COUNT = 2
+	internal.Config.WORKER_TICK_INTERVAL = time.Hour
+
+	placeBet(t, s, 1, models.NewAmount(5000))
+	wallet.SetBalance(testPlayer.ID, string(models.CurrencyUSD), models.NewAmount(10000))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartPendingTransactionWorker(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Nothing ticks within the test, only a notification gets the bet
+	// processed. It is sent until the workers listen.
+	deadline := time.Now().Add(5 * time.Second)
+	for storedTransaction(t, repo, 1).Status != models.TransactionStatusConfirmed {
+		if time.Now().After(deadline) {
+			t.Fatal("the worker was not woken up")
+		}
+		if err := repo.NotifyPendingTransactions(ctx, testPlayer.ID); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertBalance(t, wallet, models.NewAmount(5000))
+}
@@ -1,10 +1,19 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/jihedmastouri/game-integration-api-demo/internal"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
 	"github.com/jihedmastouri/game-integration-api-demo/service"
 	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
 	"github.com/labstack/echo/v4"
@@ -49,6 +58,135 @@ func AuthMiddlewareFactory(s *service.Service) echo.MiddlewareFunc {
 	}
 }
 
+// AdminMiddlewareFactory guards operator endpoints with the x-admin-key
+// header. They are all refused when no ADMIN_API_KEY is configured.
+func AdminMiddlewareFactory() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get("x-admin-key")
+			expected := internal.Config.ADMIN_API_KEY
+			if expected == "" || subtle.ConstantTimeCompare([]byte(key), []byte(expected)) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, shared.ErrorResponse{
+					Code: shared.Unauthorized,
+					Msg:  "invalid admin key",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// maxIdempotencyKeyLength is the size of the idempotency_keys.key column
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyMiddlewareFactory makes the mutating requests sent with an
+// Idempotency-Key header safe to retry: the response of a completed request
+// is replayed, a duplicate of a request still in progress gets a 409 and a
+// key reused for another request a 422. Keys are scoped to the player, so it
+// must run after AuthMiddlewareFactory, and expire after IDEMPOTENCY_KEY_TTL.
+func IdempotencyMiddlewareFactory(s *service.Service) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get("Idempotency-Key")
+			method := c.Request().Method
+			if key == "" || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+					Code: shared.ValidationError,
+					Msg:  "Idempotency-Key header is too long",
+				})
+			}
+
+			player, ok := c.Get("player").(models.Player)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, shared.ErrorResponse{
+					Code: shared.Unauthorized,
+					Msg:  "player not found",
+				})
+			}
+
+			// The body is read to identify the request, then given back to the handler
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+					Code: shared.ValidationError,
+					Msg:  err.Error(),
+				})
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.New()
+			hash.Write([]byte(method + " " + c.Path() + "\n"))
+			hash.Write(body)
+			requestHash := hex.EncodeToString(hash.Sum(nil))
+
+			ctx := c.Request().Context()
+			stored, err := s.BeginIdempotentRequest(ctx, player.ID, key, requestHash)
+			switch {
+			case errors.Is(err, service.ErrIdempotencyKeyInUse):
+				return echo.NewHTTPError(http.StatusConflict, shared.ErrorResponse{
+					Code: shared.IdempotencyKeyInUse,
+					Msg:  err.Error(),
+				})
+			case errors.Is(err, service.ErrIdempotencyKeyMismatch):
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, shared.ErrorResponse{
+					Code: shared.IdempotencyKeyMismatch,
+					Msg:  err.Error(),
+				})
+			case err != nil:
+				return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+					Code: shared.InternalServerError,
+					Msg:  err.Error(),
+				})
+			case stored != nil:
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(stored.ResponseStatus, echo.MIMEApplicationJSONCharsetUTF8, stored.ResponseBody)
+			}
+
+			// A handler that panics never completes the key, it is released so
+			// the request can be sent again instead of staying in progress
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := s.ReleaseIdempotentRequest(context.WithoutCancel(ctx), player.ID, key); err != nil {
+					slog.Error("Failed to release idempotency key", "error", err, "player_id", player.ID, "idempotency_key", key)
+				}
+			}()
+
+			// Keep a copy of the response. Errors are handled here, so their
+			// response is written in time to be saved, and not returned.
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			if err := next(c); err != nil {
+				slog.Error(err.Error())
+				c.Error(err)
+			}
+
+			// Saved even when the client went away, so its retry is answered
+			completed = true
+			if err := s.CompleteIdempotentRequest(context.WithoutCancel(ctx), player.ID, key, c.Response().Status, recorder.body.Bytes()); err != nil {
+				slog.Error("Failed to save idempotent response", "error", err, "player_id", player.ID, "idempotency_key", key)
+			}
+			return nil
+		}
+	}
+}
+
+// responseRecorder copies the body written to a response
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
 func ErrorMiddlewareFactory() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -10,16 +10,19 @@ import (
 
 // Cancel godoc
 // @Summary Cancel a transaction
-// @Description Reverts a previously processed transaction by reversing its financial impact
+// @Description Reverts a previously processed transaction by reversing its financial impact, or part of it with amount. A rollback of part of a transaction needs its own provider_rollback_id, a retry with the same id replays the first response.
 // @Tags Betting
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param Idempotency-Key header string false "Replays the response of a previous request sent with the same key"
 // @Param request body shared.CancelRequest true "Cancel request details"
 // @Success 200 {object} shared.BetOperationResponse "Transaction cancelled successfully"
 // @Failure 400 {object} shared.ErrorResponse "Bad request"
 // @Failure 401 {object} shared.ErrorResponse "Unauthorized"
 // @Failure 404 {object} shared.ErrorResponse "Transaction not found"
+// @Failure 409 {object} shared.ErrorResponse "The amount exceeds what is left to cancel, the provider rollback id was already used with a different payload, or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} shared.ErrorResponse "The Idempotency-Key was already used with another request"
 // @Failure 500 {object} shared.ErrorResponse "Internal server error"
 // @Router /api/v1/cancel [post]
 // @Security BearerAuth
@@ -53,10 +56,7 @@ func (h *Handlers) Cancel(c echo.Context) error {
 	// Process cancel through service
 	cancelResponse, err := h.srv.ProcessCancel(c.Request().Context(), &player, req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
-			Code: shared.InternalServerError,
-			Msg:  err.Error(),
-		})
+		return betOperationError(err)
 	}
 
 	return c.JSON(http.StatusOK, cancelResponse)
@@ -0,0 +1,216 @@
+package rest_v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+	"github.com/labstack/echo/v4"
+)
+
+// ListDeadLetters godoc
+// @Summary List dead letters
+// @Description Lists transactions the worker gave up on, newest first
+// @Tags Admin
+// @Produce json
+// @Param status query string false "Filter by status" Enums(OPEN, REQUEUED, RESOLVED)
+// @Param limit query int false "Page size (max 200)" default(50)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} shared.DeadLetterResponse "Dead letters"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/dead-letters [get]
+// @Security AdminKey
+func (h *Handlers) ListDeadLetters(c echo.Context) error {
+	limit, offset, err := pagination(c, 50, 200)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	status := models.DeadLetterStatus(c.QueryParam("status"))
+	deadLetters, err := h.srv.ListDeadLetters(c.Request().Context(), status, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+			Code: shared.InternalServerError,
+			Msg:  err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, deadLetters)
+}
+
+// GetDeadLetter godoc
+// @Summary Get a dead letter
+// @Description Returns a dead letter with every wallet attempt made for its transaction
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Dead letter ID"
+// @Success 200 {object} shared.DeadLetterResponse "Dead letter"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Dead letter not found"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/dead-letters/{id} [get]
+// @Security AdminKey
+func (h *Handlers) GetDeadLetter(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  "invalid dead letter id",
+		})
+	}
+
+	deadLetter, err := h.srv.GetDeadLetter(c.Request().Context(), id)
+	if err != nil {
+		return deadLetterError(err)
+	}
+
+	return c.JSON(http.StatusOK, deadLetter)
+}
+
+// RequeueDeadLetter godoc
+// @Summary Re-queue a dead letter
+// @Description Puts the transaction back in the pending queue with a fresh retry budget
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Dead letter ID"
+// @Param request body shared.RequeueDeadLetterRequest true "Why the transaction is re-queued"
+// @Success 200 {object} shared.DeadLetterResponse "Dead letter re-queued"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Dead letter not found"
+// @Failure 409 {object} shared.ErrorResponse "Dead letter already closed, or its transaction changed meanwhile"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/dead-letters/{id}/requeue [post]
+// @Security AdminKey
+func (h *Handlers) RequeueDeadLetter(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  "invalid dead letter id",
+		})
+	}
+
+	var req shared.RequeueDeadLetterRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	deadLetter, err := h.srv.RequeueDeadLetter(c.Request().Context(), id, req)
+	if err != nil {
+		return deadLetterError(err)
+	}
+
+	return c.JSON(http.StatusOK, deadLetter)
+}
+
+// ResolveDeadLetter godoc
+// @Summary Force-resolve a dead letter
+// @Description Forces the final status (CONFIRMED or FAILED) of the transaction once the wallet state was checked
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Dead letter ID"
+// @Param request body shared.ResolveDeadLetterRequest true "Resolution and why"
+// @Success 200 {object} shared.DeadLetterResponse "Dead letter resolved"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Dead letter not found"
+// @Failure 409 {object} shared.ErrorResponse "Dead letter already closed, or its transaction changed meanwhile"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/dead-letters/{id}/resolve [post]
+// @Security AdminKey
+func (h *Handlers) ResolveDeadLetter(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  "invalid dead letter id",
+		})
+	}
+
+	var req shared.ResolveDeadLetterRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	deadLetter, err := h.srv.ResolveDeadLetter(c.Request().Context(), id, req)
+	if err != nil {
+		return deadLetterError(err)
+	}
+
+	return c.JSON(http.StatusOK, deadLetter)
+}
+
+func deadLetterError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrDeadLetterNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, shared.ErrorResponse{
+			Code: shared.NotFound,
+			Msg:  err.Error(),
+		})
+	case errors.Is(err, service.ErrDeadLetterClosed), errors.Is(err, models.ErrVersionConflict):
+		return echo.NewHTTPError(http.StatusConflict, shared.ErrorResponse{
+			Code: shared.Conflict,
+			Msg:  err.Error(),
+		})
+	case errors.Is(err, service.ErrReasonRequired), errors.Is(err, service.ErrInvalidResolution):
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+		Code: shared.InternalServerError,
+		Msg:  err.Error(),
+	})
+}
+
+// pagination reads the limit and offset query params
+func pagination(c echo.Context, defaultLimit, maxLimit int) (limit, offset int, err error) {
+	limit = defaultLimit
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			return 0, 0, errors.New("limit should be between 1 and " + strconv.Itoa(maxLimit))
+		}
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset should be a positive number")
+		}
+	}
+	return limit, offset, nil
+}
@@ -16,10 +16,13 @@ import (
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param Idempotency-Key header string false "Replays the response of a previous request sent with the same key"
 // @Param request body shared.DepositRequest true "Settle request details"
 // @Success 200 {object} shared.BetOperationResponse "Bet settled successfully"
 // @Failure 400 {object} shared.ErrorResponse "Bad request"
 // @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 409 {object} shared.ErrorResponse "The provider transaction id was already used with a different payload, the round is closed, or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} shared.ErrorResponse "The Idempotency-Key was already used with another request"
 // @Failure 500 {object} shared.ErrorResponse "Internal server error"
 // @Router /api/v1/deposit [post]
 // @Security BearerAuth
@@ -54,10 +57,7 @@ func (h *Handlers) Deposit(c echo.Context) error {
 	// Process settle through service
 	settleResponse, err := h.srv.ProcessSettle(c.Request().Context(), &player, req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
-			Code: shared.InternalServerError,
-			Msg:  err.Error(),
-		})
+		return betOperationError(err)
 	}
 
 	return c.JSON(http.StatusOK, settleResponse)
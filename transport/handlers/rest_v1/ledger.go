@@ -0,0 +1,51 @@
+package rest_v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+	"github.com/labstack/echo/v4"
+)
+
+// GetPlayerLedger godoc
+// @Summary Get the ledger of a player
+// @Description Returns what the wallet balances of a player should be according to the local ledger, with its latest journal entries
+// @Tags Admin
+// @Produce json
+// @Param id path int true "Player ID"
+// @Param limit query int false "Number of journal entries (max 200)" default(50)
+// @Param offset query int false "Journal entries offset" default(0)
+// @Success 200 {object} shared.PlayerLedgerResponse "Player ledger"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/ledger/players/{id} [get]
+// @Security AdminKey
+func (h *Handlers) GetPlayerLedger(c echo.Context) error {
+	playerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  "invalid player id",
+		})
+	}
+
+	limit, offset, err := pagination(c, 50, 200)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	ledger, err := h.srv.GetPlayerLedger(c.Request().Context(), playerID, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+			Code: shared.InternalServerError,
+			Msg:  err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, ledger)
+}
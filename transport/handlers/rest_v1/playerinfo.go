@@ -30,7 +30,7 @@ func (h *Handlers) PlayerInfo(c echo.Context) error {
 	}
 
 	// Get player info from service
-	walletInfo, err := h.srv.WalletClient.GetBalance(player.ID)
+	walletInfo, err := h.srv.GetWalletBalance(c.Request().Context(), player.ID)
 	if err != nil || walletInfo == nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
 			Code: shared.ServiceUnAvailable,
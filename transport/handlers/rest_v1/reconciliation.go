@@ -0,0 +1,105 @@
+package rest_v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+	"github.com/labstack/echo/v4"
+)
+
+// RunReconciliation godoc
+// @Summary Reconcile the ledger with the wallet
+// @Description Compares the ledger balance of every player with the wallet and returns the report. Players with transactions in flight are skipped.
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} shared.ReconciliationRunResponse "Reconciliation report"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/reconciliations [post]
+// @Security AdminKey
+func (h *Handlers) RunReconciliation(c echo.Context) error {
+	run, err := h.srv.Reconcile(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+			Code: shared.InternalServerError,
+			Msg:  err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, run)
+}
+
+// ListReconciliations godoc
+// @Summary List reconciliation runs
+// @Description Lists reconciliation runs with their counters, newest first
+// @Tags Admin
+// @Produce json
+// @Param limit query int false "Page size (max 200)" default(50)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} shared.ReconciliationRunResponse "Reconciliation runs"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/reconciliations [get]
+// @Security AdminKey
+func (h *Handlers) ListReconciliations(c echo.Context) error {
+	limit, offset, err := pagination(c, 50, 200)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	runs, err := h.srv.ListReconciliationRuns(c.Request().Context(), limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+			Code: shared.InternalServerError,
+			Msg:  err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, runs)
+}
+
+// GetReconciliation godoc
+// @Summary Get a reconciliation report
+// @Description Returns a reconciliation run with every discrepancy it found
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Reconciliation run ID"
+// @Success 200 {object} shared.ReconciliationRunResponse "Reconciliation report"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Reconciliation run not found"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/reconciliations/{id} [get]
+// @Security AdminKey
+func (h *Handlers) GetReconciliation(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  "invalid reconciliation run id",
+		})
+	}
+
+	run, err := h.srv.GetReconciliationRun(c.Request().Context(), id)
+	if errors.Is(err, service.ErrReconciliationRunNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, shared.ErrorResponse{
+			Code: shared.NotFound,
+			Msg:  err.Error(),
+		})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+			Code: shared.InternalServerError,
+			Msg:  err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,122 @@
+package rest_v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+	"github.com/labstack/echo/v4"
+)
+
+// CloseRound godoc
+// @Summary Close a game round
+// @Description Closes a game round of the player: later bets and wins reported in the round are refused, cancels are still accepted. Closing a closed round returns it as it is.
+// @Tags Betting
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param Idempotency-Key header string false "Replays the response of a previous request sent with the same key"
+// @Param request body shared.CloseRoundRequest true "Round to close"
+// @Success 200 {object} shared.RoundResponse "Round closed"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Round not found"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/rounds/close [post]
+// @Security BearerAuth
+func (h *Handlers) CloseRound(c echo.Context) error {
+	player, ok := c.Get("player").(models.Player)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, shared.ErrorResponse{
+			Code: shared.Unauthorized,
+			Msg:  "player not found",
+		})
+	}
+
+	var req shared.CloseRoundRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	round, err := h.srv.CloseRound(c.Request().Context(), &player, req)
+	if errors.Is(err, service.ErrRoundNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, shared.ErrorResponse{
+			Code: shared.NotFound,
+			Msg:  err.Error(),
+		})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+			Code: shared.InternalServerError,
+			Msg:  err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, round)
+}
+
+// RollbackRound godoc
+// @Summary Roll back a game round
+// @Description Cancels what is left of every bet and win of a game round of the player, oldest first. The cancels are queued and answered pending, a round with nothing left to cancel is answered without any.
+// @Tags Betting
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param Idempotency-Key header string false "Replays the response of a previous request sent with the same key"
+// @Param request body shared.RollbackRoundRequest true "Round to roll back"
+// @Success 200 {object} shared.RoundRollbackResponse "Round rolled back"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Round not found"
+// @Failure 409 {object} shared.ErrorResponse "A transaction of the round was cancelled concurrently, or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} shared.ErrorResponse "The Idempotency-Key was already used with another request"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/rounds/rollback [post]
+// @Security BearerAuth
+func (h *Handlers) RollbackRound(c echo.Context) error {
+	player, ok := c.Get("player").(models.Player)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, shared.ErrorResponse{
+			Code: shared.Unauthorized,
+			Msg:  "player not found",
+		})
+	}
+
+	var req shared.RollbackRoundRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	rollback, err := h.srv.RollbackRound(c.Request().Context(), &player, req)
+	if errors.Is(err, service.ErrRoundNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, shared.ErrorResponse{
+			Code: shared.NotFound,
+			Msg:  err.Error(),
+		})
+	}
+	if err != nil {
+		return betOperationError(err)
+	}
+
+	return c.JSON(http.StatusOK, rollback)
+}
@@ -0,0 +1,164 @@
+package rest_v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
+	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
+	"github.com/labstack/echo/v4"
+)
+
+// ListTransactions godoc
+// @Summary List the transactions of the player
+// @Description Returns the transaction history of the player, newest first. Pages are fetched with the next_cursor of the previous one.
+// @Tags Transactions
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param type query string false "Filter by type" Enums(WITHDRAW, DEPOSIT, CANCEL)
+// @Param status query string false "Filter by status" Enums(PENDING, PROCESSING, CONFIRMED, FAILED, FINAL)
+// @Param currency query string false "Filter by currency" Enums(USD, EUR, KES)
+// @Param round_id query string false "Filter by provider round id"
+// @Param from query string false "Created at or after (RFC 3339)"
+// @Param to query string false "Created before (RFC 3339)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size (max 200)" default(50)
+// @Success 200 {object} shared.TransactionPageResponse "Transactions"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/transactions [get]
+// @Security BearerAuth
+func (h *Handlers) ListTransactions(c echo.Context) error {
+	player, ok := c.Get("player").(models.Player)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, shared.ErrorResponse{
+			Code: shared.Unauthorized,
+			Msg:  "player not found",
+		})
+	}
+
+	var req shared.ListTransactionsRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+
+	page, err := h.srv.ListTransactions(c.Request().Context(), &player, req)
+	if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrInvalidDateRange) {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  err.Error(),
+		})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+			Code: shared.InternalServerError,
+			Msg:  err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// GetTransaction godoc
+// @Summary Get the status of a transaction
+// @Description Returns the current outcome of a transaction of the player: its status, how many wallet attempts were made so far, the balances once it is confirmed and why it failed
+// @Tags Transactions
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param id path string true "Transaction ID"
+// @Success 200 {object} shared.TransactionStatusResponse "Transaction"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Transaction not found"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/transactions/{id} [get]
+// @Security BearerAuth
+func (h *Handlers) GetTransaction(c echo.Context) error {
+	player, ok := c.Get("player").(models.Player)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, shared.ErrorResponse{
+			Code: shared.Unauthorized,
+			Msg:  "player not found",
+		})
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  "invalid transaction id",
+		})
+	}
+
+	transaction, err := h.srv.GetTransactionStatus(c.Request().Context(), &player, id)
+	if err != nil {
+		return transactionError(err)
+	}
+
+	return c.JSON(http.StatusOK, transaction)
+}
+
+// GetTransactionByProviderID godoc
+// @Summary Get the status of a transaction by its provider id
+// @Description Returns the current outcome of a bet, a settlement or an identified rollback of the player from its provider transaction id, see GetTransaction
+// @Tags Transactions
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param provider_transaction_id path int true "Provider transaction ID"
+// @Success 200 {object} shared.TransactionStatusResponse "Transaction"
+// @Failure 400 {object} shared.ErrorResponse "Bad request"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 404 {object} shared.ErrorResponse "Transaction not found"
+// @Failure 500 {object} shared.ErrorResponse "Internal server error"
+// @Router /api/v1/transactions/by-provider/{provider_transaction_id} [get]
+// @Security BearerAuth
+func (h *Handlers) GetTransactionByProviderID(c echo.Context) error {
+	player, ok := c.Get("player").(models.Player)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, shared.ErrorResponse{
+			Code: shared.Unauthorized,
+			Msg:  "player not found",
+		})
+	}
+
+	providerTransactionID, err := strconv.ParseUint(c.Param("provider_transaction_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
+			Msg:  "invalid provider transaction id",
+		})
+	}
+
+	transaction, err := h.srv.GetTransactionStatusByProviderID(c.Request().Context(), &player, providerTransactionID)
+	if err != nil {
+		return transactionError(err)
+	}
+
+	return c.JSON(http.StatusOK, transaction)
+}
+
+func transactionError(err error) error {
+	if errors.Is(err, service.ErrTransactionNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, shared.ErrorResponse{
+			Code: shared.NotFound,
+			Msg:  err.Error(),
+		})
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+		Code: shared.InternalServerError,
+		Msg:  err.Error(),
+	})
+}
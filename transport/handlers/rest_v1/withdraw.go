@@ -1,9 +1,11 @@
 package rest_v1
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/jihedmastouri/game-integration-api-demo/models"
+	"github.com/jihedmastouri/game-integration-api-demo/service"
 	"github.com/jihedmastouri/game-integration-api-demo/transport/shared"
 	"github.com/labstack/echo/v4"
 )
@@ -15,10 +17,13 @@ import (
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token" default(Bearer <token>)
+// @Param Idempotency-Key header string false "Replays the response of a previous request sent with the same key"
 // @Param request body shared.WithdrawRequest true "Bet request details"
 // @Success 200 {object} shared.BetOperationResponse "Bet processed successfully"
 // @Failure 400 {object} shared.ErrorResponse "Bad request"
 // @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 409 {object} shared.ErrorResponse "The provider transaction id was already used with a different payload, the round is closed, or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} shared.ErrorResponse "The Idempotency-Key was already used with another request"
 // @Failure 500 {object} shared.ErrorResponse "Internal server error"
 // @Router /api/v1/withdraw [post]
 // @Security BearerAuth
@@ -35,8 +40,8 @@ func (h *Handlers) Withdraw(c echo.Context) error {
 	// Bind request
 	var req shared.WithdrawRequest
 	if err := c.Bind(&req); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
-			Code: shared.ServiceUnAvailable,
+		return echo.NewHTTPError(http.StatusBadRequest, shared.ErrorResponse{
+			Code: shared.ValidationError,
 			Msg:  err.Error(),
 		})
 	}
@@ -52,11 +57,34 @@ func (h *Handlers) Withdraw(c echo.Context) error {
 	// Process bet through service
 	betResponse, err := h.srv.ProcessBet(c.Request().Context(), &player, req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
-			Code: shared.InternalServerError,
-			Msg:  err.Error(),
-		})
+		return betOperationError(err)
 	}
 
 	return c.JSON(http.StatusOK, betResponse)
 }
+
+// betOperationError maps the errors of bets, settlements and cancels to HTTP errors.
+// A retry with the same payload is not an error, it gets the original response.
+func betOperationError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrTransactionMismatch):
+		return echo.NewHTTPError(http.StatusConflict, shared.ErrorResponse{
+			Code: shared.TransactionMismatch,
+			Msg:  err.Error(),
+		})
+	case errors.Is(err, service.ErrRoundClosed):
+		return echo.NewHTTPError(http.StatusConflict, shared.ErrorResponse{
+			Code: shared.RoundClosed,
+			Msg:  err.Error(),
+		})
+	case errors.Is(err, service.ErrRefundExceeded):
+		return echo.NewHTTPError(http.StatusConflict, shared.ErrorResponse{
+			Code: shared.RefundExceeded,
+			Msg:  err.Error(),
+		})
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, shared.ErrorResponse{
+		Code: shared.InternalServerError,
+		Msg:  err.Error(),
+	})
+}
@@ -14,12 +14,29 @@ func SetupRoutes(e *echo.Echo, srv *service.Service) {
 	{
 		v1Group.POST("/auth", v1Handlers.Authenticate)
 
-		authv1 := v1Group.Group("", AuthMiddlewareFactory(srv))
+		authv1 := v1Group.Group("", AuthMiddlewareFactory(srv), IdempotencyMiddlewareFactory(srv))
 		{
 			authv1.GET("/player-info", v1Handlers.PlayerInfo)
+			authv1.GET("/transactions", v1Handlers.ListTransactions)
+			authv1.GET("/transactions/:id", v1Handlers.GetTransaction)
+			authv1.GET("/transactions/by-provider/:provider_transaction_id", v1Handlers.GetTransactionByProviderID)
 			authv1.POST("/withdraw", v1Handlers.Withdraw)
 			authv1.POST("/deposit", v1Handlers.Deposit)
 			authv1.POST("/cancel", v1Handlers.Cancel)
+			authv1.POST("/rounds/close", v1Handlers.CloseRound)
+			authv1.POST("/rounds/rollback", v1Handlers.RollbackRound)
+		}
+
+		adminv1 := v1Group.Group("/admin", AdminMiddlewareFactory())
+		{
+			adminv1.GET("/dead-letters", v1Handlers.ListDeadLetters)
+			adminv1.GET("/dead-letters/:id", v1Handlers.GetDeadLetter)
+			adminv1.POST("/dead-letters/:id/requeue", v1Handlers.RequeueDeadLetter)
+			adminv1.POST("/dead-letters/:id/resolve", v1Handlers.ResolveDeadLetter)
+			adminv1.GET("/ledger/players/:id", v1Handlers.GetPlayerLedger)
+			adminv1.POST("/reconciliations", v1Handlers.RunReconciliation)
+			adminv1.GET("/reconciliations", v1Handlers.ListReconciliations)
+			adminv1.GET("/reconciliations/:id", v1Handlers.GetReconciliation)
 		}
 	}
 }
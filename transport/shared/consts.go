@@ -11,6 +11,14 @@ const (
 	ServiceUnAvailable  errorCode = "SERVICE_UNAVAILABLE"
 	InternalServerError errorCode = "INTERNAL_SERVER_ERROR"
 	Unauthorized        errorCode = "UNAUTHORIZED"
+	NotFound            errorCode = "NOT_FOUND"
+	Conflict            errorCode = "CONFLICT"
+	TransactionMismatch errorCode = "TRANSACTION_MISMATCH"
+	RoundClosed         errorCode = "ROUND_CLOSED"
+	RefundExceeded      errorCode = "REFUND_EXCEEDED"
+
+	IdempotencyKeyInUse    errorCode = "IDEMPOTENCY_KEY_IN_USE"
+	IdempotencyKeyMismatch errorCode = "IDEMPOTENCY_KEY_MISMATCH"
 )
 
 var (
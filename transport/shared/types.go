@@ -1,6 +1,9 @@
 package shared
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/jihedmastouri/game-integration-api-demo/models"
 )
@@ -15,21 +18,72 @@ type PlayerInfoResponse struct {
 	Currency string `json:"currency" example:"USD"`
 }
 
+// DepositRequest settles a single bet, provider_withdrawn_transaction_id,
+// or several bets of a round at once with bets. The amount of a settlement
+// of several bets is the sum of their wins.
 type DepositRequest struct {
-	Currency                       models.Currency `json:"currency" validate:"required" example:"USD"`
-	Amount                         float64         `json:"amount" validate:"min=0" example:"1000.00"`
-	ProviderTransactionID          uint64          `json:"provider_transaction_id" validate:"required" example:"12345"`
-	ProviderWithdrawnTransactionID uint64          `json:"provider_withdrawn_transaction_id" validate:"required" example:"12344"`
+	Currency                       models.Currency    `json:"currency" validate:"required" example:"USD"`
+	Amount                         models.Amount      `json:"amount" validate:"min=0,amount=Currency" swaggertype:"number" example:"1000.00"`
+	ProviderTransactionID          uint64             `json:"provider_transaction_id" validate:"required" example:"12345"`
+	ProviderWithdrawnTransactionID uint64             `json:"provider_withdrawn_transaction_id,omitempty" validate:"required_without=Bets" example:"12344"`
+	Bets                           []SettleBetRequest `json:"bets,omitempty" validate:"omitempty,max=50,dive"`
+	RoundRequest
+}
+
+// SettleBetRequest is the win of one of the bets of a settlement
+type SettleBetRequest struct {
+	ProviderWithdrawnTransactionID uint64        `json:"provider_withdrawn_transaction_id" validate:"required" example:"12344"`
+	Amount                         models.Amount `json:"amount" validate:"min=0" swaggertype:"number" example:"500.00"`
 }
 
 type WithdrawRequest struct {
 	Currency              models.Currency `json:"currency" validate:"required" example:"USD"`
-	Amount                float64         `json:"amount" validate:"required,gt=0" example:"100"`
+	Amount                models.Amount   `json:"amount" validate:"required,gt=0,amount=Currency" swaggertype:"number" example:"100"`
 	ProviderTransactionID uint64          `json:"provider_transaction_id" validate:"required" example:"12345"`
+	RoundRequest
 }
 
+// RoundRequest attaches a bet or a settlement to a game round. A settlement
+// without a round id is attached to the round of its bet.
+type RoundRequest struct {
+	RoundID string `json:"round_id,omitempty" validate:"max=255" example:"r-98765"`
+	GameID  string `json:"game_id,omitempty" validate:"max=255" example:"starburst"`
+	// RoundClosed closes the round once the transaction is recorded
+	RoundClosed bool `json:"round_closed,omitempty" example:"false"`
+}
+
+type CloseRoundRequest struct {
+	RoundID string `json:"round_id" validate:"required,max=255" example:"r-98765"`
+}
+
+type RoundResponse struct {
+	ID        uuid.UUID          `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	RoundID   string             `json:"round_id" example:"r-98765"`
+	GameID    string             `json:"game_id,omitempty" example:"starburst"`
+	Currency  models.Currency    `json:"currency" example:"USD"`
+	Status    models.RoundStatus `json:"status" example:"CLOSED"`
+	TotalBet  models.Amount      `json:"total_bet" swaggertype:"number" example:"10.00"`
+	TotalWon  models.Amount      `json:"total_won" swaggertype:"number" example:"25.00"`
+	CreatedAt time.Time          `json:"created_at"`
+	ClosedAt  *time.Time         `json:"closed_at,omitempty"`
+}
+
+// CancelRequest reverses a transaction, or part of it with amount. A
+// rollback is identified by provider_rollback_id, needed to roll back part
+// of a transaction so a retry is not taken for another rollback.
 type CancelRequest struct {
-	ProviderTransactionID uint64 `json:"provider_transaction_id" validate:"required" example:"12345"`
+	ProviderTransactionID uint64        `json:"provider_transaction_id" validate:"required" example:"12345"`
+	ProviderRollbackID    uint64        `json:"provider_rollback_id,omitempty" validate:"required_with=Amount" example:"12350"`
+	Amount                models.Amount `json:"amount,omitempty" validate:"min=0" swaggertype:"number" example:"50.00"`
+}
+
+type RollbackRoundRequest struct {
+	RoundID string `json:"round_id" validate:"required,max=255" example:"r-98765"`
+}
+
+type RoundRollbackResponse struct {
+	RoundID string                 `json:"round_id" example:"r-98765"`
+	Cancels []BetOperationResponse `json:"cancels"`
 }
 
 type BetOperationResponse struct {
@@ -40,7 +94,142 @@ type BetOperationResponse struct {
 	Status                models.TransactionStatus `json:"status" example:"CONFIRMED"`
 }
 
+// ListTransactionsRequest filters the transaction history of a player, newest
+// first. Cursor is the next_cursor of the previous page.
+type ListTransactionsRequest struct {
+	Type     models.TransactionType   `query:"type" validate:"omitempty,oneof=WITHDRAW DEPOSIT CANCEL"`
+	Status   models.TransactionStatus `query:"status" validate:"omitempty,oneof=PENDING PROCESSING CONFIRMED FAILED FINAL"`
+	Currency models.Currency          `query:"currency" validate:"omitempty,oneof=USD EUR KES"`
+	RoundID  string                   `query:"round_id" validate:"max=255"`
+	From     time.Time                `query:"from"`
+	To       time.Time                `query:"to"`
+	Cursor   string                   `query:"cursor" validate:"max=255"`
+	Limit    int                      `query:"limit" validate:"min=0,max=200"`
+}
+
+type TransactionResponse struct {
+	ID                    uuid.UUID `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ProviderTransactionID uint64    `json:"provider_transaction_id,omitempty" example:"12345"`
+	// ProviderWithdrawnTransactionID is the bet a settlement settles, or the
+	// transaction a cancel reverses
+	ProviderWithdrawnTransactionID uint64                   `json:"provider_withdrawn_transaction_id,omitempty" example:"12344"`
+	RoundID                        string                   `json:"round_id,omitempty" example:"r-98765"`
+	Type                           models.TransactionType   `json:"type" example:"WITHDRAW"`
+	Status                         models.TransactionStatus `json:"status" example:"CONFIRMED"`
+	Amount                         models.Amount            `json:"amount" swaggertype:"number" example:"100.00"`
+	Refunded                       models.Amount            `json:"refunded,omitempty" swaggertype:"number" example:"50.00"`
+	Currency                       models.Currency          `json:"currency" example:"USD"`
+	Attempts                       int                      `json:"attempts" example:"1"`
+	CreatedAt                      time.Time                `json:"created_at"`
+}
+
+// TransactionStatusResponse is the current outcome of a transaction
+type TransactionStatusResponse struct {
+	TransactionResponse
+	// OldBalance and NewBalance are the wallet balances around the
+	// transaction, once it is confirmed
+	OldBalance string `json:"old_balance,omitempty" example:"1900.50"`
+	NewBalance string `json:"new_balance,omitempty" example:"1000.50"`
+	// FailureReason tells why a failed transaction was given up on
+	FailureReason string `json:"failure_reason,omitempty" example:"exceeded max retry attempts (5)"`
+	LastErrorCode string `json:"last_error_code,omitempty" example:"INSUFFICIENT_FUNDS"`
+}
+
+type TransactionPageResponse struct {
+	Transactions []TransactionResponse `json:"transactions"`
+	// NextCursor fetches the next page, it is empty on the last one
+	NextCursor string `json:"next_cursor,omitempty" example:"MTc2MDc3ODU2MzUzNzA4MzAwMF8zYzcwZGQ4MS04OGQ5LTRjNzgtODg2Mi05Y2ZlZWJjZDA2ODg"`
+}
+
 type ErrorResponse struct {
 	Code errorCode `json:"code" example:"Invalid request"`
 	Msg  string    `json:"msg,omitempty" example:"Validation failed"`
 }
+
+type DeadLetterResponse struct {
+	ID                    uuid.UUID                    `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	TransactionID         uuid.UUID                    `json:"transaction_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ProviderTransactionID uint64                       `json:"provider_transaction_id,omitempty" example:"12345"`
+	PlayerID              uint64                       `json:"player_id" example:"34633089486"`
+	TransactionType       models.TransactionType       `json:"transaction_type" example:"WITHDRAW"`
+	TransactionStatus     models.TransactionStatus     `json:"transaction_status" example:"FAILED"`
+	Amount                models.Amount                `json:"amount" swaggertype:"number" example:"100.00"`
+	Currency              models.Currency              `json:"currency" example:"USD"`
+	Reason                string                       `json:"reason" example:"exceeded max retry attempts"`
+	LastErrorCode         string                       `json:"last_error_code,omitempty" example:"INSUFFICIENT_FUNDS"`
+	Status                models.DeadLetterStatus      `json:"status" example:"OPEN"`
+	Resolution            models.TransactionStatus     `json:"resolution,omitempty" example:"CONFIRMED"`
+	ResolutionReason      string                       `json:"resolution_reason,omitempty" example:"wallet support confirmed the debit"`
+	ResolvedBy            string                       `json:"resolved_by,omitempty" example:"jane"`
+	CreatedAt             time.Time                    `json:"created_at"`
+	ResolvedAt            *time.Time                   `json:"resolved_at,omitempty"`
+	Attempts              []TransactionAttemptResponse `json:"attempts,omitempty"`
+}
+
+type TransactionAttemptResponse struct {
+	Operation   models.TransactionType `json:"operation" example:"WITHDRAW"`
+	Payload     json.RawMessage        `json:"payload" swaggertype:"object"`
+	ErrorCode   string                 `json:"error_code,omitempty" example:"SERVICE_UNAVAILABLE"`
+	Error       string                 `json:"error,omitempty"`
+	AttemptedAt time.Time              `json:"attempted_at"`
+}
+
+type RequeueDeadLetterRequest struct {
+	Reason   string `json:"reason" validate:"required" example:"wallet outage is over"`
+	Operator string `json:"operator" example:"jane"`
+}
+
+type ResolveDeadLetterRequest struct {
+	Status   models.TransactionStatus `json:"status" validate:"required" example:"CONFIRMED"`
+	Reason   string                   `json:"reason" validate:"required" example:"wallet support confirmed the debit"`
+	Operator string                   `json:"operator" example:"jane"`
+}
+
+type PlayerLedgerResponse struct {
+	PlayerID uint64                  `json:"player_id" example:"34633089486"`
+	Balances []LedgerBalanceResponse `json:"balances"`
+	Entries  []JournalEntryResponse  `json:"entries"`
+}
+
+type LedgerBalanceResponse struct {
+	Currency models.Currency `json:"currency" example:"USD"`
+	Balance  models.Amount   `json:"balance" swaggertype:"number" example:"1000.50"`
+}
+
+type JournalEntryResponse struct {
+	ID            uuid.UUID             `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	TransactionID uuid.UUID             `json:"transaction_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Type          string                `json:"type" example:"WITHDRAW"`
+	Currency      models.Currency       `json:"currency" example:"USD"`
+	CreatedAt     time.Time             `json:"created_at"`
+	Lines         []JournalLineResponse `json:"lines"`
+}
+
+type JournalLineResponse struct {
+	Account models.LedgerAccountType `json:"account" example:"PLAYER"`
+	Debit   models.Amount            `json:"debit" swaggertype:"number" example:"100.00"`
+	Credit  models.Amount            `json:"credit" swaggertype:"number" example:"0.00"`
+}
+
+type ReconciliationRunResponse struct {
+	ID            uuid.UUID                           `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Accounts      int                                 `json:"accounts" example:"120"`
+	Matched       int                                 `json:"matched" example:"117"`
+	Discrepancies int                                 `json:"discrepancies" example:"1"`
+	Skipped       int                                 `json:"skipped" example:"2"`
+	Errors        int                                 `json:"errors" example:"0"`
+	StartedAt     time.Time                           `json:"started_at"`
+	FinishedAt    *time.Time                          `json:"finished_at,omitempty"`
+	Items         []ReconciliationDiscrepancyResponse `json:"items,omitempty"`
+}
+
+type ReconciliationDiscrepancyResponse struct {
+	PlayerID uint64                 `json:"player_id" example:"34633089486"`
+	Currency models.Currency        `json:"currency" example:"USD"`
+	Kind     models.DiscrepancyKind `json:"kind" example:"BALANCE_MISMATCH"`
+	Expected models.Amount          `json:"expected" swaggertype:"number" example:"1000.50"`
+	Actual   models.Amount          `json:"actual" swaggertype:"number" example:"990.50"`
+	// Difference is the wallet balance minus the ledger balance
+	Difference     models.Amount `json:"difference" swaggertype:"number" example:"-10.00"`
+	WalletCurrency string        `json:"wallet_currency,omitempty" example:"USD"`
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/jihedmastouri/game-integration-api-demo/models"
 	"github.com/jihedmastouri/game-integration-api-demo/service"
+	"github.com/jihedmastouri/game-integration-api-demo/service/walletclient"
 	"github.com/jihedmastouri/game-integration-api-demo/transport/handlers"
 
 	_ "github.com/jihedmastouri/game-integration-api-demo/docs"
@@ -36,6 +37,10 @@ import (
 // @in header
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
+// @securityDefinitions.apikey AdminKey
+// @in header
+// @name x-admin-key
+// @description Operator key (ADMIN_API_KEY).
 func Web(address string, srv *service.Service, logger *slog.Logger) *echo.Echo {
 	e := echo.New()
 	e.Pre(middleware.RemoveTrailingSlash())
@@ -43,7 +48,16 @@ func Web(address string, srv *service.Service, logger *slog.Logger) *echo.Echo {
 
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+		// An open wallet breaker degrades the API but bets are still queued
+		status := "ok"
+		walletState := srv.WalletState()
+		if walletState == walletclient.BreakerOpen {
+			status = "degraded"
+		}
+		return c.JSON(http.StatusOK, map[string]string{
+			"status":         status,
+			"wallet_breaker": string(walletState),
+		})
 	})
 
 	// Secret seed endpoint
@@ -78,7 +92,7 @@ func Web(address string, srv *service.Service, logger *slog.Logger) *echo.Echo {
 			},
 		},
 	))
-	e.Validator = &CustomValidation{validator: validator.New()}
+	e.Validator = NewCustomValidation()
 	e.Use(handlers.ErrorMiddlewareFactory())
 
 	handlers.SetupRoutes(e, srv)
@@ -90,6 +104,27 @@ type CustomValidation struct {
 	validator *validator.Validate
 }
 
+func NewCustomValidation() *CustomValidation {
+	v := validator.New()
+	v.RegisterValidation("amount", validateAmount) //nolint:errcheck
+	return &CustomValidation{validator: v}
+}
+
+// validateAmount checks that an amount has no more decimals than the minor
+// units of the currency held by the field named in the tag param, e.g.
+// `validate:"amount=Currency"`
+func validateAmount(fl validator.FieldLevel) bool {
+	amount, ok := fl.Field().Interface().(models.Amount)
+	if !ok {
+		return false
+	}
+	currency, _, ok := fl.GetStructFieldOK()
+	if !ok {
+		return false
+	}
+	return amount.FitsCurrency(models.Currency(currency.String()))
+}
+
 func (cv *CustomValidation) Validate(i any) error {
 	if err := cv.validator.Struct(i); err != nil {
 		if validationErrors, ok := err.(validator.ValidationErrors); ok {